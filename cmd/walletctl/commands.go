@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/FrankS17/wallet/pkg/types"
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+// errInvalidDump verify нашёл ошибки в дампе.
+var errInvalidDump = errors.New("dump is invalid")
+
+// errAmbiguousFavorite несколько избранных с одним именем.
+var errAmbiguousFavorite = errors.New("favorite name is ambiguous")
+
+func cmdRegister(e *env, args []string) error {
+	fs := e.flags("register")
+	currency := fs.String("currency", "", "account currency, "+string(wallet.DefaultCurrency)+" by default")
+	args, err := e.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	err = e.open(true)
+	if err != nil {
+		return err
+	}
+
+	var account *types.Account
+	if *currency == "" {
+		account, err = e.svc.RegisterAccount(types.Phone(args[0]))
+	} else {
+		account, err = e.svc.RegisterAccountWithCurrency(types.Phone(args[0]), types.Currency(*currency))
+	}
+	if err != nil {
+		return err
+	}
+	err = e.save()
+	if err != nil {
+		return err
+	}
+	return e.print(toAccountJSON(account))
+}
+
+func cmdDeposit(e *env, args []string) error {
+	fs := e.flags("deposit")
+	key := fs.String("key", "", "idempotency key")
+	args, err := e.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	accountID, err := parseID("account", args[0])
+	if err != nil {
+		return err
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	account, err := e.svc.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	amount, err := parseAmount(args[1], account.Currency)
+	if err != nil {
+		return err
+	}
+	err = e.svc.DepositWithKey(*key, accountID, amount)
+	if err != nil {
+		return err
+	}
+	err = e.save()
+	if err != nil {
+		return err
+	}
+	account, err = e.svc.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	return e.print(toAccountJSON(account))
+}
+
+func cmdPay(e *env, args []string) error {
+	fs := e.flags("pay")
+	key := fs.String("key", "", "idempotency key")
+	args, err := e.parse(fs, args, 3)
+	if err != nil {
+		return err
+	}
+	accountID, err := parseID("account", args[0])
+	if err != nil {
+		return err
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	account, err := e.svc.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	amount, err := parseAmount(args[1], account.Currency)
+	if err != nil {
+		return err
+	}
+	payment, err := e.svc.PayWithKey(*key, accountID, amount, types.PaymentCategory(args[2]))
+	if err != nil {
+		return err
+	}
+	err = e.save()
+	if err != nil {
+		return err
+	}
+	return e.print(toPaymentJSON(payment))
+}
+
+func cmdReject(e *env, args []string) error {
+	args, err := e.parse(e.flags("reject"), args, 1)
+	if err != nil {
+		return err
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	err = e.svc.Reject(args[0])
+	if err != nil {
+		return err
+	}
+	err = e.save()
+	if err != nil {
+		return err
+	}
+	payment, err := e.svc.FindPaymentByID(args[0])
+	if err != nil {
+		return err
+	}
+	return e.print(toPaymentJSON(payment))
+}
+
+func cmdRepeat(e *env, args []string) error {
+	args, err := e.parse(e.flags("repeat"), args, 1)
+	if err != nil {
+		return err
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	payment, err := e.svc.Repeat(args[0])
+	if err != nil {
+		return err
+	}
+	err = e.save()
+	if err != nil {
+		return err
+	}
+	return e.print(toPaymentJSON(payment))
+}
+
+func cmdFavoriteAdd(e *env, args []string) error {
+	args, err := e.parse(e.flags("favorite add"), args, 2)
+	if err != nil {
+		return err
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	favorite, err := e.svc.FavoritePayment(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	err = e.save()
+	if err != nil {
+		return err
+	}
+	return e.print(toFavoriteJSON(favorite))
+}
+
+func cmdFavoritePay(e *env, args []string) error {
+	fs := e.flags("favorite pay")
+	key := fs.String("key", "", "idempotency key")
+	args, err := e.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	favorite, err := findFavorite(e.svc, args[0])
+	if err != nil {
+		return err
+	}
+	payment, err := e.svc.PayFromFavoriteWithKey(*key, favorite.ID)
+	if err != nil {
+		return err
+	}
+	err = e.save()
+	if err != nil {
+		return err
+	}
+	return e.print(toPaymentJSON(payment))
+}
+
+// cmdHistory печатает платежи счёта, для счёта без платежей — пустой список.
+func cmdHistory(e *env, args []string) error {
+	args, err := e.parse(e.flags("history"), args, 1)
+	if err != nil {
+		return err
+	}
+	accountID, err := parseID("account", args[0])
+	if err != nil {
+		return err
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	payments, err := e.svc.ExportAccountHistory(accountID)
+	if err == wallet.ErrPaymentNotFound {
+		payments, err = []types.Payment{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	sortPayments(payments)
+	return e.print(toPaymentsJSON(payments))
+}
+
+// cmdExport выгружает все данные: dump — каталогом дампа (см. Service.Export),
+// json — документом ExportJSON, csv — всеми платежами (см. WritePaymentsCSV).
+// json и csv без -o печатаются в stdout.
+func cmdExport(e *env, args []string) error {
+	fs := e.flags("export")
+	format := fs.String("format", "dump", "output format: dump, json or csv")
+	out := fs.String("o", "", "output directory for dump, file for json and csv")
+	_, err := e.parse(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	if *format != "dump" && *format != "json" && *format != "csv" {
+		return fmt.Errorf("%w: unknown format %q", errUsage, *format)
+	}
+	if *format == "dump" && *out == "" {
+		return fmt.Errorf("%w: -o is required for dump", errUsage)
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	if *format == "dump" {
+		err = e.svc.Export(*out)
+		if err != nil {
+			return err
+		}
+		return e.print(exportJSON{Format: *format, Path: *out})
+	}
+
+	buf := &bytes.Buffer{}
+	if *format == "json" {
+		err = e.svc.ExportJSON(buf)
+	} else {
+		var payments []types.Payment
+		payments, err = e.svc.Payments()
+		if err == nil {
+			err = wallet.WritePaymentsCSV(buf, payments, wallet.CSVOptions{})
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if *out == "" || *out == "-" {
+		_, err = e.stdout.Write(buf.Bytes())
+		return err
+	}
+	err = writeFile(*out, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return e.print(exportJSON{Format: *format, Path: *out})
+}
+
+// cmdVerify проверяет дамп через ImportStrict с DryRun и печатает все
+// найденные ошибки. Сервис при этом не загружается.
+func cmdVerify(e *env, args []string) error {
+	_, err := e.parse(e.flags("verify"), args, 0)
+	if err != nil {
+		return err
+	}
+
+	report, err := (&wallet.Service{}).ImportStrict(e.dir, wallet.ImportOptions{DryRun: true})
+	result := verifyJSON{
+		Valid:     err == nil,
+		Accounts:  report.Accounts.Created,
+		Payments:  report.Payments.Created,
+		Favorites: report.Favorites.Created,
+		Keys:      report.Keys,
+		Errors:    []string{},
+	}
+	var importErr *wallet.ImportError
+	switch {
+	case err == nil:
+	case errors.As(err, &importErr):
+		for _, lineErr := range importErr.Errors {
+			result.Errors = append(result.Errors, lineErr.Error())
+		}
+		result.Omitted = importErr.Omitted
+	case errors.Is(err, wallet.ErrManifestMismatch):
+		result.Errors = append(result.Errors, err.Error())
+	default:
+		return err
+	}
+
+	err = e.print(result)
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errInvalidDump
+	}
+	return nil
+}
+
+func cmdStats(e *env, args []string) error {
+	_, err := e.parse(e.flags("stats"), args, 0)
+	if err != nil {
+		return err
+	}
+	err = e.open(false)
+	if err != nil {
+		return err
+	}
+
+	stats, err := e.svc.Stats()
+	if err != nil {
+		return err
+	}
+	return e.print(toStatsJSON(stats))
+}
+
+// findFavorite ищет избранное по ID, а если такого нет — по имени.
+// Имя должно быть единственным, иначе нужен ID.
+func findFavorite(svc *wallet.Service, ref string) (*types.Favorite, error) {
+	favorite, err := svc.FindFavoriteByID(ref)
+	if err != wallet.ErrFavoriteNotFound {
+		return favorite, err
+	}
+
+	favorites, err := svc.Favorites()
+	if err != nil {
+		return nil, err
+	}
+	matches := []types.Favorite{}
+	for _, favorite := range favorites {
+		if favorite.Name == ref {
+			matches = append(matches, favorite)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, wallet.ErrFavoriteNotFound
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("%w: %d favorites named %q, use an ID", errAmbiguousFavorite, len(matches), ref)
+	}
+}
+
+func parseID(what, s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid %s ID %q", errUsage, what, s)
+	}
+	return id, nil
+}
+
+// parseAmount разбирает сумму в основных единицах валюты счёта: "10.50".
+func parseAmount(s string, currency types.Currency) (types.Money, error) {
+	if currency == "" {
+		currency = wallet.DefaultCurrency
+	}
+	amount, err := types.ParseMoneyIn(s, currency)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return amount, nil
+}
+
+// sortPayments упорядочивает платежи по времени создания, затем по ID:
+// сервис возвращает их в произвольном порядке.
+func sortPayments(payments []types.Payment) {
+	sort.Slice(payments, func(i, j int) bool {
+		if !payments[i].CreatedAt.Equal(payments[j].CreatedAt) {
+			return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+		}
+		return payments[i].ID < payments[j].ID
+	})
+}
+
+// writeFile заменяет файл path целиком, чтобы сбой посреди записи не
+// оставил его обрезанным.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tmp.Name(), path)
+}
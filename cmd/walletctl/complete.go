@@ -0,0 +1,168 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// argKind что подставлять по Tab в позиционный аргумент команды.
+type argKind int
+
+const (
+	argAccount argKind = iota + 1
+	argPayment
+	argFavorite
+)
+
+// completer дополняет слово под курсором. Если вариантов несколько и их
+// общее начало уже введено, повторный Tab перебирает варианты по кругу.
+type completer struct {
+	sh *shell
+
+	// состояние перебора: строка и позиция после прошлой подстановки,
+	// начало подставленного слова, варианты и номер текущего
+	line       string
+	pos        int
+	start      int
+	candidates []string
+	index      int
+}
+
+// complete возвращает новую строку и позицию курсора, ok == false, если
+// дополнять нечего.
+func (c *completer) complete(line string, pos int) (string, int, bool) {
+	if c.candidates != nil && line == c.line && pos == c.pos {
+		c.index = (c.index + 1) % len(c.candidates)
+		return c.replace(line, pos, c.start, quoteArg(c.candidates[c.index]))
+	}
+	c.candidates = nil
+
+	head := line[:pos]
+	lexed := lex(head)
+	words := make([]string, 0, len(lexed.tokens))
+	for _, token := range lexed.tokens {
+		words = append(words, token.text)
+	}
+	start, word := pos, ""
+	if !lexed.trailing && len(lexed.tokens) > 0 {
+		last := lexed.tokens[len(lexed.tokens)-1]
+		start, word = last.start, last.text
+		words = words[:len(words)-1]
+	}
+
+	candidates := c.sh.candidates(words, word)
+	switch len(candidates) {
+	case 0:
+		return "", 0, false
+	case 1:
+		return c.replace(line, pos, start, quoteArg(candidates[0])+" ")
+	}
+
+	prefix := commonPrefix(candidates)
+	if len(prefix) > len(word) {
+		if quoteArg(prefix) != prefix {
+			// кавычка остаётся открытой, пока имя не выбрано целиком
+			prefix = strings.TrimSuffix(quoteArg(prefix), `"`)
+		}
+		return c.replace(line, pos, start, prefix)
+	}
+
+	c.candidates, c.index, c.start = candidates, 0, start
+	return c.replace(line, pos, start, quoteArg(candidates[0]))
+}
+
+// replace заменяет line[start:pos] на text и запоминает результат для
+// следующего Tab.
+func (c *completer) replace(line string, pos, start int, text string) (string, int, bool) {
+	newLine := line[:start] + text + line[pos:]
+	c.line, c.pos = newLine, start+len(text)
+	return newLine, c.pos, true
+}
+
+// candidates варианты для слова prefix после слов words, по алфавиту.
+func (sh *shell) candidates(words []string, prefix string) []string {
+	if strings.HasPrefix(prefix, "-") {
+		return nil
+	}
+
+	values := []string{}
+	switch {
+	case len(words) == 0:
+		for _, cmd := range append(append([]command{}, shellCommands...), commands...) {
+			if cmd.name != "shell" {
+				values = append(values, strings.Fields(cmd.name)[0])
+			}
+		}
+	case len(words) == 1 && words[0] == "favorite":
+		values = []string{"add", "pay"}
+	default:
+		cmd, rest, ok := sh.findCommand(words)
+		if !ok {
+			return nil
+		}
+		// флаги и их значения тоже считаются аргументами: точнее без
+		// разбора флагов команды не сказать, а дополнение — только подсказка
+		n := 0
+		for _, arg := range rest {
+			if !strings.HasPrefix(arg, "-") {
+				n++
+			}
+		}
+		if n >= len(cmd.complete) {
+			return nil
+		}
+		values = sh.values(cmd.complete[n])
+	}
+
+	matches := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) && !seen[value] {
+			seen[value] = true
+			matches = append(matches, value)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// values все значения аргумента вида kind. Ошибки хранилища просто
+// оставляют дополнение пустым.
+func (sh *shell) values(kind argKind) []string {
+	svc := sh.env.svc
+	values := []string{}
+	switch kind {
+	case argAccount:
+		accounts, _ := svc.Accounts()
+		for _, account := range accounts {
+			values = append(values, strconv.FormatInt(account.ID, 10))
+		}
+	case argPayment:
+		payments, _ := svc.Payments()
+		for _, payment := range payments {
+			values = append(values, payment.ID)
+		}
+	case argFavorite:
+		favorites, _ := svc.Favorites()
+		for _, favorite := range favorites {
+			values = append(values, favorite.Name)
+		}
+	}
+	return values
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	// не обрываем имя посреди символа
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+func newTestShell(t *testing.T) (*shell, *types.Payment) {
+	t.Helper()
+
+	svc := &wallet.Service{}
+	for i := 1; i <= 10; i++ {
+		account, err := svc.RegisterAccount(types.Phone(fmt.Sprintf("+9929000000%02d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = svc.Deposit(account.ID, 1000)
+	}
+	payment, err := svc.Pay(1, 100, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"my taxi", "my tea", "rent"} {
+		_, err = svc.FavoritePayment(payment.ID, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newShell(&env{svc: svc}), payment
+}
+
+func TestCompleter_complete(t *testing.T) {
+	sh, payment := newTestShell(t)
+
+	tests := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"hi", "history ", true},
+		{"fav", "favorite", true},
+		{"favorite p", "favorite pay ", true},
+		{"deposit ", "deposit 1", true},
+		{"account 1", "account 1", true},
+		{"deposit 2", "deposit 2 ", true},
+		{"deposit 1 ", "deposit 1 ", false},
+		{"reject " + payment.ID[:4], "reject " + payment.ID + " ", true},
+		{"favorite pay r", "favorite pay rent ", true},
+		{"favorite pay my", `favorite pay "my t`, true},
+		{`favorite pay "my tax`, `favorite pay "my taxi" `, true},
+		{"pay -key ", "pay -key 1", true},
+		{"pay -", "pay -", false},
+		{"bogus ", "bogus ", false},
+	}
+	for _, test := range tests {
+		sh.completer = completer{sh: sh}
+		line, pos, ok := sh.completer.complete(test.line, len(test.line))
+		if !ok {
+			line, pos = test.line, len(test.line)
+		}
+		if ok != test.ok || line != test.want || pos != len(test.want) {
+			t.Errorf("complete(%q) = %q, %d, %v, want %q, %v", test.line, line, pos, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestCompleter_cycle(t *testing.T) {
+	sh, _ := newTestShell(t)
+
+	// курсор в середине строки: хвост сохраняется
+	line, pos := "history 1 -json", len("history 1")
+	want := []string{"history 1 -json", "history 10 -json", "history 1 -json"}
+	for i, w := range want {
+		var ok bool
+		line, pos, ok = sh.completer.complete(line, pos)
+		if !ok || line != w || pos != len(w)-len(" -json") {
+			t.Fatalf("Tab %d: %q, %d, %v, want %q", i+1, line, pos, ok, w)
+		}
+	}
+
+	// после правки строки перебор начинается заново
+	line, pos, _ = sh.completer.complete("account 1", len("account 1"))
+	line, _, _ = sh.completer.complete(line, pos)
+	if line != "account 10" {
+		t.Errorf("second Tab after edit = %q, want account 10", line)
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"abc"}, "abc"},
+		{[]string{"abc", "abd", "ab"}, "ab"},
+		{[]string{"x", "y"}, ""},
+		{[]string{"такси", "тариф"}, "та"},
+		{[]string{"ж", "з"}, ""},
+	}
+	for _, test := range tests {
+		if got := commonPrefix(test.values); got != test.want {
+			t.Errorf("commonPrefix(%q) = %q, want %q", test.values, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Команда walletctl работает с каталогом дампа кошелька (см. wallet.Service.Export)
+// без ручной правки файлов: загружает его через Import, выполняет одну
+// операцию и, если операция что-то изменила, записывает каталог обратно
+// через Export.
+//
+//	walletctl [-dir data] [--json] <команда> [аргументы]
+//
+// С --json результат печатается одним JSON-документом в stdout, а ошибка —
+// объектом {"error": "..."} в stderr. Коды выхода: 0 — успех, 1 — ошибка
+// операции или проверки, 2 — неверные аргументы.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+// Коды выхода.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage неверные аргументы команды.
+var errUsage = errors.New("usage")
+
+// command подкоманда walletctl. complete — что подсказывать по Tab для
+// позиционных аргументов в shell.
+type command struct {
+	name     string
+	args     string
+	help     string
+	run      func(env *env, args []string) error
+	complete []argKind
+}
+
+// commands список подкоманд в порядке вывода в справке. Заполняется в
+// init: shell сам ищет команды в этом списке.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"register", "[-currency CUR] <phone>", "register an account", cmdRegister, nil},
+		{"deposit", "[-key KEY] <account> <amount>", "deposit money to an account", cmdDeposit, []argKind{argAccount}},
+		{"pay", "[-key KEY] <account> <amount> <category>", "create a payment", cmdPay, []argKind{argAccount}},
+		{"reject", "<payment>", "reject a payment and refund it", cmdReject, []argKind{argPayment}},
+		{"repeat", "<payment>", "repeat a payment", cmdRepeat, []argKind{argPayment}},
+		{"favorite add", "<payment> <name>", "save a payment as a favorite", cmdFavoriteAdd, []argKind{argPayment}},
+		{"favorite pay", "[-key KEY] <favorite>", "pay from a favorite (ID or unique name)", cmdFavoritePay, []argKind{argFavorite}},
+		{"history", "<account>", "list payments of an account", cmdHistory, []argKind{argAccount}},
+		{"export", "[-format dump|json|csv] [-o PATH]", "export all data", cmdExport, nil},
+		{"verify", "", "check every record of the dump without loading it", cmdVerify, nil},
+		{"stats", "", "show totals", cmdStats, nil},
+		{"shell", "", "start an interactive shell", cmdShell, nil},
+	}
+}
+
+// env общее состояние одного запуска: глобальные флаги, ввод-вывод и
+// сервис. В shell сервис один на все команды, а session решает, когда
+// записывать изменения.
+type env struct {
+	dir     string
+	json    bool
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	svc     *wallet.Service
+	session *shell
+}
+
+func main() {
+	// Import пишет в лог и отсутствующие файлы, которые для CLI не ошибка;
+	// настоящие ошибки возвращаются и печатаются run.
+	log.SetOutput(io.Discard)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run выполняет walletctl с аргументами args и возвращает код выхода.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	e := &env{dir: "data", stdin: stdin, stdout: stdout, stderr: stderr}
+
+	fs := flag.NewFlagSet("walletctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		printUsage(stderr)
+	}
+	e.commonFlags(fs)
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		return exitUsage
+	}
+
+	args = fs.Args()
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
+	}
+	cmd, args, ok := findCommand(commands, args)
+	if !ok {
+		fmt.Fprintf(stderr, "walletctl: unknown command %q\n", strings.Join(args, " "))
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	return e.report(cmd, cmd.run(e, args))
+}
+
+// report печатает ошибку команды cmd и возвращает код выхода.
+func (e *env) report(cmd command, err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case err == flag.ErrHelp:
+		fmt.Fprintf(e.stdout, "usage: %s%s %s\n%s\n", e.prefix(), cmd.name, cmd.args, cmd.help)
+		return exitOK
+	case errors.Is(err, errUsage):
+		e.printError(err)
+		fmt.Fprintf(e.stderr, "usage: %s%s %s\n", e.prefix(), cmd.name, cmd.args)
+		return exitUsage
+	default:
+		e.printError(err)
+		return exitError
+	}
+}
+
+// prefix начало строки справки: в shell команды пишутся без "walletctl".
+func (e *env) prefix() string {
+	if e.session != nil {
+		return ""
+	}
+	return "walletctl "
+}
+
+// findCommand ищет подкоманду по первым словам args (например, "favorite add").
+func findCommand(commands []command, args []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):], true
+		}
+	}
+	return command{}, args, false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: walletctl [-dir DIR] [--json] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.help)
+	}
+}
+
+// commonFlags регистрирует флаги, которые можно указать и до, и после
+// имени команды. Значения по умолчанию — уже разобранные.
+func (e *env) commonFlags(fs *flag.FlagSet) {
+	fs.StringVar(&e.dir, "dir", e.dir, "dump directory")
+	fs.BoolVar(&e.json, "json", e.json, "print results as JSON")
+}
+
+// flags создаёт набор флагов подкоманды cmd с общими флагами.
+func (e *env) flags(cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	// ошибки флагов печатает run вместе со справкой по команде
+	fs.SetOutput(io.Discard)
+	e.commonFlags(fs)
+	return fs
+}
+
+// parse разбирает флаги подкоманды вперемешку с позиционными аргументами
+// и проверяет их число. После "--" флаги не разбираются.
+func (e *env) parse(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	rest := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	positional := []string{}
+	for {
+		err := fs.Parse(args)
+		if err == flag.ErrHelp {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	positional = append(positional, rest...)
+
+	if len(positional) != want {
+		return nil, fmt.Errorf("%w: want %d arguments, got %d", errUsage, want, len(positional))
+	}
+	return positional, nil
+}
+
+// open загружает каталог дампа. Отсутствующий каталог — ошибка, если
+// create == false; иначе сервис начинается пустым, а каталог создаст save.
+// В shell сервис уже загружен.
+func (e *env) open(create bool) error {
+	if e.svc != nil {
+		return nil
+	}
+	e.svc = &wallet.Service{}
+	_, err := os.Stat(e.dir)
+	if os.IsNotExist(err) && create {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return e.svc.Import(e.dir)
+}
+
+// save записывает изменения обратно в каталог дампа. В shell внутри
+// транзакции запись откладывается до commit.
+func (e *env) save() error {
+	if e.session != nil {
+		return e.session.save()
+	}
+	return e.svc.Export(e.dir)
+}
+
+// textWriter результат команды, который умеет печататься для человека.
+type textWriter interface {
+	writeText(w io.Writer) error
+}
+
+// print печатает результат как JSON или как текст.
+func (e *env) print(result textWriter) error {
+	if !e.json {
+		return result.writeText(e.stdout)
+	}
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+func (e *env) printError(err error) {
+	if !e.json && e.session != nil {
+		fmt.Fprintf(e.stderr, "error: %v\n", err)
+		return
+	}
+	if !e.json {
+		fmt.Fprintf(e.stderr, "walletctl: %v\n", err)
+		return
+	}
+	_ = json.NewEncoder(e.stderr).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
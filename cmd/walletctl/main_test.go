@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+type testCLI struct {
+	t   *testing.T
+	dir string
+}
+
+func newTestCLI(t *testing.T) *testCLI {
+	return &testCLI{t: t, dir: filepath.Join(t.TempDir(), "data")}
+}
+
+// run запускает walletctl с каталогом дампа теста.
+func (c *testCLI) run(args ...string) (int, string, string) {
+	c.t.Helper()
+
+	return c.runInput("", args...)
+}
+
+// runInput как run, но с input на stdin.
+func (c *testCLI) runInput(input string, args ...string) (int, string, string) {
+	c.t.Helper()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(append([]string{"-dir", c.dir}, args...), strings.NewReader(input), stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// json запускает команду с --json, ждёт успеха и раскладывает вывод в out.
+func (c *testCLI) json(out interface{}, args ...string) {
+	c.t.Helper()
+
+	code, stdout, stderr := c.run(append([]string{"--json"}, args...)...)
+	if code != exitOK {
+		c.t.Fatalf("walletctl %s: exit %d: %s", strings.Join(args, " "), code, stderr)
+	}
+	if err := json.Unmarshal([]byte(stdout), out); err != nil {
+		c.t.Fatalf("walletctl %s: decode %q: %v", strings.Join(args, " "), stdout, err)
+	}
+}
+
+func TestRun_walletFlow(t *testing.T) {
+	c := newTestCLI(t)
+
+	var account accountJSON
+	c.json(&account, "register", "+992900000001")
+	if account.ID != 1 || account.Balance != 0 || account.Currency != "TJS" {
+		t.Errorf("register = %+v", account)
+	}
+	c.json(&account, "deposit", "1", "100.50")
+	if account.Balance != 10050 {
+		t.Errorf("deposit: balance = %v, want 100.50", account.Balance)
+	}
+
+	// флаги после аргументов тоже разбираются
+	var payment paymentJSON
+	c.json(&payment, "pay", "1", "10", "auto", "-key", "k1")
+	if payment.Amount != 1000 || payment.Category != "auto" || payment.Status != "INPROGRESS" {
+		t.Errorf("pay = %+v", payment)
+	}
+	var replay paymentJSON
+	c.json(&replay, "pay", "-key", "k1", "1", "10", "auto")
+	if replay.ID != payment.ID {
+		t.Errorf("pay with the same key: ID = %s, want %s", replay.ID, payment.ID)
+	}
+
+	var favorite favoriteJSON
+	c.json(&favorite, "favorite", "add", payment.ID, "car")
+	if favorite.Name != "car" || favorite.Amount != 1000 {
+		t.Errorf("favorite add = %+v", favorite)
+	}
+	var fromFavorite paymentJSON
+	c.json(&fromFavorite, "favorite", "pay", favorite.ID)
+	var repeated paymentJSON
+	c.json(&repeated, "repeat", payment.ID)
+	var rejected paymentJSON
+	c.json(&rejected, "reject", payment.ID)
+	if rejected.Status != "FAIL" {
+		t.Errorf("reject: status = %s, want FAIL", rejected.Status)
+	}
+
+	var history []paymentJSON
+	c.json(&history, "history", "1")
+	if len(history) != 3 {
+		t.Errorf("history = %+v, want 3 payments", history)
+	}
+
+	var stats statsJSON
+	c.json(&stats, "stats")
+	if stats.Accounts != 1 || stats.Payments != 3 || stats.Favorites != 1 || stats.Balances["TJS"] != 8050 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	var verify verifyJSON
+	c.json(&verify, "verify")
+	if !verify.Valid || verify.Accounts != 1 || verify.Payments != 3 || verify.Keys != 1 {
+		t.Errorf("verify = %+v", verify)
+	}
+}
+
+func TestRun_textOutput(t *testing.T) {
+	c := newTestCLI(t)
+
+	code, stdout, stderr := c.run("register", "+992900000001")
+	if code != exitOK || !strings.Contains(stdout, "phone    +992900000001") {
+		t.Errorf("register: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	code, stdout, _ = c.run("history", "1")
+	if code != exitOK || stdout != "no payments\n" {
+		t.Errorf("history: exit %d, stdout %q", code, stdout)
+	}
+	code, stdout, _ = c.run("verify")
+	if code != exitOK || stdout != "ok: 1 accounts, 0 payments, 0 favorites, 0 idempotency keys\n" {
+		t.Errorf("verify: exit %d, stdout %q", code, stdout)
+	}
+}
+
+func TestRun_export(t *testing.T) {
+	c := newTestCLI(t)
+	c.json(&accountJSON{}, "register", "+992900000001")
+	c.json(&accountJSON{}, "deposit", "1", "10")
+	c.json(&paymentJSON{}, "pay", "1", "2.50", "auto")
+
+	code, stdout, _ := c.run("export", "-format", "csv")
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if code != exitOK || len(lines) != 2 || !strings.Contains(lines[1], ",1,250,TJS,auto,INPROGRESS,") {
+		t.Errorf("export csv: exit %d, stdout %q", code, stdout)
+	}
+
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	var result exportJSON
+	c.json(&result, "export", "-format", "json", "-o", path)
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Contains(data, []byte(`"+992900000001"`)) {
+		t.Errorf("export json: %q, %v", data, err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "copy")
+	c.json(&result, "export", "-o", dir)
+	var verify verifyJSON
+	copied := &testCLI{t: t, dir: dir}
+	copied.json(&verify, "verify")
+	if !verify.Valid || verify.Payments != 1 {
+		t.Errorf("verify copy = %+v", verify)
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	c := newTestCLI(t)
+	c.json(&accountJSON{}, "register", "+992900000001")
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{}, exitUsage},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"favorite"}, exitUsage},
+		{[]string{"deposit", "1"}, exitUsage},
+		{[]string{"deposit", "x", "10"}, exitUsage},
+		{[]string{"deposit", "1", "ten"}, exitUsage},
+		{[]string{"deposit", "-nope", "1", "10"}, exitUsage},
+		{[]string{"export", "-format", "xml"}, exitUsage},
+		{[]string{"export"}, exitUsage},
+		{[]string{"deposit", "2", "10"}, exitError},
+		{[]string{"pay", "1", "10", "auto"}, exitError},
+		{[]string{"register", "+992900000001"}, exitError},
+		{[]string{"reject", "none"}, exitError},
+		{[]string{"deposit", "-h"}, exitOK},
+	}
+	for _, tt := range tests {
+		if code, _, _ := c.run(tt.args...); code != tt.code {
+			t.Errorf("walletctl %s: exit %d, want %d", strings.Join(tt.args, " "), code, tt.code)
+		}
+	}
+
+	code, stdout, stderr := c.run("--json", "pay", "1", "10", "auto")
+	if code != exitError || stdout != "" || stderr != "{\"error\":\"not enough balance\"}\n" {
+		t.Errorf("pay: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	// чтение не создаёт каталог
+	missing := &testCLI{t: t, dir: filepath.Join(t.TempDir(), "none")}
+	if code, _, _ := missing.run("stats"); code != exitError {
+		t.Errorf("stats on a missing directory: exit %d, want %d", code, exitError)
+	}
+	if _, err := os.Stat(missing.dir); !os.IsNotExist(err) {
+		t.Errorf("stats created %s", missing.dir)
+	}
+}
+
+func TestRun_verifyInvalid(t *testing.T) {
+	c := newTestCLI(t)
+	c.json(&accountJSON{}, "register", "+992900000001")
+	// без манифеста, чтобы проверялись сами записи
+	if err := os.Remove(filepath.Join(c.dir, "manifest.dump")); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(c.dir, "payments.dump"), []byte("p1;7;100;auto;OK\np2;1;x;auto;OK\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, _ := c.run("--json", "verify")
+	var verify verifyJSON
+	if err := json.Unmarshal([]byte(stdout), &verify); err != nil {
+		t.Fatal(err)
+	}
+	if code != exitError || verify.Valid || len(verify.Errors) != 2 {
+		t.Errorf("verify: exit %d, result %+v", code, verify)
+	}
+}
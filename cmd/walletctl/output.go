@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+// Результаты команд: поля с JSON-тегами печатаются с --json, writeText —
+// без него. Суммы в JSON — строки в основных единицах ("10.50").
+
+type accountJSON struct {
+	ID        int64          `json:"id"`
+	Phone     types.Phone    `json:"phone"`
+	Balance   types.Money    `json:"balance"`
+	Currency  types.Currency `json:"currency"`
+	CreatedAt *time.Time     `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time     `json:"updatedAt,omitempty"`
+}
+
+type paymentJSON struct {
+	ID            string                `json:"id"`
+	AccountID     int64                 `json:"accountID"`
+	Amount        types.Money           `json:"amount"`
+	Category      types.PaymentCategory `json:"category"`
+	Status        types.PaymentStatus   `json:"status"`
+	CounterpartID string                `json:"counterpartID,omitempty"`
+	Currency      types.Currency        `json:"currency"`
+	CreatedAt     *time.Time            `json:"createdAt,omitempty"`
+	UpdatedAt     *time.Time            `json:"updatedAt,omitempty"`
+}
+
+type paymentsJSON []paymentJSON
+
+type favoriteJSON struct {
+	ID        string                `json:"id"`
+	AccountID int64                 `json:"accountID"`
+	Name      string                `json:"name"`
+	Amount    types.Money           `json:"amount"`
+	Category  types.PaymentCategory `json:"category"`
+	Currency  types.Currency        `json:"currency"`
+	CreatedAt *time.Time            `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time            `json:"updatedAt,omitempty"`
+}
+
+type accountsJSON []accountJSON
+
+type favoritesJSON []favoriteJSON
+
+type statusChangeJSON struct {
+	From types.PaymentStatus `json:"from,omitempty"`
+	To   types.PaymentStatus `json:"to"`
+	At   *time.Time          `json:"at,omitempty"`
+}
+
+type paymentDetailJSON struct {
+	paymentJSON
+	StatusHistory []statusChangeJSON `json:"statusHistory"`
+}
+
+type historyJSON []string
+
+type messageJSON struct {
+	Message string `json:"message"`
+}
+
+type exportJSON struct {
+	Format string `json:"format"`
+	Path   string `json:"path"`
+}
+
+type verifyJSON struct {
+	Valid     bool     `json:"valid"`
+	Accounts  int      `json:"accounts"`
+	Payments  int      `json:"payments"`
+	Favorites int      `json:"favorites"`
+	Keys      int      `json:"keys"`
+	Errors    []string `json:"errors"`
+	// Omitted ошибки сверх тех, что хранит wallet.ImportError.
+	Omitted int `json:"omitted,omitempty"`
+}
+
+type statsJSON struct {
+	Accounts         int                            `json:"accounts"`
+	Payments         int                            `json:"payments"`
+	Favorites        int                            `json:"favorites"`
+	Balances         map[types.Currency]types.Money `json:"balances"`
+	PaymentsByStatus map[types.PaymentStatus]int    `json:"paymentsByStatus"`
+	Paid             map[types.Currency]types.Money `json:"paid"`
+}
+
+func toAccountJSON(account *types.Account) accountJSON {
+	return accountJSON{
+		ID:        account.ID,
+		Phone:     account.Phone,
+		Balance:   account.Balance,
+		Currency:  currencyOf(account.Currency),
+		CreatedAt: optionalTime(account.CreatedAt),
+		UpdatedAt: optionalTime(account.UpdatedAt),
+	}
+}
+
+func toPaymentJSON(payment *types.Payment) paymentJSON {
+	return paymentJSON{
+		ID:            payment.ID,
+		AccountID:     payment.AccountID,
+		Amount:        payment.Amount,
+		Category:      payment.Category,
+		Status:        payment.Status,
+		CounterpartID: payment.CounterpartID,
+		Currency:      currencyOf(payment.Currency),
+		CreatedAt:     optionalTime(payment.CreatedAt),
+		UpdatedAt:     optionalTime(payment.UpdatedAt),
+	}
+}
+
+func toPaymentsJSON(payments []types.Payment) paymentsJSON {
+	items := make(paymentsJSON, 0, len(payments))
+	for i := range payments {
+		items = append(items, toPaymentJSON(&payments[i]))
+	}
+	return items
+}
+
+func toFavoriteJSON(favorite *types.Favorite) favoriteJSON {
+	return favoriteJSON{
+		ID:        favorite.ID,
+		AccountID: favorite.AccountID,
+		Name:      favorite.Name,
+		Amount:    favorite.Amount,
+		Category:  favorite.Category,
+		Currency:  currencyOf(favorite.Currency),
+		CreatedAt: optionalTime(favorite.CreatedAt),
+		UpdatedAt: optionalTime(favorite.UpdatedAt),
+	}
+}
+
+func toPaymentDetailJSON(payment *types.Payment, changes []types.PaymentStatusChange) paymentDetailJSON {
+	detail := paymentDetailJSON{paymentJSON: toPaymentJSON(payment), StatusHistory: []statusChangeJSON{}}
+	for _, change := range changes {
+		detail.StatusHistory = append(detail.StatusHistory, statusChangeJSON{
+			From: change.From,
+			To:   change.To,
+			At:   optionalTime(change.At),
+		})
+	}
+	return detail
+}
+
+func toStatsJSON(stats wallet.Stats) statsJSON {
+	return statsJSON{
+		Accounts:         stats.Accounts,
+		Payments:         stats.Payments,
+		Favorites:        stats.Favorites,
+		Balances:         stats.Balances,
+		PaymentsByStatus: stats.PaymentsByStatus,
+		Paid:             stats.Paid,
+	}
+}
+
+// optionalTime пропускает в JSON неизвестное (нулевое) время.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// currencyOf возвращает валюту по умолчанию для записей старых дампов.
+func currencyOf(currency types.Currency) types.Currency {
+	if currency == "" {
+		return wallet.DefaultCurrency
+	}
+	return currency
+}
+
+// formatAmount печатает сумму с числом знаков валюты: "10.50 TJS".
+func formatAmount(amount types.Money, currency types.Currency) string {
+	return types.FormatMoney(amount, currency) + " " + string(currency)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (a accountJSON) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "account\t%d\n", a.ID)
+	fmt.Fprintf(tw, "phone\t%s\n", a.Phone)
+	fmt.Fprintf(tw, "balance\t%s\n", formatAmount(a.Balance, a.Currency))
+	fmt.Fprintf(tw, "created\t%s\n", formatTime(a.CreatedAt))
+	fmt.Fprintf(tw, "updated\t%s\n", formatTime(a.UpdatedAt))
+	return tw.Flush()
+}
+
+func (p paymentJSON) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "payment\t%s\n", p.ID)
+	fmt.Fprintf(tw, "account\t%d\n", p.AccountID)
+	fmt.Fprintf(tw, "amount\t%s\n", formatAmount(p.Amount, p.Currency))
+	fmt.Fprintf(tw, "category\t%s\n", p.Category)
+	fmt.Fprintf(tw, "status\t%s\n", p.Status)
+	if p.CounterpartID != "" {
+		fmt.Fprintf(tw, "counterpart\t%s\n", p.CounterpartID)
+	}
+	fmt.Fprintf(tw, "created\t%s\n", formatTime(p.CreatedAt))
+	fmt.Fprintf(tw, "updated\t%s\n", formatTime(p.UpdatedAt))
+	return tw.Flush()
+}
+
+func (p paymentsJSON) writeText(w io.Writer) error {
+	if len(p) == 0 {
+		_, err := fmt.Fprintln(w, "no payments")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tACCOUNT\tAMOUNT\tCATEGORY\tSTATUS\tCREATED")
+	for _, payment := range p {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", payment.ID, payment.AccountID,
+			formatAmount(payment.Amount, payment.Currency), payment.Category, payment.Status, formatTime(payment.CreatedAt))
+	}
+	return tw.Flush()
+}
+
+func (a accountsJSON) writeText(w io.Writer) error {
+	if len(a) == 0 {
+		_, err := fmt.Fprintln(w, "no accounts")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPHONE\tBALANCE")
+	for _, account := range a {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", account.ID, account.Phone, formatAmount(account.Balance, account.Currency))
+	}
+	return tw.Flush()
+}
+
+func (p paymentDetailJSON) writeText(w io.Writer) error {
+	err := p.paymentJSON.writeText(w)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "status history:")
+	for _, change := range p.StatusHistory {
+		from := string(change.From)
+		if from == "" {
+			from = "created"
+		}
+		fmt.Fprintf(tw, "  %s\t-> %s\t%s\n", from, change.To, formatTime(change.At))
+	}
+	return tw.Flush()
+}
+
+func (f favoritesJSON) writeText(w io.Writer) error {
+	if len(f) == 0 {
+		_, err := fmt.Fprintln(w, "no favorites")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tID\tACCOUNT\tAMOUNT\tCATEGORY")
+	for _, favorite := range f {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", favorite.Name, favorite.ID, favorite.AccountID,
+			formatAmount(favorite.Amount, favorite.Currency), favorite.Category)
+	}
+	return tw.Flush()
+}
+
+func (h historyJSON) writeText(w io.Writer) error {
+	for i, line := range h {
+		_, err := fmt.Fprintf(w, "%4d  %s\n", i+1, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m messageJSON) writeText(w io.Writer) error {
+	_, err := fmt.Fprintln(w, m.Message)
+	return err
+}
+
+func (f favoriteJSON) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "favorite\t%s\n", f.ID)
+	fmt.Fprintf(tw, "name\t%s\n", f.Name)
+	fmt.Fprintf(tw, "account\t%d\n", f.AccountID)
+	fmt.Fprintf(tw, "amount\t%s\n", formatAmount(f.Amount, f.Currency))
+	fmt.Fprintf(tw, "category\t%s\n", f.Category)
+	return tw.Flush()
+}
+
+func (x exportJSON) writeText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "exported %s to %s\n", x.Format, x.Path)
+	return err
+}
+
+func (v verifyJSON) writeText(w io.Writer) error {
+	if v.Valid {
+		_, err := fmt.Fprintf(w, "ok: %d accounts, %d payments, %d favorites, %d idempotency keys\n",
+			v.Accounts, v.Payments, v.Favorites, v.Keys)
+		return err
+	}
+	for _, err := range v.Errors {
+		fmt.Fprintln(w, err)
+	}
+	if v.Omitted > 0 {
+		fmt.Fprintf(w, "and %d more\n", v.Omitted)
+	}
+	return nil
+}
+
+func (s statsJSON) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "accounts\t%d\n", s.Accounts)
+	fmt.Fprintf(tw, "favorites\t%d\n", s.Favorites)
+	fmt.Fprintf(tw, "payments\t%d\n", s.Payments)
+
+	statuses := []string{}
+	for status := range s.PaymentsByStatus {
+		statuses = append(statuses, string(status))
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "  %s\t%d\n", status, s.PaymentsByStatus[types.PaymentStatus(status)])
+	}
+
+	for _, currency := range sortedCurrencies(s.Balances) {
+		fmt.Fprintf(tw, "balance\t%s\n", formatAmount(s.Balances[currency], currency))
+	}
+	for _, currency := range sortedCurrencies(s.Paid) {
+		fmt.Fprintf(tw, "paid\t%s\n", formatAmount(s.Paid[currency], currency))
+	}
+	return tw.Flush()
+}
+
+func sortedCurrencies(amounts map[types.Currency]types.Money) []types.Currency {
+	currencies := make([]types.Currency, 0, len(amounts))
+	for currency := range amounts {
+		currencies = append(currencies, currency)
+	}
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i] < currencies[j]
+	})
+	return currencies
+}
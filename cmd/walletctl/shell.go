@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// errTxOpen begin при уже открытой транзакции.
+	errTxOpen = errors.New("transaction already open")
+	// errNoTx commit или rollback без транзакции.
+	errNoTx = errors.New("no open transaction")
+	// errUnterminatedQuote в строке shell не закрыта кавычка.
+	errUnterminatedQuote = errors.New("unterminated quote")
+	// errScriptFailed в неинтерактивном shell хотя бы одна команда не удалась.
+	errScriptFailed = errors.New("some commands failed")
+)
+
+// shell интерактивный режим walletctl: все его команды и команды walletctl
+// работают с одним сервисом, загруженным из каталога дампа. Вне транзакции
+// каждое изменение сразу записывается в дамп, как в walletctl; между begin
+// и commit записи откладываются, а rollback возвращает состояние на момент
+// begin.
+type shell struct {
+	env *env
+	// tx открыта транзакция. Дамп на диске в транзакции не меняется и
+	// хранит состояние на момент begin.
+	tx bool
+	// changes сколько изменений сделано в открытой транзакции.
+	changes int
+	// history выполненные строки в порядке ввода.
+	history []string
+	// failed хотя бы одна команда завершилась ошибкой.
+	failed    bool
+	quit      bool
+	completer completer
+}
+
+// shellCommands команды, которые есть только в shell. Проверяются раньше
+// команд walletctl, поэтому history здесь перекрывает history walletctl.
+var shellCommands []command
+
+func init() {
+	shellCommands = []command{
+		{"help", "", "list commands", shHelp, nil},
+		{"accounts", "", "list accounts with balances", shAccounts, nil},
+		{"account", "<account>", "show an account and its balance", shAccount, []argKind{argAccount}},
+		{"payment", "<payment>", "show a payment and its status history", shPayment, []argKind{argPayment}},
+		{"favorites", "", "list favorites", shFavorites, nil},
+		{"history", "[account]", "command history, or payments of an account", shHistory, []argKind{argAccount}},
+		{"begin", "", "start a transaction", shBegin, nil},
+		{"commit", "", "write the changes of the transaction to the dump", shCommit, nil},
+		{"rollback", "", "discard the changes of the transaction", shRollback, nil},
+		{"exit", "", "leave the shell, an open transaction is rolled back", shExit, nil},
+		{"quit", "", "same as exit", shExit, nil},
+	}
+}
+
+// lineReader источник строк shell: терминал с редактированием строки или
+// поток (скрипт, pipe).
+type lineReader interface {
+	ReadLine() (string, error)
+	SetPrompt(prompt string)
+}
+
+func newShell(e *env) *shell {
+	sh := &shell{env: e}
+	e.session = sh
+	sh.completer.sh = sh
+	return sh
+}
+
+// run читает и выполняет строки до exit или конца ввода.
+func (sh *shell) run(r lineReader) error {
+	for !sh.quit {
+		r.SetPrompt(sh.prompt())
+		line, err := r.ReadLine()
+		if err == io.EOF {
+			sh.leave()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		sh.exec(line)
+	}
+	return nil
+}
+
+func (sh *shell) prompt() string {
+	if sh.tx {
+		return "wallet(tx)> "
+	}
+	return "wallet> "
+}
+
+// exec выполняет одну строку. Флаги --json и -dir действуют только на эту
+// строку.
+func (sh *shell) exec(line string) {
+	e := sh.env
+	args, err := splitArgs(line)
+	if err != nil {
+		sh.failed = true
+		e.printError(err)
+		return
+	}
+	if len(args) == 0 {
+		return
+	}
+	sh.history = append(sh.history, line)
+
+	cmd, rest, ok := sh.findCommand(args)
+	if !ok {
+		sh.failed = true
+		e.printError(fmt.Errorf("unknown command %q, try help", strings.Join(args, " ")))
+		return
+	}
+
+	dir, json := e.dir, e.json
+	if e.report(cmd, cmd.run(e, rest)) != exitOK {
+		sh.failed = true
+	}
+	e.dir, e.json = dir, json
+}
+
+// findCommand ищет команду shell, затем команду walletctl.
+func (sh *shell) findCommand(args []string) (command, []string, bool) {
+	cmd, rest, ok := findCommand(shellCommands, args)
+	if ok {
+		return cmd, rest, true
+	}
+	cmd, rest, ok = findCommand(commands, args)
+	if ok && cmd.name != "shell" {
+		return cmd, rest, true
+	}
+	return command{}, args, false
+}
+
+// save вызывается командами walletctl после изменения: вне транзакции
+// пишет дамп, в транзакции только считает изменения.
+func (sh *shell) save() error {
+	if sh.tx {
+		sh.changes++
+		return nil
+	}
+	return sh.env.svc.Export(sh.env.dir)
+}
+
+// leave откатывает открытую транзакцию перед выходом.
+func (sh *shell) leave() {
+	sh.quit = true
+	if !sh.tx {
+		return
+	}
+	err := sh.rollback()
+	if err != nil {
+		sh.env.printError(err)
+		return
+	}
+	fmt.Fprintln(sh.env.stderr, "open transaction rolled back")
+}
+
+// rollback заново открывает сервис из каталога дампа, как при запуске
+// walletctl: в транзакции дамп не менялся и хранит состояние на момент
+// begin. При ошибке остаётся прежний сервис и открытая транзакция.
+func (sh *shell) rollback() error {
+	e := sh.env
+	svc := e.svc
+	e.svc = nil
+	err := e.open(true)
+	if err != nil {
+		e.svc = svc
+		return err
+	}
+	sh.tx = false
+	return nil
+}
+
+func shHelp(e *env, args []string) error {
+	_, err := e.parse(e.flags("help"), args, 0)
+	if err != nil {
+		return err
+	}
+	w := e.stdout
+	fmt.Fprintln(w, "shell commands:")
+	for _, cmd := range shellCommands {
+		fmt.Fprintf(w, "  %-24s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.help)
+	}
+	fmt.Fprintln(w, "walletctl commands:")
+	for _, cmd := range commands {
+		if cmd.name == "shell" {
+			continue
+		}
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.help)
+	}
+	_, err = fmt.Fprintln(w, "Tab completes commands, account IDs, payment IDs and favorite names.")
+	return err
+}
+
+func shAccounts(e *env, args []string) error {
+	_, err := e.parse(e.flags("accounts"), args, 0)
+	if err != nil {
+		return err
+	}
+	accounts, err := e.svc.Accounts()
+	if err != nil {
+		return err
+	}
+	items := make(accountsJSON, 0, len(accounts))
+	for i := range accounts {
+		items = append(items, toAccountJSON(&accounts[i]))
+	}
+	return e.print(items)
+}
+
+func shAccount(e *env, args []string) error {
+	args, err := e.parse(e.flags("account"), args, 1)
+	if err != nil {
+		return err
+	}
+	accountID, err := parseID("account", args[0])
+	if err != nil {
+		return err
+	}
+	account, err := e.svc.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	return e.print(toAccountJSON(account))
+}
+
+func shPayment(e *env, args []string) error {
+	args, err := e.parse(e.flags("payment"), args, 1)
+	if err != nil {
+		return err
+	}
+	payment, err := e.svc.FindPaymentByID(args[0])
+	if err != nil {
+		return err
+	}
+	changes, err := e.svc.PaymentStatusHistory(args[0])
+	if err != nil {
+		return err
+	}
+	return e.print(toPaymentDetailJSON(payment, changes))
+}
+
+func shFavorites(e *env, args []string) error {
+	_, err := e.parse(e.flags("favorites"), args, 0)
+	if err != nil {
+		return err
+	}
+	favorites, err := e.svc.Favorites()
+	if err != nil {
+		return err
+	}
+	items := make(favoritesJSON, 0, len(favorites))
+	for i := range favorites {
+		items = append(items, toFavoriteJSON(&favorites[i]))
+	}
+	return e.print(items)
+}
+
+// shHistory без аргументов печатает историю команд, с аргументами —
+// платежи счёта, как history в walletctl.
+func shHistory(e *env, args []string) error {
+	if len(args) > 0 {
+		return cmdHistory(e, args)
+	}
+	return e.print(historyJSON(e.session.history))
+}
+
+func shBegin(e *env, args []string) error {
+	_, err := e.parse(e.flags("begin"), args, 0)
+	if err != nil {
+		return err
+	}
+	sh := e.session
+	if sh.tx {
+		return errTxOpen
+	}
+	sh.tx, sh.changes = true, 0
+	return e.print(messageJSON{"transaction started"})
+}
+
+func shCommit(e *env, args []string) error {
+	_, err := e.parse(e.flags("commit"), args, 0)
+	if err != nil {
+		return err
+	}
+	sh := e.session
+	if !sh.tx {
+		return errNoTx
+	}
+	// при ошибке записи транзакция остаётся открытой
+	err = e.svc.Export(e.dir)
+	if err != nil {
+		return err
+	}
+	sh.tx = false
+	return e.print(messageJSON{"committed " + plural(sh.changes, "change")})
+}
+
+func shRollback(e *env, args []string) error {
+	_, err := e.parse(e.flags("rollback"), args, 0)
+	if err != nil {
+		return err
+	}
+	sh := e.session
+	if !sh.tx {
+		return errNoTx
+	}
+	err = sh.rollback()
+	if err != nil {
+		return err
+	}
+	return e.print(messageJSON{"rolled back " + plural(sh.changes, "change")})
+}
+
+func shExit(e *env, args []string) error {
+	_, err := e.parse(e.flags("exit"), args, 0)
+	if err != nil {
+		return err
+	}
+	e.session.leave()
+	return nil
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return strconv.Itoa(n) + " " + word + "s"
+}
+
+// streamReader читает строки shell из обычного потока, без приглашения.
+type streamReader struct {
+	scanner *bufio.Scanner
+}
+
+func newStreamReader(r io.Reader) *streamReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &streamReader{scanner: scanner}
+}
+
+func (r *streamReader) ReadLine() (string, error) {
+	if r.scanner.Scan() {
+		return r.scanner.Text(), nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+func (r *streamReader) SetPrompt(string) {}
+
+// token слово строки shell и его начало в байтах.
+type token struct {
+	text  string
+	start int
+}
+
+// lexResult разбор строки shell. open — строка кончилась внутри кавычек
+// или после "\", trailing — после последнего слова есть пробел.
+type lexResult struct {
+	tokens   []token
+	open     bool
+	trailing bool
+}
+
+// lex делит строку на слова по пробелам. Двойные кавычки объединяют слова
+// с пробелами, "\" экранирует следующий символ.
+func lex(line string) lexResult {
+	result := lexResult{}
+	text := strings.Builder{}
+	start := -1
+	quoted, escaped := false, false
+	for i, r := range line {
+		switch {
+		case escaped:
+			text.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if start >= 0 {
+				result.tokens = append(result.tokens, token{text.String(), start})
+				text.Reset()
+				start = -1
+			}
+			continue
+		default:
+			text.WriteRune(r)
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		result.tokens = append(result.tokens, token{text.String(), start})
+	}
+	result.open = quoted || escaped
+	result.trailing = start < 0 && len(line) > 0
+	return result
+}
+
+// splitArgs делит строку shell на аргументы (см. lex).
+func splitArgs(line string) ([]string, error) {
+	result := lex(line)
+	if result.open {
+		return nil, errUnterminatedQuote
+	}
+	args := make([]string, 0, len(result.tokens))
+	for _, token := range result.tokens {
+		args = append(args, token.text)
+	}
+	return args, nil
+}
+
+// quoteArg возвращает аргумент в виде, который splitArgs прочитает обратно.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
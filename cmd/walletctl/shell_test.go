@@ -0,0 +1,159 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShell_transactions(t *testing.T) {
+	// begin и rollback работают с каталогом дампа, временные файлы не нужны
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	c := newTestCLI(t)
+	c.run("register", "+992900000001")
+	c.run("deposit", "1", "100")
+
+	code, stdout, stderr := c.runInput(strings.Join([]string{
+		"begin",
+		"pay 1 10 auto",
+		"rollback",
+		"begin",
+		"pay 1 5 food",
+		"deposit 1 1",
+		"commit",
+		"begin",
+		"pay 1 50 auto",
+	}, "\n"), "shell")
+	if code != exitOK {
+		t.Fatalf("shell: exit %d: %s", code, stderr)
+	}
+	for _, want := range []string{"transaction started", "rolled back 1 change", "committed 2 changes"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("shell output %q does not contain %q", stdout, want)
+		}
+	}
+	if !strings.Contains(stderr, "open transaction rolled back") {
+		t.Errorf("shell stderr = %q, want rollback on exit", stderr)
+	}
+
+	// в дампе только закоммиченная транзакция
+	_, stdout, _ = c.run("stats")
+	if !strings.Contains(stdout, "96.00 TJS") {
+		t.Errorf("stats = %q, want balance 96.00", stdout)
+	}
+	var payments paymentsJSON
+	c.json(&payments, "history", "1")
+	if len(payments) != 1 || payments[0].Category != "food" {
+		t.Errorf("history = %+v, want one food payment", payments)
+	}
+}
+
+func TestShell_commands(t *testing.T) {
+	c := newTestCLI(t)
+
+	code, stdout, stderr := c.runInput(strings.Join([]string{
+		"register +992900000001",
+		"deposit 1 100",
+		"pay --json 1 10 auto",
+		"accounts",
+		"",
+		"history",
+		"exit",
+		"stats",
+	}, "\n"), "shell")
+	if code != exitOK {
+		t.Fatalf("shell: exit %d: %s", code, stderr)
+	}
+	// --json действует только на свою строку
+	if !strings.Contains(stdout, `"category": "auto"`) || !strings.Contains(stdout, "+992900000001  90.00 TJS") {
+		t.Errorf("shell output = %q", stdout)
+	}
+	// пустые строки в историю не попадают, после exit команды не выполняются
+	if !strings.Contains(stdout, "   5  history") || strings.Contains(stdout, "stats") {
+		t.Errorf("shell history = %q", stdout)
+	}
+}
+
+func TestShell_favoriteByName(t *testing.T) {
+	c := newTestCLI(t)
+	c.run("register", "+992900000001")
+	c.run("deposit", "1", "100")
+	var payment paymentJSON
+	c.json(&payment, "pay", "1", "10", "auto")
+
+	code, stdout, stderr := c.runInput(strings.Join([]string{
+		"favorite add " + payment.ID + ` "my taxi"`,
+		`favorite pay "my taxi"`,
+		"favorite add " + payment.ID + ` "my taxi"`,
+		`favorite pay "my taxi"`,
+	}, "\n"), "shell")
+	if code != exitError {
+		t.Errorf("shell: exit %d, want %d", code, exitError)
+	}
+	if strings.Count(stdout, "payment ") != 1 {
+		t.Errorf("shell output = %q, want one payment", stdout)
+	}
+	if !strings.Contains(stderr, "favorite name is ambiguous") {
+		t.Errorf("shell stderr = %q, want ambiguous favorite", stderr)
+	}
+}
+
+func TestShell_errors(t *testing.T) {
+	c := newTestCLI(t)
+
+	code, _, stderr := c.runInput(strings.Join([]string{
+		"bogus",
+		"commit",
+		"begin",
+		"begin",
+		`pay "1`,
+		"account",
+	}, "\n"), "shell")
+	if code != exitError {
+		t.Errorf("shell: exit %d, want %d", code, exitError)
+	}
+	for _, want := range []string{
+		`error: unknown command "bogus"`,
+		"error: no open transaction",
+		"error: transaction already open",
+		"error: unterminated quote",
+		"usage: account <account>",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("shell stderr %q does not contain %q", stderr, want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", []string{}},
+		{"  pay  1 10\tauto ", []string{"pay", "1", "10", "auto"}},
+		{`favorite pay "my taxi"`, []string{"favorite", "pay", "my taxi"}},
+		{`a\ b "c \"d\"" ""`, []string{"a b", `c "d"`, ""}},
+		{`x"y z"`, []string{"xy z"}},
+	}
+	for _, test := range tests {
+		got, err := splitArgs(test.line)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q) = %q, %v, want %q", test.line, got, err, test.want)
+		}
+	}
+
+	for _, line := range []string{`pay "1`, `pay 1\`} {
+		if _, err := splitArgs(line); err != errUnterminatedQuote {
+			t.Errorf("splitArgs(%q) error = %v, want %v", line, err, errUnterminatedQuote)
+		}
+	}
+
+	for _, arg := range []string{"taxi", "my taxi", `a"b`, `c:\dir`, ""} {
+		got, err := splitArgs(quoteArg(arg))
+		if err != nil || len(got) != 1 || got[0] != arg {
+			t.Errorf("splitArgs(quoteArg(%q)) = %q, %v", arg, got, err)
+		}
+	}
+}
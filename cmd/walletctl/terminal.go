@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// cmdShell запускает shell над каталогом дампа. На терминале доступны
+// редактирование строки, история по стрелкам и дополнение по Tab; из
+// pipe или файла строки просто выполняются по очереди, и если хоть одна
+// не удалась, shell завершается с ошибкой.
+func cmdShell(e *env, args []string) error {
+	_, err := e.parse(e.flags("shell"), args, 0)
+	if err != nil {
+		return err
+	}
+	err = e.open(true)
+	if err != nil {
+		return err
+	}
+
+	sh := newShell(e)
+	if file, ok := e.stdin.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		return sh.runTerminal(file)
+	}
+	err = sh.run(newStreamReader(e.stdin))
+	if err != nil {
+		return err
+	}
+	if sh.failed {
+		return errScriptFailed
+	}
+	return nil
+}
+
+// runTerminal переводит терминал в raw-режим и читает строки через
+// term.Terminal. Вывод команд идёт через него же, чтобы не ломать строку ввода.
+func (sh *shell) runTerminal(file *os.File) error {
+	fd := int(file.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	e := sh.env
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{file, e.stdout}, sh.prompt())
+	if width, height, err := term.GetSize(fd); err == nil {
+		_ = t.SetSize(width, height)
+	}
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return sh.completer.complete(line, pos)
+	}
+
+	stdout, stderr := e.stdout, e.stderr
+	e.stdout, e.stderr = t, t
+	defer func() {
+		e.stdout, e.stderr = stdout, stderr
+	}()
+
+	fmt.Fprintf(t, "wallet shell on %s, type help for commands\n", e.dir)
+	return sh.run(terminalReader{t})
+}
+
+// terminalReader считает вставленную из буфера строку обычной строкой.
+type terminalReader struct {
+	*term.Terminal
+}
+
+func (r terminalReader) ReadLine() (string, error) {
+	line, err := r.Terminal.ReadLine()
+	if err == term.ErrPasteIndicator {
+		err = nil
+	}
+	return line, err
+}
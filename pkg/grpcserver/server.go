@@ -0,0 +1,312 @@
+// Package grpcserver открывает сервис кошелька по gRPC (схема — пакет
+// walletpb). Ошибки сервиса возвращаются статусами gRPC с подходящим кодом
+// и errdetails.ErrorInfo (см. statusFor).
+//
+//	srv := grpc.NewServer()
+//	walletpb.RegisterWalletServer(srv, grpcserver.NewServer(svc))
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/FrankS17/wallet/pkg/types"
+	"github.com/FrankS17/wallet/pkg/wallet"
+	"github.com/FrankS17/wallet/pkg/walletpb"
+)
+
+// filterGoroutines сколько горутин FilterPaymentsByFn использует для FilterPayments.
+const filterGoroutines = 4
+
+// Server реализует walletpb.WalletServer поверх wallet.Service.
+type Server struct {
+	walletpb.UnimplementedWalletServer
+
+	svc *wallet.Service
+}
+
+// NewServer создаёт сервер поверх svc.
+func NewServer(svc *wallet.Service) *Server {
+	return &Server{svc: svc}
+}
+
+func (s *Server) RegisterAccount(_ context.Context, req *walletpb.RegisterAccountRequest) (*walletpb.Account, error) {
+	if req.GetPhone() == "" {
+		return nil, toStatusError("RegisterAccount", fmt.Errorf("%w: phone is required", errInvalidArgument))
+	}
+
+	var account *types.Account
+	var err error
+	if req.GetCurrency() == "" {
+		account, err = s.svc.RegisterAccount(types.Phone(req.GetPhone()))
+	} else {
+		account, err = s.svc.RegisterAccountWithCurrency(types.Phone(req.GetPhone()), types.Currency(req.GetCurrency()))
+	}
+	if err != nil {
+		return nil, toStatusError("RegisterAccount", err)
+	}
+	return toAccountPB(account), nil
+}
+
+func (s *Server) GetAccount(_ context.Context, req *walletpb.GetAccountRequest) (*walletpb.Account, error) {
+	account, err := s.svc.FindAccountByID(req.GetAccountId())
+	if err != nil {
+		return nil, toStatusError("GetAccount", err)
+	}
+	return toAccountPB(account), nil
+}
+
+func (s *Server) Deposit(_ context.Context, req *walletpb.DepositRequest) (*walletpb.Account, error) {
+	err := s.svc.DepositWithKey(req.GetIdempotencyKey(), req.GetAccountId(), types.Money(req.GetAmount()))
+	if err != nil {
+		return nil, toStatusError("Deposit", err)
+	}
+	account, err := s.svc.FindAccountByID(req.GetAccountId())
+	if err != nil {
+		return nil, toStatusError("Deposit", err)
+	}
+	return toAccountPB(account), nil
+}
+
+func (s *Server) Pay(_ context.Context, req *walletpb.PayRequest) (*walletpb.Payment, error) {
+	if req.GetCategory() == "" {
+		return nil, toStatusError("Pay", fmt.Errorf("%w: category is required", errInvalidArgument))
+	}
+	payment, err := s.svc.PayWithKey(req.GetIdempotencyKey(), req.GetAccountId(), types.Money(req.GetAmount()), types.PaymentCategory(req.GetCategory()))
+	if err != nil {
+		return nil, toStatusError("Pay", err)
+	}
+	return toPaymentPB(payment), nil
+}
+
+func (s *Server) Transfer(_ context.Context, req *walletpb.TransferRequest) (*walletpb.Payment, error) {
+	payment, err := s.svc.Transfer(req.GetFromAccountId(), types.Phone(req.GetToPhone()), types.Money(req.GetAmount()))
+	if err != nil {
+		return nil, toStatusError("Transfer", err)
+	}
+	return toPaymentPB(payment), nil
+}
+
+func (s *Server) GetPayment(_ context.Context, req *walletpb.GetPaymentRequest) (*walletpb.Payment, error) {
+	payment, err := s.svc.FindPaymentByID(req.GetPaymentId())
+	if err != nil {
+		return nil, toStatusError("GetPayment", err)
+	}
+	return toPaymentPB(payment), nil
+}
+
+func (s *Server) Confirm(_ context.Context, req *walletpb.ConfirmRequest) (*walletpb.Payment, error) {
+	err := s.svc.Confirm(req.GetPaymentId())
+	if err != nil {
+		return nil, toStatusError("Confirm", err)
+	}
+	payment, err := s.svc.FindPaymentByID(req.GetPaymentId())
+	if err != nil {
+		return nil, toStatusError("Confirm", err)
+	}
+	return toPaymentPB(payment), nil
+}
+
+func (s *Server) Reject(_ context.Context, req *walletpb.RejectRequest) (*walletpb.Payment, error) {
+	err := s.svc.Reject(req.GetPaymentId())
+	if err != nil {
+		return nil, toStatusError("Reject", err)
+	}
+	payment, err := s.svc.FindPaymentByID(req.GetPaymentId())
+	if err != nil {
+		return nil, toStatusError("Reject", err)
+	}
+	return toPaymentPB(payment), nil
+}
+
+func (s *Server) Repeat(_ context.Context, req *walletpb.RepeatRequest) (*walletpb.Payment, error) {
+	payment, err := s.svc.Repeat(req.GetPaymentId())
+	if err != nil {
+		return nil, toStatusError("Repeat", err)
+	}
+	return toPaymentPB(payment), nil
+}
+
+func (s *Server) FavoritePayment(_ context.Context, req *walletpb.FavoritePaymentRequest) (*walletpb.Favorite, error) {
+	favorite, err := s.svc.FavoritePayment(req.GetPaymentId(), req.GetName())
+	if err != nil {
+		return nil, toStatusError("FavoritePayment", err)
+	}
+	return toFavoritePB(favorite), nil
+}
+
+func (s *Server) GetFavorite(_ context.Context, req *walletpb.GetFavoriteRequest) (*walletpb.Favorite, error) {
+	favorite, err := s.svc.FindFavoriteByID(req.GetFavoriteId())
+	if err != nil {
+		return nil, toStatusError("GetFavorite", err)
+	}
+	return toFavoritePB(favorite), nil
+}
+
+func (s *Server) PayFromFavorite(_ context.Context, req *walletpb.PayFromFavoriteRequest) (*walletpb.Payment, error) {
+	payment, err := s.svc.PayFromFavoriteWithKey(req.GetIdempotencyKey(), req.GetFavoriteId())
+	if err != nil {
+		return nil, toStatusError("PayFromFavorite", err)
+	}
+	return toPaymentPB(payment), nil
+}
+
+// ExportAccountHistory возвращает пустой список для счёта без платежей.
+func (s *Server) ExportAccountHistory(_ context.Context, req *walletpb.ExportAccountHistoryRequest) (*walletpb.PaymentList, error) {
+	payments, err := s.svc.ExportAccountHistory(req.GetAccountId())
+	if err == wallet.ErrPaymentNotFound {
+		payments, err = []types.Payment{}, nil
+	}
+	if err != nil {
+		return nil, toStatusError("ExportAccountHistory", err)
+	}
+	return toPaymentListPB(payments), nil
+}
+
+// FilterPayments возвращает подходящие платежи по времени создания.
+func (s *Server) FilterPayments(_ context.Context, req *walletpb.FilterPaymentsRequest) (*walletpb.PaymentList, error) {
+	accounts := map[int64]bool{}
+	for _, accountID := range req.GetAccountIds() {
+		_, err := s.svc.FindAccountByID(accountID)
+		if err != nil {
+			return nil, toStatusError("FilterPayments", err)
+		}
+		accounts[accountID] = true
+	}
+	categories := map[types.PaymentCategory]bool{}
+	for _, category := range req.GetCategories() {
+		categories[types.PaymentCategory(category)] = true
+	}
+	statuses := map[types.PaymentStatus]bool{}
+	for _, paymentStatus := range req.GetStatuses() {
+		statuses[fromStatusPB(paymentStatus)] = true
+	}
+
+	payments, err := s.svc.FilterPaymentsByFn(func(payment types.Payment) bool {
+		return (len(accounts) == 0 || accounts[payment.AccountID]) &&
+			(len(categories) == 0 || categories[payment.Category]) &&
+			(len(statuses) == 0 || statuses[payment.Status])
+	}, filterGoroutines)
+	if err != nil {
+		return nil, toStatusError("FilterPayments", err)
+	}
+	// горутины фильтра возвращают платежи в произвольном порядке
+	sort.Slice(payments, func(i, j int) bool {
+		if !payments[i].CreatedAt.Equal(payments[j].CreatedAt) {
+			return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+		}
+		return payments[i].ID < payments[j].ID
+	})
+	return toPaymentListPB(payments), nil
+}
+
+// SumPaymentsWithProgress пересылает клиенту части суммы по мере подсчёта.
+// Если клиент ушёл раньше, оставшиеся части вычитываются в фоне, чтобы
+// горутины подсчёта не зависли на записи в канал.
+func (s *Server) SumPaymentsWithProgress(_ *walletpb.SumPaymentsWithProgressRequest, stream walletpb.Wallet_SumPaymentsWithProgressServer) error {
+	progress := s.svc.SumPaymentsWithProgress()
+	drain := func() {
+		go func() {
+			for range progress {
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			drain()
+			return status.FromContextError(stream.Context().Err()).Err()
+		case part, ok := <-progress:
+			if !ok {
+				return nil
+			}
+			err := stream.Send(&walletpb.Progress{Part: int32(part.Part), Result: int64(part.Result)})
+			if err != nil {
+				drain()
+				return err
+			}
+		}
+	}
+}
+
+func toAccountPB(account *types.Account) *walletpb.Account {
+	return &walletpb.Account{
+		Id:        account.ID,
+		Phone:     string(account.Phone),
+		Balance:   int64(account.Balance),
+		Currency:  string(account.Currency),
+		CreatedAt: toTimestampPB(account.CreatedAt),
+		UpdatedAt: toTimestampPB(account.UpdatedAt),
+	}
+}
+
+func toPaymentPB(payment *types.Payment) *walletpb.Payment {
+	return &walletpb.Payment{
+		Id:            payment.ID,
+		AccountId:     payment.AccountID,
+		Amount:        int64(payment.Amount),
+		Category:      string(payment.Category),
+		Status:        toStatusPB(payment.Status),
+		CounterpartId: payment.CounterpartID,
+		Currency:      string(payment.Currency),
+		CreatedAt:     toTimestampPB(payment.CreatedAt),
+		UpdatedAt:     toTimestampPB(payment.UpdatedAt),
+	}
+}
+
+func toPaymentListPB(payments []types.Payment) *walletpb.PaymentList {
+	list := &walletpb.PaymentList{Payments: make([]*walletpb.Payment, 0, len(payments))}
+	for i := range payments {
+		list.Payments = append(list.Payments, toPaymentPB(&payments[i]))
+	}
+	return list
+}
+
+func toFavoritePB(favorite *types.Favorite) *walletpb.Favorite {
+	return &walletpb.Favorite{
+		Id:        favorite.ID,
+		AccountId: favorite.AccountID,
+		Name:      favorite.Name,
+		Amount:    int64(favorite.Amount),
+		Category:  string(favorite.Category),
+		Currency:  string(favorite.Currency),
+		CreatedAt: toTimestampPB(favorite.CreatedAt),
+		UpdatedAt: toTimestampPB(favorite.UpdatedAt),
+	}
+}
+
+// toTimestampPB оставляет неизвестное (нулевое) время незаданным.
+func toTimestampPB(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+var paymentStatuses = map[types.PaymentStatus]walletpb.PaymentStatus{
+	types.PaymentStatusInProgress: walletpb.PaymentStatus_PAYMENT_STATUS_IN_PROGRESS,
+	types.PaymentStatusOk:         walletpb.PaymentStatus_PAYMENT_STATUS_OK,
+	types.PaymentStatusFail:       walletpb.PaymentStatus_PAYMENT_STATUS_FAIL,
+	types.PaymentStatusRefunded:   walletpb.PaymentStatus_PAYMENT_STATUS_REFUNDED,
+}
+
+func toStatusPB(status types.PaymentStatus) walletpb.PaymentStatus {
+	return paymentStatuses[status]
+}
+
+// fromStatusPB возвращает "" для PAYMENT_STATUS_UNSPECIFIED и неизвестных
+// значений: такому статусу не подходит ни один платёж.
+func fromStatusPB(status walletpb.PaymentStatus) types.PaymentStatus {
+	for paymentStatus, pb := range paymentStatuses {
+		if pb == status {
+			return paymentStatus
+		}
+	}
+	return ""
+}
@@ -0,0 +1,222 @@
+package grpcserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/FrankS17/wallet/pkg/wallet"
+	"github.com/FrankS17/wallet/pkg/walletpb"
+)
+
+var testTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestClient поднимает сервер в памяти и возвращает клиента к нему.
+func newTestClient(t *testing.T) (walletpb.WalletClient, *wallet.Service) {
+	t.Helper()
+
+	svc := &wallet.Service{}
+	svc.SetClock(wallet.ClockFunc(func() time.Time {
+		return testTime
+	}))
+
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	walletpb.RegisterWalletServer(srv, NewServer(svc))
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return walletpb.NewWalletClient(conn), svc
+}
+
+// reason возвращает ErrorInfo.Reason из ошибки ответа.
+func reason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestServer_walletFlow(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	account, err := client.RegisterAccount(ctx, &walletpb.RegisterAccountRequest{Phone: "+992900000001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Id != 1 || account.Currency != string(wallet.DefaultCurrency) || !account.CreatedAt.AsTime().Equal(testTime) {
+		t.Errorf("RegisterAccount() = %v", account)
+	}
+	if _, err := client.RegisterAccount(ctx, &walletpb.RegisterAccountRequest{Phone: "+992900000002"}); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err = client.Deposit(ctx, &walletpb.DepositRequest{AccountId: 1, Amount: 1000})
+	if err != nil || account.Balance != 1000 {
+		t.Fatalf("Deposit() = %v, %v, want balance 1000", account, err)
+	}
+
+	payment, err := client.Pay(ctx, &walletpb.PayRequest{AccountId: 1, Amount: 300, Category: "auto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Amount != 300 || payment.Status != walletpb.PaymentStatus_PAYMENT_STATUS_IN_PROGRESS {
+		t.Errorf("Pay() = %v", payment)
+	}
+	payment, err = client.Confirm(ctx, &walletpb.ConfirmRequest{PaymentId: payment.Id})
+	if err != nil || payment.Status != walletpb.PaymentStatus_PAYMENT_STATUS_OK {
+		t.Errorf("Confirm() = %v, %v, want OK", payment, err)
+	}
+
+	favorite, err := client.FavoritePayment(ctx, &walletpb.FavoritePaymentRequest{PaymentId: payment.Id, Name: "car"})
+	if err != nil || favorite.Name != "car" || favorite.Amount != 300 {
+		t.Fatalf("FavoritePayment() = %v, %v", favorite, err)
+	}
+	if _, err := client.PayFromFavorite(ctx, &walletpb.PayFromFavoriteRequest{FavoriteId: favorite.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	transfer, err := client.Transfer(ctx, &walletpb.TransferRequest{FromAccountId: 1, ToPhone: "+992900000002", Amount: 100})
+	if err != nil || transfer.CounterpartId == "" {
+		t.Fatalf("Transfer() = %v, %v", transfer, err)
+	}
+
+	account, err = client.GetAccount(ctx, &walletpb.GetAccountRequest{AccountId: 1})
+	if err != nil || account.Balance != 300 {
+		t.Errorf("GetAccount() = %v, %v, want balance 300", account, err)
+	}
+
+	history, err := client.ExportAccountHistory(ctx, &walletpb.ExportAccountHistoryRequest{AccountId: 1})
+	if err != nil || len(history.Payments) != 3 {
+		t.Errorf("ExportAccountHistory() = %v, %v, want 3 payments", history, err)
+	}
+	if _, err := client.RegisterAccount(ctx, &walletpb.RegisterAccountRequest{Phone: "+992900000003"}); err != nil {
+		t.Fatal(err)
+	}
+	history, err = client.ExportAccountHistory(ctx, &walletpb.ExportAccountHistoryRequest{AccountId: 3})
+	if err != nil || len(history.Payments) != 0 {
+		t.Errorf("ExportAccountHistory(3) = %v, %v, want no payments", history, err)
+	}
+
+	filtered, err := client.FilterPayments(ctx, &walletpb.FilterPaymentsRequest{
+		Categories: []string{"auto"},
+		Statuses:   []walletpb.PaymentStatus{walletpb.PaymentStatus_PAYMENT_STATUS_OK},
+	})
+	if err != nil || len(filtered.Payments) != 1 || filtered.Payments[0].Id != payment.Id {
+		t.Errorf("FilterPayments() = %v, %v, want %s", filtered, err, payment.Id)
+	}
+}
+
+func TestServer_errors(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := client.RegisterAccount(ctx, &walletpb.RegisterAccountRequest{Phone: "+992900000001"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		call   func() error
+		code   codes.Code
+		reason string
+	}{
+		{"empty phone", func() error {
+			_, err := client.RegisterAccount(ctx, &walletpb.RegisterAccountRequest{})
+			return err
+		}, codes.InvalidArgument, "INVALID_ARGUMENT"},
+		{"phone registered", func() error {
+			_, err := client.RegisterAccount(ctx, &walletpb.RegisterAccountRequest{Phone: "+992900000001"})
+			return err
+		}, codes.AlreadyExists, "PHONE_REGISTERED"},
+		{"account not found", func() error {
+			_, err := client.GetAccount(ctx, &walletpb.GetAccountRequest{AccountId: 99})
+			return err
+		}, codes.NotFound, "ACCOUNT_NOT_FOUND"},
+		{"payment not found", func() error {
+			_, err := client.GetPayment(ctx, &walletpb.GetPaymentRequest{PaymentId: "none"})
+			return err
+		}, codes.NotFound, "PAYMENT_NOT_FOUND"},
+		{"amount must be positive", func() error {
+			_, err := client.Deposit(ctx, &walletpb.DepositRequest{AccountId: 1, Amount: -1})
+			return err
+		}, codes.InvalidArgument, "AMOUNT_MUST_BE_POSITIVE"},
+		{"not enough balance", func() error {
+			_, err := client.Pay(ctx, &walletpb.PayRequest{AccountId: 1, Amount: 100, Category: "auto"})
+			return err
+		}, codes.FailedPrecondition, "NOT_ENOUGH_BALANCE"},
+		{"empty category", func() error {
+			_, err := client.Pay(ctx, &walletpb.PayRequest{AccountId: 1, Amount: 100})
+			return err
+		}, codes.InvalidArgument, "INVALID_ARGUMENT"},
+	}
+	for _, tt := range tests {
+		err := tt.call()
+		if status.Code(err) != tt.code || reason(err) != tt.reason {
+			t.Errorf("%s: error = %v (reason %q), want %v %s", tt.name, err, reason(err), tt.code, tt.reason)
+		}
+	}
+}
+
+func TestServer_SumPaymentsWithProgress(t *testing.T) {
+	client, svc := newTestClient(t)
+	ctx := context.Background()
+
+	account, err := svc.RegisterAccount("+992900000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 1000); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := svc.Pay(account.ID, 100, "auto"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stream, err := client.SumPaymentsWithProgress(ctx, &walletpb.SumPaymentsWithProgressRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := int64(0)
+	for {
+		progress, err := stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+		total += progress.Result
+	}
+	if total != 500 {
+		t.Errorf("SumPaymentsWithProgress(): total = %d, want 500", total)
+	}
+}
@@ -0,0 +1,71 @@
+package grpcserver
+
+import (
+	"errors"
+	"log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+// errorDomain домен ошибок в errdetails.ErrorInfo.
+const errorDomain = "wallet"
+
+// errInvalidArgument ошибка в самом запросе: пустое обязательное поле и т.п.
+var errInvalidArgument = errors.New("invalid argument")
+
+// statusMapping код ответа и причина (ErrorInfo.Reason) для ошибки сервиса.
+type statusMapping struct {
+	err    error
+	code   codes.Code
+	reason string
+}
+
+// statuses сопоставляет ошибки сервиса кодам gRPC. Проверяются по порядку
+// через errors.Is, поэтому обёрнутые ошибки тоже находятся.
+var statuses = []statusMapping{
+	{errInvalidArgument, codes.InvalidArgument, "INVALID_ARGUMENT"},
+	{wallet.ErrAccountNotFound, codes.NotFound, "ACCOUNT_NOT_FOUND"},
+	{wallet.ErrPaymentNotFound, codes.NotFound, "PAYMENT_NOT_FOUND"},
+	{wallet.ErrFavoriteNotFound, codes.NotFound, "FAVORITE_NOT_FOUND"},
+	{wallet.ErrPhoneRegistered, codes.AlreadyExists, "PHONE_REGISTERED"},
+	{wallet.ErrNotEnoughBalance, codes.FailedPrecondition, "NOT_ENOUGH_BALANCE"},
+	{wallet.ErrInvalidStatusTransition, codes.FailedPrecondition, "INVALID_STATUS_TRANSITION"},
+	{wallet.ErrIdempotencyKeyReused, codes.FailedPrecondition, "IDEMPOTENCY_KEY_REUSED"},
+	{wallet.ErrCurrencyMismatch, codes.FailedPrecondition, "CURRENCY_MISMATCH"},
+	{wallet.ErrRateNotFound, codes.FailedPrecondition, "RATE_NOT_FOUND"},
+	{wallet.ErrSameAccount, codes.FailedPrecondition, "SAME_ACCOUNT"},
+	{wallet.ErrMoneyOverflow, codes.OutOfRange, "MONEY_OVERFLOW"},
+	{wallet.ErrAmountMustBePositive, codes.InvalidArgument, "AMOUNT_MUST_BE_POSITIVE"},
+	{wallet.ErrInvalidCurrency, codes.InvalidArgument, "INVALID_CURRENCY"},
+	{wallet.ErrInvalidIdempotencyKey, codes.InvalidArgument, "INVALID_IDEMPOTENCY_KEY"},
+}
+
+// statusFor переводит ошибку сервиса в статус gRPC с ErrorInfo, по Reason
+// которого клиенты различают ошибки с одинаковым кодом. Неизвестные
+// ошибки становятся codes.Internal без подробностей.
+func statusFor(err error) *status.Status {
+	for _, mapping := range statuses {
+		if errors.Is(err, mapping.err) {
+			st := status.New(mapping.code, err.Error())
+			detailed, detailErr := st.WithDetails(&errdetails.ErrorInfo{Reason: mapping.reason, Domain: errorDomain})
+			if detailErr != nil {
+				return st
+			}
+			return detailed
+		}
+	}
+	return status.New(codes.Internal, "internal error")
+}
+
+// toStatusError возвращает ошибку для ответа обработчика.
+func toStatusError(method string, err error) error {
+	st := statusFor(err)
+	if st.Code() == codes.Internal {
+		log.Print(method, ": ", err)
+	}
+	return st.Err()
+}
@@ -0,0 +1,36 @@
+package grpcserver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+func TestStatusFor(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   codes.Code
+		reason string
+	}{
+		{wallet.ErrAccountNotFound, codes.NotFound, "ACCOUNT_NOT_FOUND"},
+		{fmt.Errorf("line 3: %w", wallet.ErrPhoneRegistered), codes.AlreadyExists, "PHONE_REGISTERED"},
+		{&wallet.StatusTransitionError{PaymentID: "p1", From: "FAIL", To: "REFUNDED"}, codes.FailedPrecondition, "INVALID_STATUS_TRANSITION"},
+		{wallet.ErrMoneyOverflow, codes.OutOfRange, "MONEY_OVERFLOW"},
+	}
+	for _, tt := range tests {
+		st := statusFor(tt.err)
+		if st.Code() != tt.code || st.Message() != tt.err.Error() || reason(st.Err()) != tt.reason {
+			t.Errorf("statusFor(%v) = %v, want %v %s", tt.err, st, tt.code, tt.reason)
+		}
+	}
+
+	// внутренние ошибки не попадают в ответ
+	st := statusFor(errors.New("disk /var/lib/wallet is full"))
+	if st.Code() != codes.Internal || st.Message() != "internal error" || len(st.Details()) != 0 {
+		t.Errorf("statusFor(unknown) = %v, want Internal without details", st)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+// problemContentType тип ответа с ошибкой по RFC 7807.
+const problemContentType = "application/problem+json"
+
+// Problem тело ответа с ошибкой (RFC 7807). Code — короткий машинный код
+// ошибки, по нему клиенты различают ошибки с одинаковым статусом.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+// errBadRequest ошибка в самом запросе: неверный JSON, путь или параметр.
+var errBadRequest = errors.New("bad request")
+
+// problemMapping статус и код ответа для ошибки сервиса.
+type problemMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// problems сопоставляет ошибки сервиса ответам. Проверяются по порядку
+// через errors.Is, поэтому обёрнутые ошибки тоже находятся.
+var problems = []problemMapping{
+	{errBadRequest, http.StatusBadRequest, "bad-request"},
+	{wallet.ErrAccountNotFound, http.StatusNotFound, "account-not-found"},
+	{wallet.ErrPaymentNotFound, http.StatusNotFound, "payment-not-found"},
+	{wallet.ErrFavoriteNotFound, http.StatusNotFound, "favorite-not-found"},
+	{wallet.ErrPhoneRegistered, http.StatusConflict, "phone-registered"},
+	{wallet.ErrInvalidStatusTransition, http.StatusConflict, "invalid-status-transition"},
+	{wallet.ErrIdempotencyKeyReused, http.StatusConflict, "idempotency-key-reused"},
+	{wallet.ErrNotEnoughBalance, http.StatusUnprocessableEntity, "not-enough-balance"},
+	{wallet.ErrCurrencyMismatch, http.StatusUnprocessableEntity, "currency-mismatch"},
+	{wallet.ErrRateNotFound, http.StatusUnprocessableEntity, "rate-not-found"},
+	{wallet.ErrSameAccount, http.StatusUnprocessableEntity, "same-account"},
+	{wallet.ErrMoneyOverflow, http.StatusUnprocessableEntity, "money-overflow"},
+	{wallet.ErrAmountMustBePositive, http.StatusBadRequest, "amount-must-be-positive"},
+	{wallet.ErrInvalidCurrency, http.StatusBadRequest, "invalid-currency"},
+	{wallet.ErrInvalidIdempotencyKey, http.StatusBadRequest, "invalid-idempotency-key"},
+}
+
+// problemFor возвращает ответ для ошибки. Неизвестные ошибки становятся
+// 500 без подробностей, чтобы не показывать клиенту внутреннее устройство.
+func problemFor(err error) Problem {
+	for _, mapping := range problems {
+		if errors.Is(err, mapping.err) {
+			return Problem{
+				Type:   "about:blank",
+				Title:  http.StatusText(mapping.status),
+				Status: mapping.status,
+				Detail: err.Error(),
+				Code:   mapping.code,
+			}
+		}
+	}
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+		Code:   "internal-error",
+	}
+}
+
+// writeError записывает ошибку как problem-JSON.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := problemFor(err)
+	if problem.Status == http.StatusInternalServerError {
+		log.Print(r.Method, " ", r.URL.Path, ": ", err)
+	}
+	problem.Instance = r.URL.Path
+	writeProblem(w, problem)
+}
+
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
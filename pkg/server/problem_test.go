@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{wallet.ErrAccountNotFound, http.StatusNotFound, "account-not-found"},
+		{fmt.Errorf("line 3: %w", wallet.ErrPhoneRegistered), http.StatusConflict, "phone-registered"},
+		{&wallet.StatusTransitionError{PaymentID: "p1", From: "FAIL", To: "REFUNDED"}, http.StatusConflict, "invalid-status-transition"},
+		{wallet.ErrNotEnoughBalance, http.StatusUnprocessableEntity, "not-enough-balance"},
+	}
+	for _, tt := range tests {
+		problem := problemFor(tt.err)
+		if problem.Status != tt.status || problem.Code != tt.code || problem.Detail != tt.err.Error() {
+			t.Errorf("problemFor(%v) = %+v, want %d %s", tt.err, problem, tt.status, tt.code)
+		}
+		if problem.Title != http.StatusText(tt.status) {
+			t.Errorf("problemFor(%v): title = %q", tt.err, problem.Title)
+		}
+	}
+
+	// внутренние ошибки не попадают в ответ
+	problem := problemFor(errors.New("disk /var/lib/wallet is full"))
+	if problem.Status != http.StatusInternalServerError || problem.Detail != "" || problem.Code != "internal-error" {
+		t.Errorf("problemFor(unknown) = %+v, want 500 without detail", problem)
+	}
+}
@@ -0,0 +1,509 @@
+// Package server открывает сервис кошелька по HTTP: JSON-запросы и ответы,
+// ошибки в формате problem-JSON (RFC 7807).
+//
+//	POST /accounts                     регистрация {"phone", "currency"}
+//	GET  /accounts/{id}                счёт
+//	POST /accounts/{id}/deposits       пополнение {"amount"}
+//	POST /accounts/{id}/payments       платёж {"amount", "category"}
+//	GET  /accounts/{id}/payments       история платежей счёта
+//	GET  /payments?account=&category=&status=  платежи по фильтрам
+//	GET  /payments/{id}                платёж
+//	POST /payments/{id}/reject         отмена платежа
+//	POST /payments/{id}/repeat         повтор платежа
+//	POST /payments/{id}/favorites      избранное из платежа {"name"}
+//	GET  /favorites/{id}               избранное
+//	POST /favorites/{id}/payments      платёж по избранному
+//
+// Суммы передаются строками "123.45" (числа тоже принимаются). Пополнение и
+// платежи с заголовком Idempotency-Key выполняются один раз на ключ.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+// maxBodyBytes ограничивает тело запроса: запросам API больше не нужно.
+const maxBodyBytes = 1 << 20
+
+// filterGoroutines сколько горутин FilterPaymentsByFn использует для /payments.
+const filterGoroutines = 4
+
+// idempotencyKeyHeader заголовок с ключом идемпотентности.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Server обрабатывает HTTP-запросы к сервису кошелька.
+type Server struct {
+	svc    *wallet.Service
+	routes []route
+}
+
+// route путь вида "accounts/{}/payments": "{}" совпадает с любым сегментом,
+// такие сегменты передаются обработчику по порядку.
+type route struct {
+	method  string
+	pattern []string
+	handle  func(w http.ResponseWriter, r *http.Request, params []string) error
+}
+
+// NewServer создаёт сервер поверх svc.
+func NewServer(svc *wallet.Service) *Server {
+	s := &Server{svc: svc}
+	s.routes = []route{
+		{http.MethodPost, []string{"accounts"}, s.registerAccount},
+		{http.MethodGet, []string{"accounts", "{}"}, s.account},
+		{http.MethodPost, []string{"accounts", "{}", "deposits"}, s.deposit},
+		{http.MethodPost, []string{"accounts", "{}", "payments"}, s.pay},
+		{http.MethodGet, []string{"accounts", "{}", "payments"}, s.history},
+		{http.MethodGet, []string{"payments"}, s.filterPayments},
+		{http.MethodGet, []string{"payments", "{}"}, s.payment},
+		{http.MethodPost, []string{"payments", "{}", "reject"}, s.reject},
+		{http.MethodPost, []string{"payments", "{}", "repeat"}, s.repeat},
+		{http.MethodPost, []string{"payments", "{}", "favorites"}, s.favoritePayment},
+		{http.MethodGet, []string{"favorites", "{}"}, s.favorite},
+		{http.MethodPost, []string{"favorites", "{}", "payments"}, s.payFromFavorite},
+	}
+	return s
+}
+
+// ServeHTTP выбирает обработчик по методу и пути. Путь без обработчика
+// даёт 404, известный путь с другим методом — 405 с заголовком Allow.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	allowed := []string{}
+	for _, route := range s.routes {
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if route.method != r.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+		err := route.handle(w, r, params)
+		if err != nil {
+			writeError(w, r, err)
+		}
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeProblem(w, Problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(http.StatusMethodNotAllowed),
+			Status:   http.StatusMethodNotAllowed,
+			Detail:   fmt.Sprintf("method %s is not allowed", r.Method),
+			Instance: r.URL.Path,
+			Code:     "method-not-allowed",
+		})
+		return
+	}
+	writeProblem(w, Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(http.StatusNotFound),
+		Status:   http.StatusNotFound,
+		Detail:   fmt.Sprintf("no resource at %s", r.URL.Path),
+		Instance: r.URL.Path,
+		Code:     "not-found",
+	})
+}
+
+func (rt route) match(segments []string) ([]string, bool) {
+	if len(segments) != len(rt.pattern) {
+		return nil, false
+	}
+	params := []string{}
+	for i, part := range rt.pattern {
+		if part == "{}" {
+			params = append(params, segments[i])
+			continue
+		}
+		if segments[i] != part {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+type accountJSON struct {
+	ID        int64          `json:"id"`
+	Phone     types.Phone    `json:"phone"`
+	Balance   types.Decimal  `json:"balance"`
+	Currency  types.Currency `json:"currency"`
+	CreatedAt *time.Time     `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time     `json:"updatedAt,omitempty"`
+}
+
+type paymentJSON struct {
+	ID            string                `json:"id"`
+	AccountID     int64                 `json:"accountID"`
+	Amount        types.Decimal         `json:"amount"`
+	Category      types.PaymentCategory `json:"category"`
+	Status        types.PaymentStatus   `json:"status"`
+	CounterpartID string                `json:"counterpartID,omitempty"`
+	Currency      types.Currency        `json:"currency"`
+	CreatedAt     *time.Time            `json:"createdAt,omitempty"`
+	UpdatedAt     *time.Time            `json:"updatedAt,omitempty"`
+}
+
+type favoriteJSON struct {
+	ID        string                `json:"id"`
+	AccountID int64                 `json:"accountID"`
+	Name      string                `json:"name"`
+	Amount    types.Decimal         `json:"amount"`
+	Category  types.PaymentCategory `json:"category"`
+	Currency  types.Currency        `json:"currency"`
+	CreatedAt *time.Time            `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time            `json:"updatedAt,omitempty"`
+}
+
+func toAccountJSON(account *types.Account) accountJSON {
+	return accountJSON{
+		ID:        account.ID,
+		Phone:     account.Phone,
+		Balance:   types.DecimalIn(account.Balance, account.Currency),
+		Currency:  account.Currency,
+		CreatedAt: optionalTime(account.CreatedAt),
+		UpdatedAt: optionalTime(account.UpdatedAt),
+	}
+}
+
+func toPaymentJSON(payment *types.Payment) paymentJSON {
+	return paymentJSON{
+		ID:            payment.ID,
+		AccountID:     payment.AccountID,
+		Amount:        types.DecimalIn(payment.Amount, payment.Currency),
+		Category:      payment.Category,
+		Status:        payment.Status,
+		CounterpartID: payment.CounterpartID,
+		Currency:      payment.Currency,
+		CreatedAt:     optionalTime(payment.CreatedAt),
+		UpdatedAt:     optionalTime(payment.UpdatedAt),
+	}
+}
+
+func toPaymentsJSON(payments []types.Payment) []paymentJSON {
+	items := make([]paymentJSON, 0, len(payments))
+	for i := range payments {
+		items = append(items, toPaymentJSON(&payments[i]))
+	}
+	return items
+}
+
+func toFavoriteJSON(favorite *types.Favorite) favoriteJSON {
+	return favoriteJSON{
+		ID:        favorite.ID,
+		AccountID: favorite.AccountID,
+		Name:      favorite.Name,
+		Amount:    types.DecimalIn(favorite.Amount, favorite.Currency),
+		Category:  favorite.Category,
+		Currency:  favorite.Currency,
+		CreatedAt: optionalTime(favorite.CreatedAt),
+		UpdatedAt: optionalTime(favorite.UpdatedAt),
+	}
+}
+
+// optionalTime опускает неизвестное (нулевое) время в ответе.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+type registerRequest struct {
+	Phone    types.Phone    `json:"phone"`
+	Currency types.Currency `json:"currency"`
+}
+
+type depositRequest struct {
+	Amount types.Decimal `json:"amount"`
+}
+
+type payRequest struct {
+	Amount   types.Decimal         `json:"amount"`
+	Category types.PaymentCategory `json:"category"`
+}
+
+type favoriteRequest struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) registerAccount(w http.ResponseWriter, r *http.Request, _ []string) error {
+	var req registerRequest
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		return err
+	}
+	if req.Phone == "" {
+		return fmt.Errorf("%w: phone is required", errBadRequest)
+	}
+
+	var account *types.Account
+	if req.Currency == "" {
+		account, err = s.svc.RegisterAccount(req.Phone)
+	} else {
+		account, err = s.svc.RegisterAccountWithCurrency(req.Phone, req.Currency)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/accounts/"+strconv.FormatInt(account.ID, 10))
+	return writeJSON(w, http.StatusCreated, toAccountJSON(account))
+}
+
+func (s *Server) account(w http.ResponseWriter, r *http.Request, params []string) error {
+	accountID, err := parseAccountID(params[0])
+	if err != nil {
+		return err
+	}
+	account, err := s.svc.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, toAccountJSON(account))
+}
+
+// deposit отвечает счётом с новым балансом.
+func (s *Server) deposit(w http.ResponseWriter, r *http.Request, params []string) error {
+	accountID, err := parseAccountID(params[0])
+	if err != nil {
+		return err
+	}
+	var req depositRequest
+	err = decodeJSON(w, r, &req)
+	if err != nil {
+		return err
+	}
+
+	amount, err := s.amountIn(accountID, req.Amount)
+	if err != nil {
+		return err
+	}
+
+	err = s.svc.DepositWithKey(r.Header.Get(idempotencyKeyHeader), accountID, amount)
+	if err != nil {
+		return err
+	}
+	account, err := s.svc.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, toAccountJSON(account))
+}
+
+func (s *Server) pay(w http.ResponseWriter, r *http.Request, params []string) error {
+	accountID, err := parseAccountID(params[0])
+	if err != nil {
+		return err
+	}
+	var req payRequest
+	err = decodeJSON(w, r, &req)
+	if err != nil {
+		return err
+	}
+	if req.Category == "" {
+		return fmt.Errorf("%w: category is required", errBadRequest)
+	}
+
+	amount, err := s.amountIn(accountID, req.Amount)
+	if err != nil {
+		return err
+	}
+
+	payment, err := s.svc.PayWithKey(r.Header.Get(idempotencyKeyHeader), accountID, amount, req.Category)
+	if err != nil {
+		return err
+	}
+	return writeCreatedPayment(w, payment)
+}
+
+// amountIn разбирает сумму запроса в валюте счёта: число знаков после
+// запятой у валют разное.
+func (s *Server) amountIn(accountID int64, amount types.Decimal) (types.Money, error) {
+	account, err := s.svc.FindAccountByID(accountID)
+	if err != nil {
+		return 0, err
+	}
+	money, err := amount.MoneyIn(account.Currency)
+	if err != nil {
+		return 0, fmt.Errorf("%w: amount: %v", errBadRequest, err)
+	}
+	return money, nil
+}
+
+// history отвечает пустым списком для счёта без платежей.
+func (s *Server) history(w http.ResponseWriter, r *http.Request, params []string) error {
+	accountID, err := parseAccountID(params[0])
+	if err != nil {
+		return err
+	}
+	payments, err := s.svc.ExportAccountHistory(accountID)
+	if err == wallet.ErrPaymentNotFound {
+		payments, err = []types.Payment{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, toPaymentsJSON(payments))
+}
+
+// filterPayments отбирает платежи по необязательным параметрам account,
+// category и status (параметр можно повторить — тогда подходит любое
+// значение) и возвращает их по времени создания.
+func (s *Server) filterPayments(w http.ResponseWriter, r *http.Request, _ []string) error {
+	query := r.URL.Query()
+
+	accounts := map[int64]bool{}
+	for _, value := range query["account"] {
+		accountID, err := parseAccountID(value)
+		if err != nil {
+			return err
+		}
+		_, err = s.svc.FindAccountByID(accountID)
+		if err != nil {
+			return err
+		}
+		accounts[accountID] = true
+	}
+	categories := map[types.PaymentCategory]bool{}
+	for _, value := range query["category"] {
+		categories[types.PaymentCategory(value)] = true
+	}
+	statuses := map[types.PaymentStatus]bool{}
+	for _, value := range query["status"] {
+		statuses[types.PaymentStatus(value)] = true
+	}
+
+	payments, err := s.svc.FilterPaymentsByFn(func(payment types.Payment) bool {
+		return (len(accounts) == 0 || accounts[payment.AccountID]) &&
+			(len(categories) == 0 || categories[payment.Category]) &&
+			(len(statuses) == 0 || statuses[payment.Status])
+	}, filterGoroutines)
+	if err != nil {
+		return err
+	}
+	// горутины фильтра возвращают платежи в произвольном порядке
+	sort.Slice(payments, func(i, j int) bool {
+		if !payments[i].CreatedAt.Equal(payments[j].CreatedAt) {
+			return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+		}
+		return payments[i].ID < payments[j].ID
+	})
+	return writeJSON(w, http.StatusOK, toPaymentsJSON(payments))
+}
+
+func (s *Server) payment(w http.ResponseWriter, r *http.Request, params []string) error {
+	payment, err := s.svc.FindPaymentByID(params[0])
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, toPaymentJSON(payment))
+}
+
+// reject отвечает платежом с новым статусом.
+func (s *Server) reject(w http.ResponseWriter, r *http.Request, params []string) error {
+	err := s.svc.Reject(params[0])
+	if err != nil {
+		return err
+	}
+	payment, err := s.svc.FindPaymentByID(params[0])
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, toPaymentJSON(payment))
+}
+
+func (s *Server) repeat(w http.ResponseWriter, r *http.Request, params []string) error {
+	payment, err := s.svc.Repeat(params[0])
+	if err != nil {
+		return err
+	}
+	return writeCreatedPayment(w, payment)
+}
+
+func (s *Server) favoritePayment(w http.ResponseWriter, r *http.Request, params []string) error {
+	var req favoriteRequest
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		return err
+	}
+	favorite, err := s.svc.FavoritePayment(params[0], req.Name)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/favorites/"+favorite.ID)
+	return writeJSON(w, http.StatusCreated, toFavoriteJSON(favorite))
+}
+
+func (s *Server) favorite(w http.ResponseWriter, r *http.Request, params []string) error {
+	favorite, err := s.svc.FindFavoriteByID(params[0])
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, toFavoriteJSON(favorite))
+}
+
+func (s *Server) payFromFavorite(w http.ResponseWriter, r *http.Request, params []string) error {
+	payment, err := s.svc.PayFromFavoriteWithKey(r.Header.Get(idempotencyKeyHeader), params[0])
+	if err != nil {
+		return err
+	}
+	return writeCreatedPayment(w, payment)
+}
+
+func writeCreatedPayment(w http.ResponseWriter, payment *types.Payment) error {
+	w.Header().Set("Location", "/payments/"+payment.ID)
+	return writeJSON(w, http.StatusCreated, toPaymentJSON(payment))
+}
+
+func parseAccountID(value string) (int64, error) {
+	accountID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || accountID <= 0 {
+		return 0, fmt.Errorf("%w: %q is not an account id", errBadRequest, value)
+	}
+	return accountID, nil
+}
+
+// decodeJSON читает тело запроса в v. Неизвестные поля, лишние данные
+// после объекта и слишком большое тело считаются ошибкой запроса.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == io.EOF {
+		return fmt.Errorf("%w: empty body", errBadRequest)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: data after JSON object", errBadRequest)
+	}
+	return nil
+}
+
+// writeJSON кодирует ответ до записи заголовков, поэтому при ошибке
+// кодирования клиент ещё может получить problem-JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(body, '\n'))
+	return nil
+}
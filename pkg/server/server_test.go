@@ -0,0 +1,264 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/wallet"
+)
+
+type testServer struct {
+	t      *testing.T
+	svc    *wallet.Service
+	server *Server
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	svc := &wallet.Service{}
+	svc.SetClock(wallet.ClockFunc(func() time.Time {
+		return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	}))
+	return &testServer{t: t, svc: svc, server: NewServer(svc)}
+}
+
+// do выполняет запрос и раскладывает JSON-ответ в out, если он не nil.
+func (ts *testServer) do(method, path, body string, header http.Header, out interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	ts.server.ServeHTTP(rec, req)
+
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			ts.t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+func (ts *testServer) expect(method, path, body string, status int, out interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+
+	rec := ts.do(method, path, body, nil, out)
+	if rec.Code != status {
+		ts.t.Fatalf("%s %s: status = %d, want %d: %s", method, path, rec.Code, status, rec.Body.String())
+	}
+	return rec
+}
+
+func TestServer_walletFlow(t *testing.T) {
+	ts := newTestServer(t)
+
+	var account accountJSON
+	rec := ts.expect(http.MethodPost, "/accounts", `{"phone": "+992900000001"}`, http.StatusCreated, &account)
+	if account.ID != 1 || account.Balance != "0.00" || account.Currency != wallet.DefaultCurrency || account.CreatedAt == nil {
+		t.Errorf("POST /accounts = %+v", account)
+	}
+	if location := rec.Header().Get("Location"); location != "/accounts/1" {
+		t.Errorf("POST /accounts: Location = %q, want /accounts/1", location)
+	}
+
+	ts.expect(http.MethodPost, "/accounts/1/deposits", `{"amount": "10.00"}`, http.StatusOK, &account)
+	if account.Balance != "10.00" {
+		t.Errorf("POST /accounts/1/deposits: balance = %v, want 10.00", account.Balance)
+	}
+
+	var payment paymentJSON
+	ts.expect(http.MethodPost, "/accounts/1/payments", `{"amount": 2.5, "category": "auto"}`, http.StatusCreated, &payment)
+	if payment.AccountID != 1 || payment.Amount != "2.50" || payment.Status != "INPROGRESS" {
+		t.Errorf("POST /accounts/1/payments = %+v", payment)
+	}
+
+	var history []paymentJSON
+	ts.expect(http.MethodGet, "/accounts/1/payments", "", http.StatusOK, &history)
+	if len(history) != 1 || history[0].ID != payment.ID {
+		t.Errorf("GET /accounts/1/payments = %+v, want the payment", history)
+	}
+
+	var rejected paymentJSON
+	ts.expect(http.MethodPost, "/payments/"+payment.ID+"/reject", "", http.StatusOK, &rejected)
+	if rejected.Status != "FAIL" {
+		t.Errorf("POST /payments/{id}/reject: status = %s, want FAIL", rejected.Status)
+	}
+
+	var repeated paymentJSON
+	ts.expect(http.MethodPost, "/payments/"+payment.ID+"/repeat", "", http.StatusCreated, &repeated)
+	if repeated.ID == payment.ID || repeated.Amount != payment.Amount {
+		t.Errorf("POST /payments/{id}/repeat = %+v", repeated)
+	}
+
+	var favorite favoriteJSON
+	ts.expect(http.MethodPost, "/payments/"+payment.ID+"/favorites", `{"name": "car"}`, http.StatusCreated, &favorite)
+	if favorite.Name != "car" || favorite.Amount != "2.50" {
+		t.Errorf("POST /payments/{id}/favorites = %+v", favorite)
+	}
+	ts.expect(http.MethodGet, "/favorites/"+favorite.ID, "", http.StatusOK, &favorite)
+
+	var fromFavorite paymentJSON
+	ts.expect(http.MethodPost, "/favorites/"+favorite.ID+"/payments", "", http.StatusCreated, &fromFavorite)
+	ts.expect(http.MethodGet, "/payments/"+fromFavorite.ID, "", http.StatusOK, &payment)
+	if payment.Category != "auto" {
+		t.Errorf("GET /payments/{id} = %+v", payment)
+	}
+
+	ts.expect(http.MethodGet, "/accounts/1", "", http.StatusOK, &account)
+	if account.Balance != "5.00" {
+		t.Errorf("GET /accounts/1: balance = %v, want 5.00", account.Balance)
+	}
+}
+
+func TestServer_filterPayments(t *testing.T) {
+	ts := newTestServer(t)
+	ts.expect(http.MethodPost, "/accounts", `{"phone": "+992900000001"}`, http.StatusCreated, nil)
+	ts.expect(http.MethodPost, "/accounts", `{"phone": "+992900000002"}`, http.StatusCreated, nil)
+	for _, id := range []string{"1", "2"} {
+		ts.expect(http.MethodPost, "/accounts/"+id+"/deposits", `{"amount": "100"}`, http.StatusOK, nil)
+		ts.expect(http.MethodPost, "/accounts/"+id+"/payments", `{"amount": "1", "category": "auto"}`, http.StatusCreated, nil)
+		ts.expect(http.MethodPost, "/accounts/"+id+"/payments", `{"amount": "2", "category": "food"}`, http.StatusCreated, nil)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", 4},
+		{"?account=1", 2},
+		{"?category=auto", 2},
+		{"?account=2&category=food", 1},
+		{"?category=auto&category=food&status=INPROGRESS", 4},
+		{"?status=Ok", 0},
+	}
+	for _, tt := range tests {
+		var payments []paymentJSON
+		ts.expect(http.MethodGet, "/payments"+tt.query, "", http.StatusOK, &payments)
+		if len(payments) != tt.want {
+			t.Errorf("GET /payments%s: %d payments, want %d", tt.query, len(payments), tt.want)
+		}
+	}
+
+	ts.expect(http.MethodGet, "/payments?account=9", "", http.StatusNotFound, nil)
+	var empty []paymentJSON
+	ts.expect(http.MethodPost, "/accounts", `{"phone": "+992900000003"}`, http.StatusCreated, nil)
+	ts.expect(http.MethodGet, "/accounts/3/payments", "", http.StatusOK, &empty)
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("GET /accounts/3/payments = %v, want []", empty)
+	}
+}
+
+func TestServer_errors(t *testing.T) {
+	ts := newTestServer(t)
+	ts.expect(http.MethodPost, "/accounts", `{"phone": "+992900000001"}`, http.StatusCreated, nil)
+	ts.expect(http.MethodPost, "/accounts/1/deposits", `{"amount": "1"}`, http.StatusOK, nil)
+	var payment paymentJSON
+	ts.expect(http.MethodPost, "/accounts/1/payments", `{"amount": "1", "category": "auto"}`, http.StatusCreated, &payment)
+	ts.expect(http.MethodPost, "/payments/"+payment.ID+"/reject", "", http.StatusOK, nil)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{http.MethodPost, "/accounts", `{"phone": "+992900000001"}`, http.StatusConflict, "phone-registered"},
+		{http.MethodPost, "/accounts", `{"phone": "+992900000002", "currency": "usd"}`, http.StatusBadRequest, "invalid-currency"},
+		{http.MethodPost, "/accounts", `{}`, http.StatusBadRequest, "bad-request"},
+		{http.MethodPost, "/accounts", `{"phone": "+992900000002", "extra": 1}`, http.StatusBadRequest, "bad-request"},
+		{http.MethodPost, "/accounts", `{"phone": `, http.StatusBadRequest, "bad-request"},
+		{http.MethodPost, "/accounts", ``, http.StatusBadRequest, "bad-request"},
+		{http.MethodGet, "/accounts/9", "", http.StatusNotFound, "account-not-found"},
+		{http.MethodGet, "/accounts/x", "", http.StatusBadRequest, "bad-request"},
+		{http.MethodPost, "/accounts/1/deposits", `{"amount": "0"}`, http.StatusBadRequest, "amount-must-be-positive"},
+		{http.MethodPost, "/accounts/1/deposits", `{"amount": "1.234"}`, http.StatusBadRequest, "bad-request"},
+		{http.MethodPost, "/accounts/1/payments", `{"amount": "5", "category": "auto"}`, http.StatusUnprocessableEntity, "not-enough-balance"},
+		{http.MethodPost, "/accounts/1/payments", `{"amount": "5"}`, http.StatusBadRequest, "bad-request"},
+		{http.MethodPost, "/payments/" + payment.ID + "/reject", "", http.StatusConflict, "invalid-status-transition"},
+		{http.MethodGet, "/payments/none", "", http.StatusNotFound, "payment-not-found"},
+		{http.MethodPost, "/payments/none/repeat", "", http.StatusNotFound, "payment-not-found"},
+		{http.MethodPost, "/favorites/none/payments", "", http.StatusNotFound, "favorite-not-found"},
+		{http.MethodDelete, "/accounts/1", "", http.StatusMethodNotAllowed, "method-not-allowed"},
+		{http.MethodGet, "/ledger", "", http.StatusNotFound, "not-found"},
+	}
+	for _, tt := range tests {
+		var problem Problem
+		rec := ts.do(tt.method, tt.path, tt.body, nil, &problem)
+		if rec.Code != tt.status || problem.Status != tt.status || problem.Code != tt.code {
+			t.Errorf("%s %s: %d %+v, want %d %s", tt.method, tt.path, rec.Code, problem, tt.status, tt.code)
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != problemContentType {
+			t.Errorf("%s %s: Content-Type = %q, want %q", tt.method, tt.path, contentType, problemContentType)
+		}
+		if problem.Instance != tt.path {
+			t.Errorf("%s %s: instance = %q", tt.method, tt.path, problem.Instance)
+		}
+	}
+
+	rec := ts.do(http.MethodPut, "/accounts/1/payments", "", nil, nil)
+	if allow := rec.Header().Get("Allow"); allow != "POST, GET" {
+		t.Errorf("PUT /accounts/1/payments: Allow = %q, want \"POST, GET\"", allow)
+	}
+}
+
+func TestServer_idempotencyKey(t *testing.T) {
+	ts := newTestServer(t)
+	ts.expect(http.MethodPost, "/accounts", `{"phone": "+992900000001"}`, http.StatusCreated, nil)
+
+	key := http.Header{idempotencyKeyHeader: {"deposit-1"}}
+	for i := 0; i < 2; i++ {
+		if rec := ts.do(http.MethodPost, "/accounts/1/deposits", `{"amount": "10"}`, key, nil); rec.Code != http.StatusOK {
+			t.Fatalf("POST /accounts/1/deposits: status = %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	key = http.Header{idempotencyKeyHeader: {"pay-1"}}
+	var first, second paymentJSON
+	ts.do(http.MethodPost, "/accounts/1/payments", `{"amount": "3", "category": "auto"}`, key, &first)
+	ts.do(http.MethodPost, "/accounts/1/payments", `{"amount": "3", "category": "auto"}`, key, &second)
+	if first.ID == "" || first.ID != second.ID {
+		t.Errorf("repeated POST with %s: payments %q and %q, want the same", idempotencyKeyHeader, first.ID, second.ID)
+	}
+
+	var account accountJSON
+	ts.expect(http.MethodGet, "/accounts/1", "", http.StatusOK, &account)
+	if account.Balance != "7.00" {
+		t.Errorf("GET /accounts/1: balance = %v, want 7.00", account.Balance)
+	}
+
+	var problem Problem
+	rec := ts.do(http.MethodPost, "/accounts/1/payments", `{"amount": "4", "category": "auto"}`, key, &problem)
+	if rec.Code != http.StatusConflict || problem.Code != "idempotency-key-reused" {
+		t.Errorf("POST with a reused key: %d %+v, want 409 idempotency-key-reused", rec.Code, problem)
+	}
+}
+
+func TestServer_amountsInAccountCurrency(t *testing.T) {
+	ts := newTestServer(t)
+
+	var account accountJSON
+	ts.expect(http.MethodPost, "/accounts", `{"phone": "+992900000001", "currency": "JPY"}`, http.StatusCreated, &account)
+	ts.expect(http.MethodPost, "/accounts/1/deposits", `{"amount": "500"}`, http.StatusOK, &account)
+	if account.Balance != "500" {
+		t.Errorf("POST /accounts/1/deposits: balance = %v, want 500", account.Balance)
+	}
+
+	var payment paymentJSON
+	ts.expect(http.MethodPost, "/accounts/1/payments", `{"amount": 120, "category": "auto"}`, http.StatusCreated, &payment)
+	if payment.Amount != "120" || payment.Currency != "JPY" {
+		t.Errorf("POST /accounts/1/payments = %+v", payment)
+	}
+
+	var problem Problem
+	if rec := ts.do(http.MethodPost, "/accounts/1/deposits", `{"amount": "1.50"}`, nil, &problem); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /accounts/1/deposits: fractional yen: %d %+v, want 400", rec.Code, problem)
+	}
+}
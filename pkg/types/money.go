@@ -0,0 +1,216 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrMoneyOverflow возвращается, если сумма не помещается в Money
+var ErrMoneyOverflow = errors.New("money overflow")
+
+// ErrInvalidMoney возвращается, если строку не удалось разобрать как сумму
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// defaultExponent число знаков после запятой для Money без валюты
+// и для валют, которых нет в currencyExponents
+const defaultExponent = 2
+
+// currencyExponents сколько минимальных единиц в основной: 10^exponent
+var currencyExponents = map[Currency]int{
+	CurrencyTJS: 2,
+	CurrencyRUB: 2,
+	CurrencyUSD: 2,
+	"EUR":       2,
+	"JPY":       0,
+	"KRW":       0,
+	"KWD":       3,
+	"BHD":       3,
+}
+
+// Exponent возвращает число знаков после запятой у валюты: 2 для сомони
+// (дирамы), рублей (копейки) и долларов (центы)
+func (c Currency) Exponent() int {
+	if exponent, ok := currencyExponents[c]; ok {
+		return exponent
+	}
+	return defaultExponent
+}
+
+// String возвращает сумму в основных единицах с двумя знаками после
+// запятой: Money(12345) -> "123.45"
+func (m Money) String() string {
+	return formatMinor(m, defaultExponent)
+}
+
+// FormatMoney возвращает сумму в основных единицах с числом знаков после
+// запятой, принятым для валюты
+func FormatMoney(m Money, currency Currency) string {
+	return formatMinor(m, currency.Exponent())
+}
+
+// ParseMoney разбирает сумму вида "123.45", "-0.5" или "100" с не более
+// чем двумя знаками после запятой. Лишние знаки не округляются, а считаются ошибкой
+func ParseMoney(s string) (Money, error) {
+	return parseMinor(s, defaultExponent)
+}
+
+// ParseMoneyIn как ParseMoney, но с числом знаков после запятой, принятым для валюты
+func ParseMoneyIn(s string, currency Currency) (Money, error) {
+	return parseMinor(s, currency.Exponent())
+}
+
+// Add возвращает m + other или ErrMoneyOverflow
+func (m Money) Add(other Money) (Money, error) {
+	sum := m + other
+	if (other > 0 && sum < m) || (other < 0 && sum > m) {
+		return 0, ErrMoneyOverflow
+	}
+	return sum, nil
+}
+
+// Sub возвращает m - other или ErrMoneyOverflow
+func (m Money) Sub(other Money) (Money, error) {
+	diff := m - other
+	if (other > 0 && diff > m) || (other < 0 && diff < m) {
+		return 0, ErrMoneyOverflow
+	}
+	return diff, nil
+}
+
+// MarshalText записывает сумму как String, поэтому в JSON Money
+// становится строкой "123.45" и не теряет точности во float. Число знаков
+// здесь не зависит от валюты: суммы в валюте записываются через Decimal
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := ParseMoney(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalJSON принимает и строку "123.45", и число 123.45.
+// Число разбирается как десятичная запись, без перехода через float64
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return err
+		}
+	}
+	return m.UnmarshalText([]byte(text))
+}
+
+// Decimal сумма в основных единицах в том виде, в каком она записана в JSON:
+// "123.45", "-0.5" или "100". Число знаков после запятой зависит от валюты,
+// поэтому в Money Decimal переводится только вместе с ней
+type Decimal string
+
+// DecimalIn записывает сумму с числом знаков после запятой, принятым для валюты
+func DecimalIn(m Money, currency Currency) Decimal {
+	return Decimal(FormatMoney(m, currency))
+}
+
+// MoneyIn разбирает сумму в валюте currency, см. ParseMoneyIn
+func (d Decimal) MoneyIn(currency Currency) (Money, error) {
+	return ParseMoneyIn(string(d), currency)
+}
+
+// UnmarshalJSON принимает и строку "123.45", и число 123.45.
+// Число сохраняется десятичной записью, без перехода через float64
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return err
+		}
+	}
+	*d = Decimal(text)
+	return nil
+}
+
+func formatMinor(m Money, exponent int) string {
+	sign := ""
+	abs := uint64(m)
+	if m < 0 {
+		sign = "-"
+		abs = uint64(-(m + 1)) + 1 // без переполнения для math.MinInt64
+	}
+
+	digits := strconv.FormatUint(abs, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	point := len(digits) - exponent
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func parseMinor(s string, exponent int) (Money, error) {
+	text := s
+	negative := strings.HasPrefix(text, "-")
+	if negative {
+		text = text[1:]
+	}
+
+	whole, fraction, hasPoint := text, "", false
+	if point := strings.Index(text, "."); point >= 0 {
+		whole, fraction, hasPoint = text[:point], text[point+1:], true
+	}
+	if !isDigits(whole) || (hasPoint && !isDigits(fraction)) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	if len(fraction) > exponent {
+		return 0, fmt.Errorf("%w: %q: more than %d decimal places", ErrInvalidMoney, s, exponent)
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	abs := uint64(0)
+	if digits := strings.TrimLeft(whole+fraction, "0"); digits != "" {
+		var err error
+		abs, err = strconv.ParseUint(digits, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrMoneyOverflow, s)
+		}
+	}
+
+	switch {
+	case negative && abs == uint64(math.MaxInt64)+1:
+		return math.MinInt64, nil
+	case abs > math.MaxInt64:
+		return 0, fmt.Errorf("%w: %q", ErrMoneyOverflow, s)
+	case negative:
+		return -Money(abs), nil
+	}
+	return Money(abs), nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoney_String(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{12345, "123.45"},
+		{-5, "-0.05"},
+		{-12345, "-123.45"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.money), got, tt.want)
+		}
+	}
+}
+
+func TestFormatMoney_exponent(t *testing.T) {
+	if got := FormatMoney(1500, "JPY"); got != "1500" {
+		t.Errorf("FormatMoney(JPY) = %q", got)
+	}
+	if got := FormatMoney(1500, "KWD"); got != "1.500" {
+		t.Errorf("FormatMoney(KWD) = %q", got)
+	}
+	if got := FormatMoney(1500, "XXX"); got != "15.00" {
+		t.Errorf("FormatMoney(unknown) = %q", got)
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		text string
+		want Money
+	}{
+		{"0", 0},
+		{"100", 10000},
+		{"123.45", 12345},
+		{"123.4", 12340},
+		{"-0.5", -50},
+		{"007.01", 701},
+		{"92233720368547758.07", math.MaxInt64},
+		{"-92233720368547758.08", math.MinInt64},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.text)
+		if err != nil {
+			t.Errorf("ParseMoney(%q): error = %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.text, int64(got), int64(tt.want))
+		}
+		if back, _ := ParseMoney(got.String()); back != got {
+			t.Errorf("ParseMoney(%q): does not round-trip through String", tt.text)
+		}
+	}
+
+	for _, text := range []string{"", "-", "1.", ".5", "1.234", "1,5", "+1", "1e3", " 1"} {
+		if _, err := ParseMoney(text); !errors.Is(err, ErrInvalidMoney) {
+			t.Errorf("ParseMoney(%q): must return ErrInvalidMoney, returned = %v", text, err)
+		}
+	}
+	for _, text := range []string{"92233720368547758.08", "-92233720368547758.09", "99999999999999999999999"} {
+		if _, err := ParseMoney(text); !errors.Is(err, ErrMoneyOverflow) {
+			t.Errorf("ParseMoney(%q): must return ErrMoneyOverflow, returned = %v", text, err)
+		}
+	}
+
+	if got, _ := ParseMoneyIn("1500", "JPY"); got != 1500 {
+		t.Errorf("ParseMoneyIn(JPY) = %d", int64(got))
+	}
+	if _, err := ParseMoneyIn("1.5", "JPY"); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("ParseMoneyIn(JPY): must return ErrInvalidMoney, returned = %v", err)
+	}
+}
+
+func TestMoney_AddSub(t *testing.T) {
+	if sum, err := Money(100).Add(-300); err != nil || sum != -200 {
+		t.Errorf("Add() = %d, %v", int64(sum), err)
+	}
+	if _, err := Money(math.MaxInt64).Add(1); err != ErrMoneyOverflow {
+		t.Errorf("Add(): must return ErrMoneyOverflow, returned = %v", err)
+	}
+	if _, err := Money(math.MinInt64).Add(-1); err != ErrMoneyOverflow {
+		t.Errorf("Add(): must return ErrMoneyOverflow, returned = %v", err)
+	}
+	if diff, err := Money(100).Sub(300); err != nil || diff != -200 {
+		t.Errorf("Sub() = %d, %v", int64(diff), err)
+	}
+	if _, err := Money(math.MinInt64).Sub(1); err != ErrMoneyOverflow {
+		t.Errorf("Sub(): must return ErrMoneyOverflow, returned = %v", err)
+	}
+	if _, err := Money(0).Sub(math.MinInt64); err != ErrMoneyOverflow {
+		t.Errorf("Sub(): must return ErrMoneyOverflow, returned = %v", err)
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	account := Account{ID: 1, Phone: "+992900000001", Balance: 12345, Currency: CurrencyTJS}
+	data, err := json.Marshal(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ID":1,"Phone":"+992900000001","Balance":"123.45","Currency":"TJS",` +
+		`"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z"}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+
+	var decoded Account
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != account {
+		t.Errorf("json.Unmarshal() = %v, error = %v", decoded, err)
+	}
+
+	var money Money
+	if err := json.Unmarshal([]byte(`123.45`), &money); err != nil || money != 12345 {
+		t.Errorf("json.Unmarshal(number) = %d, error = %v", int64(money), err)
+	}
+	if err := json.Unmarshal([]byte(`"12.345"`), &money); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("json.Unmarshal(): must return ErrInvalidMoney, returned = %v", err)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		money    Money
+		currency Currency
+		want     Decimal
+	}{
+		{12345, CurrencyTJS, "123.45"},
+		{12345, "JPY", "12345"},
+		{12345, "KWD", "12.345"},
+		{-5, "KWD", "-0.005"},
+	}
+	for _, test := range tests {
+		decimal := DecimalIn(test.money, test.currency)
+		if decimal != test.want {
+			t.Errorf("DecimalIn(%d, %s) = %q, want %q", int64(test.money), test.currency, decimal, test.want)
+		}
+		money, err := decimal.MoneyIn(test.currency)
+		if err != nil || money != test.money {
+			t.Errorf("%q.MoneyIn(%s) = %d, %v, want %d", decimal, test.currency, int64(money), err, int64(test.money))
+		}
+	}
+
+	var decoded struct{ Amount Decimal }
+	if err := json.Unmarshal([]byte(`{"Amount":1.005}`), &decoded); err != nil || decoded.Amount != "1.005" {
+		t.Errorf("json.Unmarshal(number) = %q, error = %v", decoded.Amount, err)
+	}
+	if _, err := decoded.Amount.MoneyIn(CurrencyTJS); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("MoneyIn(): must return ErrInvalidMoney, returned = %v", err)
+	}
+	if money, err := decoded.Amount.MoneyIn("KWD"); err != nil || money != 1005 {
+		t.Errorf("MoneyIn(KWD) = %d, %v, want 1005", int64(money), err)
+	}
+}
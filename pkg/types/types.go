@@ -1,9 +1,20 @@
 package types
 
+import "time"
+
 
 // Представляет собой денежную сумму в минимальных единицах (копейки и т.д.)
 type Money int64
 
+// Currency трёхбуквенный код валюты ISO 4217
+type Currency string
+
+const (
+	CurrencyTJS Currency = "TJS"
+	CurrencyRUB Currency = "RUB"
+	CurrencyUSD Currency = "USD"
+)
+
 
 // Category представляет собой категорию, в которой был совершен платеж
 type PaymentCategory string
@@ -14,6 +25,23 @@ const (
 	PaymentStatusOk PaymentStatus = "Ok"
 	PaymentStatusFail PaymentStatus = "FAIL"
 	PaymentStatusInProgress PaymentStatus = "INPROGRESS"
+	PaymentStatusRefunded PaymentStatus = "REFUNDED"
+)
+
+// PaymentStatusChange запись в истории статусов платежа,
+// у записи о создании платежа From пустой
+type PaymentStatusChange struct {
+	PaymentID string
+	From      PaymentStatus
+	To        PaymentStatus
+	At        time.Time
+}
+
+// Категории платежей перевода между кошельками: списание у отправителя и
+// зачисление у получателя
+const (
+	PaymentCategoryTransferOut PaymentCategory = "transfer-out"
+	PaymentCategoryTransferIn  PaymentCategory = "transfer-in"
 )
 
 type Payment struct {
@@ -22,6 +50,10 @@ type Payment struct {
 	Amount Money
 	Category PaymentCategory
 	Status PaymentStatus
+	CounterpartID string // платёж второй стороны перевода, пусто для обычных платежей
+	Currency Currency // валюта Amount, всегда совпадает с валютой счёта
+	CreatedAt time.Time // нулевые, если запись пришла из дампа без времени
+	UpdatedAt time.Time
 }
 
 type Phone string
@@ -30,6 +62,9 @@ type Account struct {
 	ID int64
 	Phone Phone
 	Balance Money
+	Currency Currency
+	CreatedAt time.Time // нулевые, если запись пришла из дампа без времени
+	UpdatedAt time.Time
 }
 
 type Favorite struct {
@@ -38,10 +73,53 @@ type Favorite struct {
 	Name 			string
 	Amount			Money
 	Category        PaymentCategory	
+	Currency        Currency
+	CreatedAt       time.Time // нулевые, если запись пришла из дампа без времени
+	UpdatedAt       time.Time
 }
 
 
 type Progress struct {
 	Part int
 	Result Money
-}
\ No newline at end of file
+}
+
+// LedgerAccount счёт в книге проводок: кошелёк клиента ("wallet:1")
+// или системный счёт ("external:deposits", "category:auto")
+type LedgerAccount string
+
+// EntryKind вид операции, породившей проводку
+type EntryKind string
+
+const (
+	EntryKindDeposit  EntryKind = "deposit"
+	EntryKindPayment  EntryKind = "payment"
+	EntryKindRefund   EntryKind = "refund"
+	EntryKindTransfer EntryKind = "transfer"
+	EntryKindOpening  EntryKind = "opening"
+)
+
+// Posting одна сторона проводки: положительная сумма зачисляется на счёт,
+// отрицательная списывается
+type Posting struct {
+	Account LedgerAccount
+	Amount  Money
+}
+
+// LedgerEntry проводка, сумма всех Postings всегда равна нулю
+type LedgerEntry struct {
+	ID        string
+	Kind      EntryKind
+	PaymentID string
+	Postings  []Posting
+}
+
+// IdempotencyRecord результат операции, выполненной с ключом идемпотентности.
+// Повтор запроса с тем же ключом до ExpiresAt возвращает этот результат
+type IdempotencyRecord struct {
+	Key       string
+	Request   string // описание запроса, повтор должен с ним совпадать
+	PaymentID string // пусто для Deposit и при ошибке
+	Err       string // текст ошибки, пусто при успехе
+	ExpiresAt time.Time
+}
@@ -0,0 +1,442 @@
+package wallet
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Архив дампа: заголовок, затем tar с файлами Export (включая манифест),
+// сжатый gzip. Если задан ключ, сжатый поток шифруется AES-GCM кусками по
+// archiveChunkSize байт; номер куска и признак последнего входят в nonce,
+// поэтому переставленные, удалённые или отрезанные куски обнаруживаются.
+//
+//	magic(8) version(1) flags(1)                      — без шифрования
+//	magic(8) version(1) flags(1) prefix(7) check(16)  — с шифрованием
+//	кусок: last(1) length(4) ciphertext(length)
+const (
+	archiveMagic     = "WALLETAR"
+	archiveVersion   = 1
+	archiveEncrypted = 1
+	archiveChunkSize = 64 * 1024
+	archivePrefixLen = 7
+)
+
+var (
+	// ErrArchiveCorrupted возвращается, если архив повреждён или обрезан.
+	ErrArchiveCorrupted = errors.New("archive corrupted")
+	// ErrWrongKey возвращается, если архив зашифрован другим ключом.
+	ErrWrongKey = errors.New("wrong archive key")
+	// ErrKeyRequired возвращается при импорте зашифрованного архива без ключа.
+	ErrKeyRequired = errors.New("archive is encrypted, key required")
+)
+
+// archiveFiles файлы, которые может содержать архив.
+var archiveFiles = []string{accountsFileName, paymentsFileName, favoritesFileName, keysFileName, manifestFileName}
+
+// ArchiveOptions настройки ExportArchive и ImportArchive.
+type ArchiveOptions struct {
+	// Key ключ AES длиной 16, 24 или 32 байта. Пустой ключ — архив без шифрования.
+	Key []byte
+}
+
+// ExportArchive записывает дамп Export одним сжатым архивом, зашифрованным,
+// если в opts задан ключ. На диск ничего не пишется: каждый файл кодируется
+// один раз в память, откуда берутся размер для заголовка tar, контрольная
+// сумма для манифеста и сами записи. Файлы без записей попадают в архив
+// пустыми, как в Export.
+func (s *Service) ExportArchive(w io.Writer, opts ArchiveOptions) error {
+	var aead cipher.AEAD
+	if len(opts.Key) > 0 {
+		var err error
+		aead, err = newArchiveAEAD(opts.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	unlock, err := s.lockForExport()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	files := s.dumpFiles()
+
+	header := []byte(archiveMagic)
+	header = append(header, archiveVersion, 0)
+	var out io.WriteCloser = nopWriteCloser{w}
+	if aead != nil {
+		header[len(header)-1] = archiveEncrypted
+		prefix := make([]byte, archivePrefixLen)
+		_, err = rand.Read(prefix)
+		if err != nil {
+			return err
+		}
+		header = append(header, prefix...)
+		// пустой шифротекст с отдельным nonce отличает чужой ключ от порчи данных
+		header = append(header, aead.Seal(nil, archiveNonce(prefix, keyCheckCounter, 0), nil, header)...)
+		out = &sealWriter{w: w, aead: aead, prefix: prefix, aad: header}
+	}
+	_, err = w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	compressed := gzip.NewWriter(out)
+	archive := tar.NewWriter(compressed)
+	entries := make([]manifestEntry, 0, len(files))
+	for _, file := range files {
+		entry, err := addArchiveFile(archive, file)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	manifest := &bytes.Buffer{}
+	err = encodeManifest(NewDumpEncoder(manifest), entries)
+	if err == nil {
+		err = writeArchiveEntry(archive, manifestFileName, int64(manifest.Len()), func(w io.Writer) error {
+			_, err := manifest.WriteTo(w)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	err = archive.Close()
+	if err != nil {
+		return err
+	}
+	err = compressed.Close()
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// ImportArchive читает архив ExportArchive и загружает его так же, как
+// ImportStrict, после сверки с манифестом внутри архива. При ошибке сервис
+// не меняется. Файлы архива распаковываются в память, на диск ничего не
+// пишется: их записи всё равно окажутся в памяти сервиса.
+func (s *Service) ImportArchive(r io.Reader, opts ArchiveOptions) error {
+	reader := bufio.NewReader(r)
+	header := make([]byte, len(archiveMagic)+2)
+	_, err := io.ReadFull(reader, header)
+	if err != nil || string(header[:len(archiveMagic)]) != archiveMagic {
+		return fmt.Errorf("%w: not a wallet archive", ErrArchiveCorrupted)
+	}
+	if header[len(archiveMagic)] != archiveVersion {
+		return fmt.Errorf("%w: archive version %d", ErrUnsupportedVersion, header[len(archiveMagic)])
+	}
+
+	var in io.Reader = reader
+	switch header[len(archiveMagic)+1] {
+	case 0:
+	case archiveEncrypted:
+		if len(opts.Key) == 0 {
+			return ErrKeyRequired
+		}
+		aead, err := newArchiveAEAD(opts.Key)
+		if err != nil {
+			return err
+		}
+		rest := make([]byte, archivePrefixLen+aead.Overhead())
+		_, err = io.ReadFull(reader, rest)
+		if err != nil {
+			return fmt.Errorf("%w: short header", ErrArchiveCorrupted)
+		}
+		prefix := rest[:archivePrefixLen]
+		checked := append(append([]byte{}, header...), prefix...)
+		_, err = aead.Open(nil, archiveNonce(prefix, keyCheckCounter, 0), rest[archivePrefixLen:], checked)
+		if err != nil {
+			return ErrWrongKey
+		}
+		aad := append(append([]byte{}, header...), rest...)
+		in = &openReader{r: reader, aead: aead, prefix: prefix, aad: aad}
+	default:
+		return fmt.Errorf("%w: unknown flags %#x", ErrArchiveCorrupted, header[len(archiveMagic)+1])
+	}
+
+	files, err := extractArchive(in)
+	if err != nil {
+		return err
+	}
+	entries, err := parseManifest(bytes.NewReader(files[manifestFileName]), manifestFileName)
+	if err != nil {
+		return err
+	}
+	err = verifyEntries(entries, files.checksum)
+	if err != nil {
+		return err
+	}
+	_, err = s.importDump(files.read, ImportOptions{})
+	return err
+}
+
+// addArchiveFile кодирует file в буфер и пишет его в архив, возвращает
+// запись манифеста. Размер для заголовка tar и контрольная сумма берутся из
+// того же буфера, поэтому совпадают с записанным, даже если избранное или
+// ключи меняются во время выгрузки.
+func addArchiveFile(archive *tar.Writer, file dumpFile) (manifestEntry, error) {
+	buf := &bytes.Buffer{}
+	counter := newLineCounter()
+	enc := NewDumpEncoder(io.MultiWriter(buf, counter))
+	err := file.encode(enc)
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	entry := manifestEntry{name: file.name, records: enc.records, sum: counter.sum()}
+	err = writeArchiveEntry(archive, file.name, int64(buf.Len()), func(w io.Writer) error {
+		_, err := buf.WriteTo(w)
+		return err
+	})
+	return entry, err
+}
+
+func writeArchiveEntry(archive *tar.Writer, name string, size int64, write func(w io.Writer) error) error {
+	err := archive.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	return write(archive)
+}
+
+// archiveContents файлы архива, распакованные в память.
+type archiveContents map[string][]byte
+
+// read читает строки файла name, как dirDump.
+func (a archiveContents) read(name string, fn func(line string, n int) error) error {
+	data, ok := a[name]
+	if !ok {
+		return nil
+	}
+	err := scanDumpLines(NewDumpDecoder(bytes.NewReader(data)), fn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// checksum считает записи и контрольную сумму файла name для verifyEntries.
+func (a archiveContents) checksum(name string) (int, string, error) {
+	data, ok := a[name]
+	if !ok {
+		return 0, "", os.ErrNotExist
+	}
+	counter := newLineCounter()
+	_, _ = counter.Write(data)
+	return counter.lines, counter.sum(), nil
+}
+
+// extractArchive распаковывает известные файлы дампа в память. Поток
+// читается до конца, чтобы gzip проверил контрольную сумму, а шифрование —
+// последний кусок.
+func extractArchive(r io.Reader) (archiveContents, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, archiveError(err)
+	}
+	archive := tar.NewReader(compressed)
+
+	files := archiveContents{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, archiveError(err)
+		}
+		_, seen := files[header.Name]
+		if header.Typeflag != tar.TypeReg || !isArchiveFile(header.Name) || seen {
+			return nil, fmt.Errorf("%w: unexpected entry %q", ErrArchiveCorrupted, header.Name)
+		}
+
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, archiveError(err)
+		}
+		files[header.Name] = data
+	}
+	_, err = io.Copy(io.Discard, compressed)
+	if err != nil {
+		return nil, archiveError(err)
+	}
+	err = compressed.Close()
+	if err != nil {
+		return nil, archiveError(err)
+	}
+
+	if _, ok := files[manifestFileName]; !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrArchiveCorrupted, manifestFileName)
+	}
+	return files, nil
+}
+
+func isArchiveFile(name string) bool {
+	for _, known := range archiveFiles {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveError помечает ошибки разбора архива как ErrArchiveCorrupted,
+// не трогая уже помеченные (ErrArchiveCorrupted из openReader).
+func archiveError(err error) error {
+	if err == nil || errors.Is(err, ErrArchiveCorrupted) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrArchiveCorrupted, err)
+}
+
+func newArchiveAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyCheckCounter номер «куска» проверки ключа, обычные куски его не достигают.
+const keyCheckCounter = ^uint32(0)
+
+// archiveNonce prefix(7) counter(4) last(1) — 12 байт nonce GCM.
+func archiveNonce(prefix []byte, counter uint32, last byte) []byte {
+	nonce := make([]byte, archivePrefixLen+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[archivePrefixLen:], counter)
+	nonce[archivePrefixLen+4] = last
+	return nonce
+}
+
+// sealWriter шифрует поток кусками. Кусок отправляется только когда за
+// ним есть ещё данные, поэтому последний кусок помечается в Close.
+type sealWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	aad     []byte
+	buf     []byte
+	counter uint32
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for len(s.buf) > archiveChunkSize {
+		err := s.seal(s.buf[:archiveChunkSize], 0)
+		if err != nil {
+			return 0, err
+		}
+		s.buf = append(s.buf[:0], s.buf[archiveChunkSize:]...)
+	}
+	return len(p), nil
+}
+
+func (s *sealWriter) Close() error {
+	return s.seal(s.buf, 1)
+}
+
+func (s *sealWriter) seal(chunk []byte, last byte) error {
+	if s.counter == keyCheckCounter {
+		return errors.New("archive too large")
+	}
+	sealed := s.aead.Seal(nil, archiveNonce(s.prefix, s.counter, last), chunk, s.aad)
+	s.counter++
+
+	head := make([]byte, 5)
+	head[0] = last
+	binary.BigEndian.PutUint32(head[1:], uint32(len(sealed)))
+	_, err := s.w.Write(head)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(sealed)
+	return err
+}
+
+// openReader расшифровывает куски sealWriter и требует, чтобы поток
+// заканчивался помеченным последним куском.
+type openReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	aad     []byte
+	buf     []byte
+	counter uint32
+	done    bool
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.buf) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		err := o.next()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, o.buf)
+	o.buf = o.buf[n:]
+	return n, nil
+}
+
+func (o *openReader) next() error {
+	head := make([]byte, 5)
+	_, err := io.ReadFull(o.r, head)
+	if err != nil {
+		return fmt.Errorf("%w: truncated", ErrArchiveCorrupted)
+	}
+	last := head[0]
+	length := binary.BigEndian.Uint32(head[1:])
+	if last > 1 || length > archiveChunkSize+uint32(o.aead.Overhead()) {
+		return fmt.Errorf("%w: chunk %d header", ErrArchiveCorrupted, o.counter)
+	}
+
+	sealed := make([]byte, length)
+	_, err = io.ReadFull(o.r, sealed)
+	if err != nil {
+		return fmt.Errorf("%w: truncated", ErrArchiveCorrupted)
+	}
+	o.buf, err = o.aead.Open(sealed[:0], archiveNonce(o.prefix, o.counter, last), sealed, o.aad)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d fails authentication", ErrArchiveCorrupted, o.counter)
+	}
+	o.counter++
+
+	if last == 1 {
+		o.done = true
+		if _, err := io.ReadFull(o.r, make([]byte, 1)); err != io.EOF {
+			return fmt.Errorf("%w: data after the last chunk", ErrArchiveCorrupted)
+		}
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
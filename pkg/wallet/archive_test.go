@@ -0,0 +1,205 @@
+package wallet
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_ExportArchive_roundTrip(t *testing.T) {
+	s, from, to := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 100, "food")
+	_, _ = s.Transfer(from.ID, to.Phone, 200)
+	_, _ = s.FavoritePayment(payment.ID, "lunch")
+	// больше одного куска шифрования
+	for i := 0; i < 2_000; i++ {
+		_, _ = s.Pay(from.ID, 1, "category-with-a-long-name")
+	}
+
+	// открытый дамп не должен попадать на диск даже временно: без
+	// временного каталога архив всё равно пишется и читается
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+
+	key := bytes.Repeat([]byte{7}, 32)
+	for _, opts := range []ArchiveOptions{{}, {Key: key}, {Key: key[:16]}} {
+		buf := &bytes.Buffer{}
+		if err := s.ExportArchive(buf, opts); err != nil {
+			t.Fatalf("ExportArchive(): error = %v", err)
+		}
+		if len(opts.Key) > 0 && strings.Contains(buf.String(), "+99290000000") {
+			t.Errorf("ExportArchive(): encrypted archive contains a phone number")
+		}
+
+		imported := &Service{}
+		if err := imported.ImportArchive(buf, opts); err != nil {
+			t.Fatalf("ImportArchive(): error = %v", err)
+		}
+		wantAccounts, wantPayments, wantFavorites, _ := s.snapshot()
+		gotAccounts, gotPayments, gotFavorites, _ := imported.snapshot()
+		if !reflect.DeepEqual(gotAccounts, wantAccounts) || !reflect.DeepEqual(gotPayments, wantPayments) || !reflect.DeepEqual(gotFavorites, wantFavorites) {
+			t.Errorf("ImportArchive(%d-byte key): state differs from exported service", len(opts.Key))
+		}
+	}
+}
+
+func TestService_ImportArchive_keys(t *testing.T) {
+	s, _, _ := newTransferService(t)
+	key := bytes.Repeat([]byte{1}, 32)
+	buf := &bytes.Buffer{}
+	if err := s.ExportArchive(buf, ArchiveOptions{Key: key}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	wrong := bytes.Repeat([]byte{2}, 32)
+	if err := (&Service{}).ImportArchive(bytes.NewReader(data), ArchiveOptions{Key: wrong}); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("ImportArchive(): must return ErrWrongKey, returned = %v", err)
+	}
+	if err := (&Service{}).ImportArchive(bytes.NewReader(data), ArchiveOptions{}); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("ImportArchive(): must return ErrKeyRequired, returned = %v", err)
+	}
+	if err := (&Service{}).ExportArchive(io.Discard, ArchiveOptions{Key: []byte("short")}); err == nil {
+		t.Errorf("ExportArchive(): must reject a 5-byte key")
+	}
+}
+
+func TestService_ImportArchive_corrupted(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	_, _ = s.Pay(from.ID, 100, "food")
+	key := bytes.Repeat([]byte{1}, 32)
+
+	for _, opts := range []ArchiveOptions{{}, {Key: key}} {
+		buf := &bytes.Buffer{}
+		if err := s.ExportArchive(buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		flipped := append([]byte{}, data...)
+		flipped[len(flipped)-10] ^= 0xff
+		tests := map[string][]byte{
+			"flipped":   flipped,
+			"truncated": data[:len(data)-20],
+			"trailing":  append(append([]byte{}, data...), 0),
+			"garbage":   []byte("1;+992900000001;100\n"),
+		}
+		for name, corrupted := range tests {
+			imported := &Service{}
+			if err := imported.ImportArchive(bytes.NewReader(corrupted), opts); !errors.Is(err, ErrArchiveCorrupted) {
+				t.Errorf("%s (%d-byte key): ImportArchive() must return ErrArchiveCorrupted, returned = %v", name, len(opts.Key), err)
+			}
+			if accounts, _ := imported.storage().Accounts().All(); len(accounts) != 0 {
+				t.Errorf("%s: ImportArchive() loaded %v accounts", name, len(accounts))
+			}
+		}
+	}
+}
+
+func TestService_ExportArchive_compressed(t *testing.T) {
+	s, _, _ := newTransferService(t)
+	buf := &bytes.Buffer{}
+	if err := s.ExportArchive(buf, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gzip.NewReader(bytes.NewReader(buf.Bytes()[len(archiveMagic)+2:])); err != nil {
+		t.Errorf("ExportArchive(): body is not gzip: %v", err)
+	}
+}
+
+// blockingWriter останавливает первую запись, пока не закрыт release.
+type blockingWriter struct {
+	bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	if w.started != nil {
+		close(w.started)
+		w.started = nil
+		<-w.release
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestService_ExportArchive_consistent(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	before, _ := s.FindAccountByID(from.ID)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	w := &blockingWriter{started: started, release: release}
+	done := make(chan error)
+	go func() {
+		done <- s.ExportArchive(w, ArchiveOptions{})
+	}()
+	<-started
+
+	// чтение во время выгрузки не ждёт, изменение ждёт её конца
+	if _, err := s.FindAccountByID(from.ID); err != nil {
+		t.Fatal(err)
+	}
+	deposited := make(chan struct{})
+	go func() {
+		_ = s.Deposit(from.ID, 1)
+		close(deposited)
+	}()
+	select {
+	case <-deposited:
+		t.Errorf("Deposit() did not wait for ExportArchive()")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	<-deposited
+
+	imported := &Service{}
+	if err := imported.ImportArchive(&w.Buffer, ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if account, _ := imported.FindAccountByID(from.ID); account == nil || account.Balance != before.Balance {
+		t.Errorf("ImportArchive(): account %v, want balance %v from before the deposit", account, before.Balance)
+	}
+}
+
+func TestAddArchiveFile_encodesOnce(t *testing.T) {
+	// ключи меняются без блокировок счетов: каждый вызов encode видит другое
+	calls := 0
+	file := dumpFile{name: keysFileName, encode: func(enc *DumpEncoder) error {
+		calls++
+		return enc.writeLine(strings.Repeat("k", calls))
+	}}
+
+	buf := &bytes.Buffer{}
+	archive := tar.NewWriter(buf)
+	entry, err := addArchiveFile(archive, file)
+	if err != nil {
+		t.Fatalf("addArchiveFile(): error = %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("addArchiveFile(): encoded %d times, want once", calls)
+	}
+
+	files := tar.NewReader(buf)
+	if _, err := files.Next(); err != nil {
+		t.Fatal(err)
+	}
+	counter := newLineCounter()
+	if _, err := io.Copy(counter, files); err != nil {
+		t.Fatal(err)
+	}
+	if counter.lines != entry.records || counter.sum() != entry.sum {
+		t.Errorf("addArchiveFile(): manifest %d;%s, content %d;%s", entry.records, entry.sum, counter.lines, counter.sum())
+	}
+}
@@ -0,0 +1,400 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// deltaVersion версия формата ExportSince, первая строка
+// "delta;2;epoch;since;seq".
+const deltaVersion = 2
+
+// deltaSource имя, под которым строки дельты попадают в LineError.
+const deltaSource = "delta"
+
+// ErrInvalidSequence возвращается, если номер изменения больше текущего.
+var ErrInvalidSequence = errors.New("change sequence is ahead of the service")
+
+// ErrStaleCheckpoint возвращается для отметки другой эпохи журнала
+// изменений, например выданной до перезапуска сервиса: номера изменений
+// живут в памяти и после перезапуска начинаются заново. Получивший её
+// начинает с нулевой отметки, то есть с полной выгрузки.
+var ErrStaleCheckpoint = errors.New("change checkpoint is from another epoch")
+
+// ChangeCheckpoint отметка в журнале изменений сервиса: эпоха журнала и
+// номер последнего изменения. Эпоха своя у каждого запуска сервиса, поэтому
+// номера разных запусков не путаются. Нулевая отметка — начало журнала.
+type ChangeCheckpoint struct {
+	Epoch string
+	Seq   uint64
+}
+
+// Виды записей в журнале изменений и в строках дельты.
+const (
+	changeAccount  = "account"
+	changePayment  = "payment"
+	changeFavorite = "favorite"
+)
+
+type changeKey struct {
+	kind string
+	id   string
+}
+
+// changeLog присваивает каждому сохранению счёта, платежа или избранного
+// следующий номер и помнит последний номер каждой записи.
+type changeLog struct {
+	epoch string // не меняется после создания
+
+	mu   sync.Mutex
+	seq  uint64
+	last map[changeKey]uint64
+}
+
+// newEpoch возвращает случайный идентификатор эпохи журнала изменений.
+func newEpoch() (string, error) {
+	epoch := make([]byte, 8)
+	_, err := rand.Read(epoch)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(epoch), nil
+}
+
+func (c *changeLog) touch(kind, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	c.last[changeKey{kind, id}] = c.seq
+}
+
+func (c *changeLog) current() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.seq
+}
+
+// since возвращает ID записей вида kind, изменённых после seq, в порядке изменений.
+func (c *changeLog) since(kind string, seq uint64) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type change struct {
+		id  string
+		seq uint64
+	}
+	changes := []change{}
+	for key, last := range c.last {
+		if key.kind == kind && last > seq {
+			changes = append(changes, change{key.id, last})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].seq < changes[j].seq
+	})
+
+	ids := make([]string, 0, len(changes))
+	for _, change := range changes {
+		ids = append(ids, change.id)
+	}
+	return ids
+}
+
+// trackChanges оборачивает хранилище так, что каждый успешный Save
+// попадает в журнал изменений новой эпохи. Записи, уже лежащие в хранилище,
+// получают номера сразу, поэтому ExportSince с нулевой отметкой выгружает всё.
+func trackChanges(repo Repository) (*trackedRepository, error) {
+	epoch, err := newEpoch()
+	if err != nil {
+		return nil, err
+	}
+	tracked := &trackedRepository{
+		Repository: repo,
+		changes:    &changeLog{epoch: epoch, last: make(map[changeKey]uint64)},
+	}
+
+	accounts, err := repo.Accounts().All()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		tracked.changes.touch(changeAccount, strconv.FormatInt(account.ID, 10))
+	}
+	payments, err := repo.Payments().All()
+	if err != nil {
+		return nil, err
+	}
+	for _, payment := range payments {
+		tracked.changes.touch(changePayment, payment.ID)
+	}
+	favorites, err := repo.Favorites().All()
+	if err != nil {
+		return nil, err
+	}
+	for _, favorite := range favorites {
+		tracked.changes.touch(changeFavorite, favorite.ID)
+	}
+	return tracked, nil
+}
+
+type trackedRepository struct {
+	Repository
+	changes *changeLog
+}
+
+func (r *trackedRepository) batch(fn func() error) error {
+	if b, ok := r.Repository.(batcher); ok {
+		return b.batch(fn)
+	}
+	return fn()
+}
+
+func (r *trackedRepository) Accounts() AccountRepository {
+	return trackedAccounts{r.Repository.Accounts(), r.changes}
+}
+
+func (r *trackedRepository) Payments() PaymentRepository {
+	return trackedPayments{r.Repository.Payments(), r.changes}
+}
+
+func (r *trackedRepository) Favorites() FavoriteRepository {
+	return trackedFavorites{r.Repository.Favorites(), r.changes}
+}
+
+type trackedAccounts struct {
+	AccountRepository
+	changes *changeLog
+}
+
+func (a trackedAccounts) Save(account *types.Account) error {
+	err := a.AccountRepository.Save(account)
+	if err != nil {
+		return err
+	}
+	a.changes.touch(changeAccount, strconv.FormatInt(account.ID, 10))
+	return nil
+}
+
+type trackedPayments struct {
+	PaymentRepository
+	changes *changeLog
+}
+
+func (p trackedPayments) Save(payment *types.Payment) error {
+	err := p.PaymentRepository.Save(payment)
+	if err != nil {
+		return err
+	}
+	p.changes.touch(changePayment, payment.ID)
+	return nil
+}
+
+type trackedFavorites struct {
+	FavoriteRepository
+	changes *changeLog
+}
+
+func (f trackedFavorites) Save(favorite *types.Favorite) error {
+	err := f.FavoriteRepository.Save(favorite)
+	if err != nil {
+		return err
+	}
+	f.changes.touch(changeFavorite, favorite.ID)
+	return nil
+}
+
+// Checkpoint возвращает отметку последнего изменения. Её передают в
+// ExportSince в следующий раз, чтобы получить только новые изменения.
+func (s *Service) Checkpoint() ChangeCheckpoint {
+	s.storage()
+	return ChangeCheckpoint{Epoch: s.changes.epoch, Seq: s.changes.current()}
+}
+
+// ExportSince записывает в w счета, платежи и избранное, созданные или
+// изменённые после отметки since (нулевая — всё), и возвращает отметку
+// последнего вошедшего изменения. Отметка другой эпохи отклоняется с
+// ErrStaleCheckpoint. Формат — строки дампа с видом записи в первом поле:
+// сначала счета, потом платежи, потом избранное.
+func (s *Service) ExportSince(w io.Writer, since ChangeCheckpoint) (ChangeCheckpoint, error) {
+	repo := s.storage()
+
+	// запись в mu останавливает изменения, дельта получается согласованной
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if since.Epoch == "" && since.Seq != 0 || since.Epoch != "" && since.Epoch != s.changes.epoch {
+		return ChangeCheckpoint{}, fmt.Errorf("%w: %q, current %q", ErrStaleCheckpoint, since.Epoch, s.changes.epoch)
+	}
+	seq := since.Seq
+	current := s.changes.current()
+	if seq > current {
+		return ChangeCheckpoint{}, fmt.Errorf("%w: %d > %d", ErrInvalidSequence, seq, current)
+	}
+
+	enc := NewDumpEncoder(w)
+	err := enc.writeLine("delta;" + strconv.Itoa(deltaVersion) + ";" + s.changes.epoch + ";" + strconv.FormatUint(seq, 10) + ";" + strconv.FormatUint(current, 10))
+	if err != nil {
+		return ChangeCheckpoint{}, err
+	}
+
+	for _, id := range s.changes.since(changeAccount, seq) {
+		accountID, _ := strconv.ParseInt(id, 10, 64)
+		account, err := repo.Accounts().ByID(accountID)
+		if err != nil {
+			return ChangeCheckpoint{}, err
+		}
+		err = enc.writeLine(changeAccount + ";" + formatAccount(*account))
+		if err != nil {
+			return ChangeCheckpoint{}, err
+		}
+	}
+	for _, id := range s.changes.since(changePayment, seq) {
+		payment, err := repo.Payments().ByID(id)
+		if err != nil {
+			return ChangeCheckpoint{}, err
+		}
+		err = enc.writeLine(changePayment + ";" + formatPayment(*payment))
+		if err != nil {
+			return ChangeCheckpoint{}, err
+		}
+	}
+	for _, id := range s.changes.since(changeFavorite, seq) {
+		favorite, err := repo.Favorites().ByID(id)
+		if err != nil {
+			return ChangeCheckpoint{}, err
+		}
+		err = enc.writeLine(changeFavorite + ";" + formatFavorite(*favorite))
+		if err != nil {
+			return ChangeCheckpoint{}, err
+		}
+	}
+
+	err = enc.Flush()
+	if err != nil {
+		return ChangeCheckpoint{}, err
+	}
+	return ChangeCheckpoint{Epoch: s.changes.epoch, Seq: current}, nil
+}
+
+// ImportDelta применяет дельту ExportSince. Записи заменяют записи с теми
+// же ID, поэтому повторное применение той же дельты ничего не меняет.
+// Дельта проверяется целиком, как в ImportStrict, и при ошибках сервис не
+// меняется; строки в *LineError относятся к дельте. Применённая дельта
+// записывается одним пакетом хранилища, и только после этого
+// ImportReport.Checkpoint получает её отметку — с неё запрашивается
+// следующая дельта.
+func (s *Service) ImportDelta(r io.Reader) (ImportReport, error) {
+	dec := NewDumpDecoder(r)
+	header, err := dec.readLine()
+	if err == io.EOF {
+		return ImportReport{}, fmt.Errorf("%w: empty delta", ErrInvalidRecord)
+	}
+	if err != nil {
+		return ImportReport{}, err
+	}
+	fields := strings.Split(header, ";")
+	if len(fields) < 2 || fields[0] != "delta" {
+		return ImportReport{}, fmt.Errorf("%w: delta header %q", ErrInvalidRecord, header)
+	}
+	if fields[1] != strconv.Itoa(deltaVersion) {
+		return ImportReport{}, fmt.Errorf("%w: delta version %s", ErrUnsupportedVersion, fields[1])
+	}
+	if len(fields) != 5 {
+		return ImportReport{}, fmt.Errorf("%w: delta header %q", ErrInvalidRecord, header)
+	}
+	seq, err := strconv.ParseUint(fields[4], 10, 64)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("%w: delta header %q", ErrInvalidRecord, header)
+	}
+	checkpoint := ChangeCheckpoint{Epoch: fields[2], Seq: seq}
+
+	// дельта небольшая, поэтому держим её строки до конца проверки
+	type deltaLine struct {
+		kind string
+		line string
+		n    int
+	}
+	lines := []deltaLine{}
+	for {
+		line, err := dec.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ImportReport{}, err
+		}
+		i := strings.Index(line, ";")
+		if i < 0 {
+			i = len(line)
+		}
+		lines = append(lines, deltaLine{kind: line[:i], line: strings.TrimPrefix(line[i:], ";"), n: dec.Line()})
+	}
+	// счета раньше платежей и избранного, даже если строки перемешаны
+	order := map[string]int{changeAccount: 0, changePayment: 1, changeFavorite: 2}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return order[lines[i].kind] < order[lines[j].kind]
+	})
+
+	repo := s.storage()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check := newImportCheck(repo, s.now())
+	check.source = deltaSource
+	for _, line := range lines {
+		switch line.kind {
+		case changeAccount:
+			_ = check.account(line.line, line.n)
+		case changePayment:
+			_ = check.payment(line.line, line.n)
+		case changeFavorite:
+			_ = check.favorite(line.line, line.n)
+		default:
+			check.fail(deltaSource, line.n, "unknown record kind %q", line.kind)
+		}
+	}
+	check.finish()
+	if len(check.errs.Errors) > 0 {
+		return check.report, &check.errs
+	}
+
+	staging := NewMemoryRepository()
+	for _, line := range lines {
+		switch line.kind {
+		case changeAccount:
+			account, _ := parseAccount(line.line)
+			err = staging.Accounts().Save(&account)
+		case changePayment:
+			payment, _ := parsePayment(line.line)
+			err = staging.Payments().Save(&payment)
+		case changeFavorite:
+			favorite, _ := parseFavorite(line.line)
+			err = staging.Favorites().Save(&favorite)
+		}
+		if err != nil {
+			return check.report, err
+		}
+	}
+	// одним пакетом: сбой не оставит сервис между двумя отметками, а
+	// отметка дельты возвращается, только когда пакет записан
+	err = s.atomically(func() error {
+		return s.applyImport(staging)
+	})
+	if err != nil {
+		return check.report, err
+	}
+	check.report.Checkpoint = checkpoint
+	return check.report, nil
+}
@@ -0,0 +1,169 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_ExportSince(t *testing.T) {
+	s := &Service{}
+	s.SetClock(fixedClock(time.Unix(1_700_000_000, 0)))
+	from, _ := s.RegisterAccount("+992900000001")
+	to, _ := s.RegisterAccount("+992900000002")
+	_ = s.Deposit(from.ID, 1_000)
+	_, _ = s.Pay(from.ID, 100, "food")
+
+	full := &bytes.Buffer{}
+	seq, err := s.ExportSince(full, ChangeCheckpoint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != s.Checkpoint() || seq.Epoch == "" {
+		t.Errorf("ExportSince() = %v, want Checkpoint() %v", seq, s.Checkpoint())
+	}
+	if lines := strings.Count(full.String(), "\n"); lines != 4 {
+		t.Errorf("ExportSince(0): %d lines, want header, 2 accounts and a payment:\n%s", lines, full)
+	}
+
+	// только счёт to и новый платёж
+	_ = s.Deposit(to.ID, 500)
+	payment, _ := s.Pay(to.ID, 50, "auto")
+
+	delta := &bytes.Buffer{}
+	next, err := s.ExportSince(delta, seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "delta;2;" + seq.Epoch + ";" + strconv.FormatUint(seq.Seq, 10) + ";" + strconv.FormatUint(next.Seq, 10) + "\n" +
+		"account;2;+992900000002;450;TJS;1700000000000000000;1700000000000000000\n" +
+		"payment;" + payment.ID + ";2;50;auto;INPROGRESS;;TJS;1700000000000000000;1700000000000000000\n"
+	if delta.String() != want {
+		t.Errorf("ExportSince(%v):\n%s\nwant\n%s", seq, delta, want)
+	}
+
+	empty := &bytes.Buffer{}
+	if last, err := s.ExportSince(empty, next); err != nil || last != next || strings.Count(empty.String(), "\n") != 1 {
+		t.Errorf("ExportSince(%v) = %v, %v:\n%s, want only the header", next, last, err, empty)
+	}
+	ahead := ChangeCheckpoint{Epoch: next.Epoch, Seq: next.Seq + 1}
+	if _, err := s.ExportSince(empty, ahead); !errors.Is(err, ErrInvalidSequence) {
+		t.Errorf("ExportSince(): must return ErrInvalidSequence, returned = %v", err)
+	}
+}
+
+func TestService_ExportSince_staleCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 0)
+	_, _ = s.RegisterAccount("+992900000001")
+	_, _ = s.RegisterAccount("+992900000002")
+	checkpoint := s.Checkpoint()
+	_ = repo.Close()
+
+	// после перезапуска номера начинаются заново: старая отметка указала бы
+	// на чужие изменения, поэтому отклоняется даже при меньшем номере
+	restarted, repo := openFileService(t, dir, 0)
+	defer repo.Close()
+	_, _ = restarted.RegisterAccount("+992900000003")
+	if restarted.Checkpoint().Epoch == checkpoint.Epoch {
+		t.Fatalf("Checkpoint(): epoch %q did not change after restart", checkpoint.Epoch)
+	}
+	for _, stale := range []ChangeCheckpoint{checkpoint, {Epoch: checkpoint.Epoch, Seq: 1}, {Seq: 1}} {
+		if _, err := restarted.ExportSince(&bytes.Buffer{}, stale); !errors.Is(err, ErrStaleCheckpoint) {
+			t.Errorf("ExportSince(%v): must return ErrStaleCheckpoint, returned = %v", stale, err)
+		}
+	}
+
+	full := &bytes.Buffer{}
+	if _, err := restarted.ExportSince(full, ChangeCheckpoint{}); err != nil || strings.Count(full.String(), "\n") != 4 {
+		t.Errorf("ExportSince() = %v:\n%s, want all 3 accounts", err, full)
+	}
+}
+
+func TestService_ImportDelta_idempotent(t *testing.T) {
+	source, from, to := newTransferService(t)
+	_, _ = source.Transfer(from.ID, to.Phone, 300)
+
+	replica := &Service{}
+	full := &bytes.Buffer{}
+	seq, _ := source.ExportSince(full, ChangeCheckpoint{})
+	if _, err := replica.ImportDelta(bytes.NewReader(full.Bytes())); err != nil {
+		t.Fatalf("ImportDelta(): error = %v", err)
+	}
+
+	payment, _ := source.Pay(to.ID, 100, "food")
+	_, _ = source.FavoritePayment(payment.ID, "lunch")
+	delta := &bytes.Buffer{}
+	_, _ = source.ExportSince(delta, seq)
+
+	next, _ := source.ExportSince(&bytes.Buffer{}, seq)
+	for i := 0; i < 2; i++ {
+		report, err := replica.ImportDelta(bytes.NewReader(delta.Bytes()))
+		if err != nil {
+			t.Fatalf("ImportDelta(): error = %v", err)
+		}
+		if report.Checkpoint != next {
+			t.Errorf("ImportDelta(): checkpoint = %v, want %v", report.Checkpoint, next)
+		}
+		if i == 1 && (report.Accounts.Created != 0 || report.Payments.Created != 0 || report.Favorites.Created != 0) {
+			t.Errorf("ImportDelta(): second application created records: %+v", report)
+		}
+	}
+
+	wantAccounts, wantPayments, wantFavorites, _ := source.snapshot()
+	gotAccounts, gotPayments, gotFavorites, _ := replica.snapshot()
+	if !reflect.DeepEqual(gotAccounts, wantAccounts) || !reflect.DeepEqual(gotPayments, wantPayments) || !reflect.DeepEqual(gotFavorites, wantFavorites) {
+		t.Errorf("ImportDelta(): replica differs from source:\n%v %v %v\nwant\n%v %v %v", gotAccounts, gotPayments, gotFavorites, wantAccounts, wantPayments, wantFavorites)
+	}
+	if discrepancies, _ := replica.VerifyLedger(); len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v after ImportDelta", discrepancies)
+	}
+}
+
+func TestService_ImportDelta_oneBatch(t *testing.T) {
+	source, from, to := newTransferService(t)
+	payment, _ := source.Pay(from.ID, 100, "food")
+	_, _ = source.Transfer(from.ID, to.Phone, 300)
+	_, _ = source.FavoritePayment(payment.ID, "lunch")
+	delta := &bytes.Buffer{}
+	_, _ = source.ExportSince(delta, ChangeCheckpoint{})
+
+	assertOneBatch(t, t.TempDir(), "ImportDelta()", func(replica *Service) error {
+		_, err := replica.ImportDelta(bytes.NewReader(delta.Bytes()))
+		return err
+	})
+}
+
+func TestService_ImportDelta_invalid(t *testing.T) {
+	tests := map[string]struct {
+		delta string
+		want  error
+		line  int
+	}{
+		"header":         {"1;+992900000001;100\n", ErrInvalidRecord, 0},
+		"version":        {"delta;1;0;1\n", ErrUnsupportedVersion, 0},
+		"no epoch":       {"delta;2;0;1\n", ErrInvalidRecord, 0},
+		"unknown kind":   {"delta;2;e;0;1\nledger;x\n", ErrInvalidRecord, 2},
+		"bad account":    {"delta;2;e;0;1\naccount;1;+992900000001\n", ErrInvalidRecord, 2},
+		"unknown target": {"delta;2;e;0;2\naccount;1;+992900000001;100\npayment;p1;5;10;auto;Ok\n", ErrInvalidRecord, 3},
+	}
+	for name, tt := range tests {
+		s := &Service{}
+		_, err := s.ImportDelta(strings.NewReader(tt.delta))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: ImportDelta() must return %v, returned = %v", name, tt.want, err)
+			continue
+		}
+		var lineErr *LineError
+		if tt.line > 0 && (!errors.As(err, &lineErr) || lineErr.File != deltaSource || lineErr.Line != tt.line) {
+			t.Errorf("%s: ImportDelta() error = %v, want delta line %d", name, err, tt.line)
+		}
+		if accounts, _ := s.storage().Accounts().All(); len(accounts) != 0 {
+			t.Errorf("%s: ImportDelta() saved %v accounts", name, len(accounts))
+		}
+	}
+}
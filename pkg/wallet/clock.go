@@ -0,0 +1,37 @@
+package wallet
+
+import (
+	"time"
+)
+
+// Clock источник текущего времени сервиса: время создания и изменения
+// записей, история статусов, сроки ключей идемпотентности.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc позволяет передать функцию как Clock.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// clockValue хранит Clock в atomic.Value, которому нужен один конкретный тип.
+type clockValue struct {
+	clock Clock
+}
+
+// SetClock подменяет часы сервиса, например на фиксированное время в
+// тестах. nil возвращает системные часы.
+func (s *Service) SetClock(clock Clock) {
+	s.clock.Store(clockValue{clock})
+}
+
+// now возвращает время сервиса в UTC.
+func (s *Service) now() time.Time {
+	if value, ok := s.clock.Load().(clockValue); ok && value.clock != nil {
+		return value.clock.Now().UTC()
+	}
+	return time.Now().UTC()
+}
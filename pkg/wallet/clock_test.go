@@ -0,0 +1,129 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func fixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time {
+		return t
+	})
+}
+
+func TestService_SetClock_timestamps(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	paid := created.Add(time.Hour)
+	confirmed := paid.Add(time.Hour)
+
+	s := &Service{}
+	s.SetClock(fixedClock(created))
+	account, _ := s.RegisterAccount("+992900000001")
+	if !account.CreatedAt.Equal(created) || !account.UpdatedAt.Equal(created) {
+		t.Errorf("RegisterAccount(): times = %v, %v, want %v", account.CreatedAt, account.UpdatedAt, created)
+	}
+
+	s.SetClock(fixedClock(paid))
+	_ = s.Deposit(account.ID, 1_000)
+	payment, _ := s.Pay(account.ID, 100, "auto")
+	s.SetClock(fixedClock(confirmed))
+	if err := s.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	favorite, _ := s.FavoritePayment(payment.ID, "car")
+
+	account, _ = s.FindAccountByID(account.ID)
+	if !account.CreatedAt.Equal(created) || !account.UpdatedAt.Equal(paid) {
+		t.Errorf("Pay(): account times = %v, %v, want %v, %v", account.CreatedAt, account.UpdatedAt, created, paid)
+	}
+	history, err := s.ExportAccountHistory(account.ID)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("ExportAccountHistory() = %v, %v", history, err)
+	}
+	if !history[0].CreatedAt.Equal(paid) || !history[0].UpdatedAt.Equal(confirmed) {
+		t.Errorf("ExportAccountHistory(): payment times = %v, %v, want %v, %v", history[0].CreatedAt, history[0].UpdatedAt, paid, confirmed)
+	}
+	if !favorite.CreatedAt.Equal(confirmed) || !favorite.UpdatedAt.Equal(confirmed) {
+		t.Errorf("FavoritePayment(): times = %v, %v, want %v", favorite.CreatedAt, favorite.UpdatedAt, confirmed)
+	}
+
+	// после SetClock(nil) время снова системное
+	s.SetClock(nil)
+	if now := s.now(); now.Sub(time.Now()) > time.Minute || time.Since(now) > time.Minute {
+		t.Errorf("now() = %v after SetClock(nil), want system time", now)
+	}
+}
+
+func TestService_Export_timestamps(t *testing.T) {
+	s := &Service{}
+	s.SetClock(fixedClock(time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)))
+	account, _ := s.RegisterAccount("+992900000001")
+	_ = s.Deposit(account.ID, 1_000)
+	payment, _ := s.Pay(account.ID, 100, "auto")
+	_, _ = s.FavoritePayment(payment.ID, "car")
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	wantAccounts, wantPayments, wantFavorites, _ := s.snapshot()
+	gotAccounts, gotPayments, gotFavorites, _ := imported.snapshot()
+	if !reflect.DeepEqual(gotAccounts, wantAccounts) || !reflect.DeepEqual(gotPayments, wantPayments) || !reflect.DeepEqual(gotFavorites, wantFavorites) {
+		t.Errorf("Import(): times differ from exported service:\n%v %v %v\nwant\n%v %v %v", gotAccounts, gotPayments, gotFavorites, wantAccounts, wantPayments, wantFavorites)
+	}
+}
+
+func TestParseRecords_timestamps(t *testing.T) {
+	at := time.Unix(0, 1_700_000_000_000_000_001).UTC()
+
+	// старые строки читаются с нулевым временем
+	account, err := parseAccount("1;+992900000001;100")
+	if err != nil || !account.CreatedAt.IsZero() || !account.UpdatedAt.IsZero() {
+		t.Errorf("parseAccount(legacy) = %v, %v, want zero times", account, err)
+	}
+
+	tests := []struct {
+		line string
+		want interface{}
+	}{
+		{"1;+992900000001;100;TJS;;1700000000000000001",
+			types.Account{ID: 1, Phone: "+992900000001", Balance: 100, Currency: "TJS", UpdatedAt: at}},
+		{"p1;1;10;auto;Ok;;USD;1700000000000000001;1700000000000000001",
+			types.Payment{ID: "p1", AccountID: 1, Amount: 10, Category: "auto", Status: "Ok", Currency: "USD", CreatedAt: at, UpdatedAt: at}},
+		{"f1;1;car;10;auto;TJS;1700000000000000001;1700000000000000001",
+			types.Favorite{ID: "f1", AccountID: 1, Name: "car", Amount: 10, Category: "auto", Currency: "TJS", CreatedAt: at, UpdatedAt: at}},
+	}
+	for _, tt := range tests {
+		var got interface{}
+		var line string
+		switch want := tt.want.(type) {
+		case types.Account:
+			got, err = parseAccount(tt.line)
+			line = formatAccount(want)
+		case types.Payment:
+			got, err = parsePayment(tt.line)
+			line = formatPayment(want)
+		case types.Favorite:
+			got, err = parseFavorite(tt.line)
+			line = formatFavorite(want)
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parse(%q) = %v, %v, want %v", tt.line, got, err, tt.want)
+		}
+		if line != tt.line {
+			t.Errorf("format(%v) = %q, want %q", tt.want, line, tt.line)
+		}
+	}
+
+	if _, err := parsePayment("p1;1;10;auto;Ok;;TJS;soon;"); err == nil {
+		t.Errorf("parsePayment(): must reject an invalid time")
+	}
+}
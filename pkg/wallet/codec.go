@@ -0,0 +1,228 @@
+package wallet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// DumpEncoder пишет записи дампа в io.Writer по одной строке и держит в
+// памяти только буфер записи, поэтому размер дампа не ограничен памятью.
+// После последней записи нужно вызвать Flush.
+type DumpEncoder struct {
+	w       *bufio.Writer
+	records int
+}
+
+// NewDumpEncoder создаёт кодировщик поверх w.
+func NewDumpEncoder(w io.Writer) *DumpEncoder {
+	return &DumpEncoder{w: bufio.NewWriter(w)}
+}
+
+func (e *DumpEncoder) EncodeAccount(account types.Account) error {
+	return e.writeLine(formatAccount(account))
+}
+
+func (e *DumpEncoder) EncodePayment(payment types.Payment) error {
+	return e.writeLine(formatPayment(payment))
+}
+
+func (e *DumpEncoder) EncodeFavorite(favorite types.Favorite) error {
+	return e.writeLine(formatFavorite(favorite))
+}
+
+func (e *DumpEncoder) encodeIdempotencyRecord(record types.IdempotencyRecord) error {
+	return e.writeLine(formatIdempotencyRecord(record))
+}
+
+// Flush дописывает буфер в нижележащий io.Writer.
+func (e *DumpEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+func (e *DumpEncoder) writeLine(line string) error {
+	_, err := e.w.WriteString(line)
+	if err != nil {
+		return err
+	}
+	e.records++
+	return e.w.WriteByte('\n')
+}
+
+// DumpDecoder читает записи дампа из io.Reader по одной. Пустые строки
+// пропускаются. Decode* возвращают io.EOF, когда записи закончились;
+// после ошибки в записи можно читать дальше.
+type DumpDecoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewDumpDecoder создаёт декодер поверх r.
+func NewDumpDecoder(r io.Reader) *DumpDecoder {
+	return &DumpDecoder{r: bufio.NewReader(r)}
+}
+
+// Line возвращает номер строки (с 1) последней прочитанной записи.
+func (d *DumpDecoder) Line() int {
+	return d.line
+}
+
+func (d *DumpDecoder) DecodeAccount() (types.Account, error) {
+	line, err := d.readLine()
+	if err != nil {
+		return types.Account{}, err
+	}
+	account, err := parseAccount(line)
+	if err != nil {
+		return types.Account{}, fmt.Errorf("line %d: %w", d.line, err)
+	}
+	return account, nil
+}
+
+func (d *DumpDecoder) DecodePayment() (types.Payment, error) {
+	line, err := d.readLine()
+	if err != nil {
+		return types.Payment{}, err
+	}
+	payment, err := parsePayment(line)
+	if err != nil {
+		return types.Payment{}, fmt.Errorf("line %d: %w", d.line, err)
+	}
+	return payment, nil
+}
+
+func (d *DumpDecoder) DecodeFavorite() (types.Favorite, error) {
+	line, err := d.readLine()
+	if err != nil {
+		return types.Favorite{}, err
+	}
+	favorite, err := parseFavorite(line)
+	if err != nil {
+		return types.Favorite{}, fmt.Errorf("line %d: %w", d.line, err)
+	}
+	return favorite, nil
+}
+
+func (d *DumpDecoder) decodeIdempotencyRecord() (types.IdempotencyRecord, error) {
+	line, err := d.readLine()
+	if err != nil {
+		return types.IdempotencyRecord{}, err
+	}
+	record, err := parseIdempotencyRecord(line)
+	if err != nil {
+		return types.IdempotencyRecord{}, fmt.Errorf("line %d: %w", d.line, err)
+	}
+	return record, nil
+}
+
+// readLine возвращает следующую непустую строку без перевода строки.
+// Длина строки ничем не ограничена, в отличие от bufio.Scanner.
+func (d *DumpDecoder) readLine() (string, error) {
+	for {
+		line, err := d.r.ReadString('\n')
+		if err == io.EOF && len(line) == 0 {
+			return "", io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		d.line++
+
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) != "" {
+			return line, nil
+		}
+		if err == io.EOF {
+			return "", io.EOF
+		}
+	}
+}
+
+// decodeDumpFile открывает файл и читает его через DumpDecoder. Ошибка
+// открытия возвращается как есть (os.IsNotExist работает), ошибки
+// чтения дополняются путём к файлу.
+func decodeDumpFile(path string, decode func(dec *DumpDecoder) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = decode(NewDumpDecoder(file))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// escapeField экранирует символы, которые нельзя оставить в поле дампа:
+// "\" -> "\\", ";" -> "\s", перевод строки -> "\n", возврат каретки -> "\r".
+func escapeField(field string) string {
+	if !strings.ContainsAny(field, "\\;\n\r") {
+		return field
+	}
+	return fieldEscaper.Replace(field)
+}
+
+// escapePostingAccount дополнительно экранирует "," -> "\c" и "=" -> "\e",
+// которыми разделены стороны проводки.
+func escapePostingAccount(account types.LedgerAccount) string {
+	if !strings.ContainsAny(string(account), "\\;\n\r,=") {
+		return string(account)
+	}
+	return postingEscaper.Replace(string(account))
+}
+
+var fieldEscaper = strings.NewReplacer(`\`, `\\`, ";", `\s`, "\n", `\n`, "\r", `\r`)
+
+var postingEscaper = strings.NewReplacer(`\`, `\\`, ";", `\s`, "\n", `\n`, "\r", `\r`, ",", `\c`, "=", `\e`)
+
+// unescapeField обращает escapeField и escapePostingAccount. Неизвестные
+// последовательности остаются как есть, поэтому старые дампы с "\" в
+// данных читаются без изменений.
+func unescapeField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var b strings.Builder
+	b.Grow(len(field))
+	for i := 0; i < len(field); i++ {
+		if field[i] != '\\' || i == len(field)-1 {
+			b.WriteByte(field[i])
+			continue
+		}
+		switch field[i+1] {
+		case '\\':
+			b.WriteByte('\\')
+		case 's':
+			b.WriteByte(';')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'c':
+			b.WriteByte(',')
+		case 'e':
+			b.WriteByte('=')
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(field[i+1])
+		}
+		i++
+	}
+	return b.String()
+}
+
+// splitFields делит строку дампа на поля и снимает с них экранирование.
+func splitFields(line string) []string {
+	fields := strings.Split(line, ";")
+	for i, field := range fields {
+		fields[i] = unescapeField(field)
+	}
+	return fields
+}
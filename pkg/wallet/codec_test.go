@@ -0,0 +1,155 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func TestDumpEncoder_roundTrip(t *testing.T) {
+	account := types.Account{ID: 1, Phone: "+992;900\n01", Balance: 100, Currency: types.CurrencyUSD}
+	payment := types.Payment{ID: "p1", AccountID: 1, Amount: 50, Category: `food; "fast"\n`, Status: types.PaymentStatusOk, Currency: DefaultCurrency}
+	favorite := types.Favorite{ID: "f1", AccountID: 1, Name: "lunch;\r\nevery day \\s", Amount: 50, Category: "a,b=c", Currency: DefaultCurrency}
+
+	buf := &bytes.Buffer{}
+	enc := NewDumpEncoder(buf)
+	if err := enc.EncodeAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.EncodePayment(payment); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.EncodeFavorite(favorite); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Fatalf("DumpEncoder wrote %d lines, want 3:\n%s", lines, buf.String())
+	}
+
+	dec := NewDumpDecoder(buf)
+	gotAccount, err := dec.DecodeAccount()
+	if err != nil || gotAccount != account {
+		t.Errorf("DecodeAccount() = %v, %v, want %v", gotAccount, err, account)
+	}
+	gotPayment, err := dec.DecodePayment()
+	if err != nil || gotPayment != payment {
+		t.Errorf("DecodePayment() = %v, %v, want %v", gotPayment, err, payment)
+	}
+	gotFavorite, err := dec.DecodeFavorite()
+	if err != nil || gotFavorite != favorite {
+		t.Errorf("DecodeFavorite() = %v, %v, want %v", gotFavorite, err, favorite)
+	}
+	if _, err := dec.DecodePayment(); err != io.EOF {
+		t.Errorf("DecodePayment(): error = %v at the end, want io.EOF", err)
+	}
+}
+
+func TestDumpDecoder_legacyAndErrors(t *testing.T) {
+	// старые дампы без экранирования, с пустыми строками и без "\n" в конце
+	data := "p1;1;100;a\\b;Ok\r\n\n  \np2;1;x;auto;Ok\np3;1;300;auto;FAIL"
+	dec := NewDumpDecoder(strings.NewReader(data))
+
+	payment, err := dec.DecodePayment()
+	if err != nil || payment.Category != `a\b` {
+		t.Errorf("DecodePayment() = %v, %v, want category %q", payment, err, `a\b`)
+	}
+	if _, err := dec.DecodePayment(); !errors.Is(err, ErrInvalidRecord) || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("DecodePayment(): error = %v, want ErrInvalidRecord at line 4", err)
+	}
+	payment, err = dec.DecodePayment()
+	if err != nil || payment.ID != "p3" || dec.Line() != 5 {
+		t.Errorf("DecodePayment() = %v, %v at line %d, want p3 at line 5", payment, err, dec.Line())
+	}
+	if _, err := dec.DecodePayment(); err != io.EOF {
+		t.Errorf("DecodePayment(): error = %v at the end, want io.EOF", err)
+	}
+}
+
+func TestFormatEntry_escaping(t *testing.T) {
+	entry := types.LedgerEntry{
+		ID:        "e1",
+		Kind:      types.EntryKindPayment,
+		PaymentID: "p;1",
+		Postings: []types.Posting{
+			{Account: "category:a,b=c", Amount: 10},
+			{Account: "wallet:1", Amount: -10},
+		},
+	}
+	got, err := parseEntry(formatEntry(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entry) {
+		t.Errorf("parseEntry(formatEntry()) = %v, want %v", got, entry)
+	}
+}
+
+func TestService_Export_escaping(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 100, "food; drinks\nand more")
+	_, _ = s.FavoritePayment(payment.ID, `lunch;\every day`)
+
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatalf("Import(): error = %v", err)
+	}
+
+	wantAccounts, wantPayments, wantFavorites, _ := s.snapshot()
+	gotAccounts, gotPayments, gotFavorites, _ := imported.snapshot()
+	if !reflect.DeepEqual(gotAccounts, wantAccounts) {
+		t.Errorf("Import(): accounts = %v, want %v", gotAccounts, wantAccounts)
+	}
+	if !reflect.DeepEqual(gotPayments, wantPayments) {
+		t.Errorf("Import(): payments = %v, want %v", gotPayments, wantPayments)
+	}
+	if !reflect.DeepEqual(gotFavorites, wantFavorites) {
+		t.Errorf("Import(): favorites = %v, want %v", gotFavorites, wantFavorites)
+	}
+}
+
+func TestService_HistoryToFiles_escaping(t *testing.T) {
+	payments := []types.Payment{
+		{ID: "p1", AccountID: 1, Amount: 1, Category: "a;b", Status: types.PaymentStatusOk, Currency: DefaultCurrency},
+		{ID: "p2", AccountID: 1, Amount: 2, Category: "c\nd", Status: types.PaymentStatusOk, Currency: DefaultCurrency},
+		{ID: "p3", AccountID: 1, Amount: 3, Category: "e", Status: types.PaymentStatusOk, Currency: DefaultCurrency},
+	}
+	dir := t.TempDir()
+	s := &Service{}
+	if err := s.HistoryToFiles(payments, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []types.Payment{}
+	for _, name := range []string{"payments1.dump", "payments2.dump"} {
+		err := decodeDumpFile(dir+"/"+name, func(dec *DumpDecoder) error {
+			for {
+				payment, err := dec.DecodePayment()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				got = append(got, payment)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(got, payments) {
+		t.Errorf("HistoryToFiles(): files hold %v, want %v", got, payments)
+	}
+}
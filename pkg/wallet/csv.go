@@ -0,0 +1,264 @@
+package wallet
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// csvHeader первая строка CSV с платежами. Время пишется в RFC 3339 (UTC),
+// неизвестное время — пустым полем. Файлы без двух последних столбцов
+// (старый формат) тоже читаются.
+var csvHeader = []string{"id", "account_id", "amount", "currency", "category", "status", "counterpart_id", "created_at", "updated_at"}
+
+// csvLegacyColumns число столбцов CSV до появления времени записей.
+const csvLegacyColumns = 7
+
+// utf8BOM помогает Excel распознать кириллицу в UTF-8.
+const utf8BOM = "\ufeff"
+
+// CSVOptions настройки чтения и записи CSV. Нулевое значение даёт
+// RFC 4180: разделитель ",", суммы в минимальных единицах.
+type CSVOptions struct {
+	// Comma разделитель полей, 0 означает ",". Русский Excel ждёт ";".
+	Comma rune
+	// FormattedAmounts записывает суммы как "123.45" (см. types.FormatMoney)
+	// и так же читает их.
+	FormattedAmounts bool
+	// BOM добавляет в начало файла метку UTF-8. При чтении метка
+	// пропускается всегда.
+	BOM bool
+}
+
+// CSVError указывает строку и столбец (с 1, в байтах) ошибки в CSV.
+type CSVError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *CSVError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *CSVError) Unwrap() error {
+	return e.Err
+}
+
+// WritePaymentsCSV записывает платежи (например, результат ExportAccountHistory
+// или FilterPayments) в CSV со строкой заголовка. Поля с разделителем,
+// кавычками или переводом строки берутся в кавычки по RFC 4180.
+func WritePaymentsCSV(w io.Writer, payments []types.Payment, opts CSVOptions) error {
+	comma, err := csvComma(opts)
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewWriter(w)
+	if opts.BOM {
+		_, err = buffered.WriteString(utf8BOM)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer := csv.NewWriter(buffered)
+	writer.Comma = comma
+	writer.UseCRLF = true
+
+	err = writer.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		currency := currencyOf(payment.Currency)
+		amount := strconv.FormatInt(int64(payment.Amount), 10)
+		if opts.FormattedAmounts {
+			amount = types.FormatMoney(payment.Amount, currency)
+		}
+		err = writer.Write([]string{
+			payment.ID,
+			strconv.FormatInt(payment.AccountID, 10),
+			amount,
+			string(currency),
+			string(payment.Category),
+			string(payment.Status),
+			payment.CounterpartID,
+			formatCSVTime(payment.CreatedAt),
+			formatCSVTime(payment.UpdatedAt),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	err = writer.Error()
+	if err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// ReadPaymentsCSV читает платежи, записанные WritePaymentsCSV с теми же
+// настройками. Ошибка в данных возвращается как *CSVError со строкой и столбцом.
+func ReadPaymentsCSV(r io.Reader, opts CSVOptions) ([]types.Payment, error) {
+	comma, err := csvComma(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(r)
+	if bom, err := buffered.Peek(len(utf8BOM)); err == nil && string(bom) == utf8BOM {
+		_, _ = buffered.Discard(len(utf8BOM))
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.Comma = comma
+	// число столбцов задаёт заголовок
+	reader.FieldsPerRecord = 0
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, &CSVError{Line: 1, Column: 1, Err: fmt.Errorf("%w: missing header", ErrInvalidRecord)}
+	}
+	if err != nil {
+		return nil, csvParseError(err)
+	}
+	if len(header) != len(csvHeader) && len(header) != csvLegacyColumns {
+		line, column := reader.FieldPos(0)
+		return nil, &CSVError{Line: line, Column: column, Err: fmt.Errorf("%w: header has %d columns, want %d", ErrInvalidRecord, len(header), len(csvHeader))}
+	}
+	for i, name := range csvHeader[:len(header)] {
+		if header[i] != name {
+			line, column := reader.FieldPos(i)
+			return nil, &CSVError{Line: line, Column: column, Err: fmt.Errorf("%w: header %q, want %q", ErrInvalidRecord, header[i], name)}
+		}
+	}
+
+	payments := []types.Payment{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return payments, nil
+		}
+		if err != nil {
+			return nil, csvParseError(err)
+		}
+
+		payment, field, err := parseCSVPayment(record, opts)
+		if err != nil {
+			line, column := reader.FieldPos(field)
+			return nil, &CSVError{Line: line, Column: column, Err: err}
+		}
+		payments = append(payments, payment)
+	}
+}
+
+// parseCSVPayment возвращает номер поля с ошибкой вместе с ошибкой.
+func parseCSVPayment(record []string, opts CSVOptions) (types.Payment, int, error) {
+	invalid := func(field int, format string, args ...interface{}) (types.Payment, int, error) {
+		return types.Payment{}, field, fmt.Errorf("%w: %s: %s", ErrInvalidRecord, csvHeader[field], fmt.Sprintf(format, args...))
+	}
+
+	if record[0] == "" {
+		return invalid(0, "empty")
+	}
+	accountID, err := strconv.ParseInt(record[1], 10, 64)
+	if err != nil || accountID <= 0 {
+		return invalid(1, "%q is not an account id", record[1])
+	}
+	currency, err := parseCurrency(record[3])
+	if err != nil {
+		return invalid(3, "%v", err)
+	}
+
+	var amount types.Money
+	if opts.FormattedAmounts {
+		amount, err = types.ParseMoneyIn(record[2], currency)
+	} else {
+		var minor int64
+		minor, err = strconv.ParseInt(record[2], 10, 64)
+		amount = types.Money(minor)
+	}
+	if err != nil {
+		return invalid(2, "%q is not an amount", record[2])
+	}
+	if amount <= 0 {
+		return invalid(2, "amount must be positive")
+	}
+
+	if record[4] == "" {
+		return invalid(4, "empty")
+	}
+	status := types.PaymentStatus(record[5])
+	if !isKnownStatus(status) {
+		return invalid(5, "unknown status %q", record[5])
+	}
+
+	payment := types.Payment{
+		ID:            record[0],
+		AccountID:     accountID,
+		Amount:        amount,
+		Category:      types.PaymentCategory(record[4]),
+		Status:        status,
+		CounterpartID: record[6],
+		Currency:      currency,
+	}
+	if len(record) == csvLegacyColumns {
+		return payment, 0, nil
+	}
+	payment.CreatedAt, err = parseCSVTime(record[7])
+	if err != nil {
+		return invalid(7, "%q is not a time", record[7])
+	}
+	payment.UpdatedAt, err = parseCSVTime(record[8])
+	if err != nil {
+		return invalid(8, "%q is not a time", record[8])
+	}
+	return payment, 0, nil
+}
+
+func formatCSVTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseCSVTime(field string) (time.Time, error) {
+	if field == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, field)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+func csvParseError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &CSVError{Line: parseErr.Line, Column: parseErr.Column, Err: fmt.Errorf("%w: %v", ErrInvalidRecord, parseErr.Err)}
+	}
+	return err
+}
+
+func csvComma(opts CSVOptions) (rune, error) {
+	if opts.Comma == 0 {
+		return ',', nil
+	}
+	if opts.Comma == '"' || opts.Comma == '\r' || opts.Comma == '\n' || opts.Comma == utf8.RuneError {
+		return 0, fmt.Errorf("invalid CSV delimiter %q", opts.Comma)
+	}
+	return opts.Comma, nil
+}
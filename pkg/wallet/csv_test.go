@@ -0,0 +1,97 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func TestWritePaymentsCSV_quoting(t *testing.T) {
+	payments := []types.Payment{
+		{ID: "p1", AccountID: 1, Amount: 12345, Category: `food; "fast"`, Status: types.PaymentStatusOk, Currency: types.CurrencyTJS,
+			CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC), UpdatedAt: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)},
+		{ID: "p2", AccountID: 1, Amount: 5, Category: "line\nbreak", Status: types.PaymentStatusInProgress, CounterpartID: "p3"},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WritePaymentsCSV(buf, payments, CSVOptions{Comma: ';', FormattedAmounts: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := "id;account_id;amount;currency;category;status;counterpart_id;created_at;updated_at\r\n" +
+		"p1;1;123.45;TJS;\"food; \"\"fast\"\"\";Ok;;2024-01-02T03:04:05.000000006Z;2024-01-02T03:04:05.000000006Z\r\n" +
+		"p2;1;0.05;TJS;\"line\r\nbreak\";INPROGRESS;p3;;\r\n"
+	if buf.String() != want {
+		t.Errorf("WritePaymentsCSV():\n%q\nwant\n%q", buf.String(), want)
+	}
+}
+
+func TestPaymentsCSV_roundTrip(t *testing.T) {
+	s, from, to := newTransferService(t)
+	_, _ = s.Pay(from.ID, 150, "food, drinks")
+	_, _ = s.Transfer(from.ID, to.Phone, 200)
+	history, _ := s.ExportAccountHistory(from.ID)
+
+	for _, opts := range []CSVOptions{{}, {Comma: ';', FormattedAmounts: true, BOM: true}, {Comma: '\t'}} {
+		buf := &bytes.Buffer{}
+		if err := WritePaymentsCSV(buf, history, opts); err != nil {
+			t.Fatal(err)
+		}
+		if opts.BOM && !strings.HasPrefix(buf.String(), utf8BOM) {
+			t.Errorf("WritePaymentsCSV(%+v): missing BOM", opts)
+		}
+
+		got, err := ReadPaymentsCSV(buf, opts)
+		if err != nil {
+			t.Fatalf("ReadPaymentsCSV(%+v): error = %v", opts, err)
+		}
+		if !reflect.DeepEqual(got, history) {
+			t.Errorf("ReadPaymentsCSV(%+v) = %v, want %v", opts, got, history)
+		}
+	}
+}
+
+func TestReadPaymentsCSV_errors(t *testing.T) {
+	const header = "id,account_id,amount,currency,category,status,counterpart_id\n"
+	tests := []struct {
+		name   string
+		data   string
+		opts   CSVOptions
+		line   int
+		column int
+	}{
+		{"empty", "", CSVOptions{}, 1, 1},
+		{"header", "id,account,amount,currency,category,status,counterpart_id\n", CSVOptions{}, 1, 4},
+		{"account id", header + "p1,1,100,TJS,auto,Ok,\np2,x,100,TJS,auto,Ok,\n", CSVOptions{}, 3, 4},
+		{"amount", header + "p1,1,1.5,TJS,auto,Ok,\n", CSVOptions{}, 2, 6},
+		{"formatted amount", header + "p1,1,1.555,TJS,auto,Ok,\n", CSVOptions{FormattedAmounts: true}, 2, 6},
+		{"negative amount", header + "p1,1,-100,TJS,auto,Ok,\n", CSVOptions{}, 2, 6},
+		{"currency", header + "p1,1,100,tjs,auto,Ok,\n", CSVOptions{}, 2, 10},
+		{"status", header + "p1,1,100,TJS,auto,DONE,\n", CSVOptions{}, 2, 19},
+		{"field count", header + "p1,1,100,TJS,auto,Ok\n", CSVOptions{}, 2, 1},
+		{"bare quote", header + "p1,1,100,TJS,a\"uto,Ok,\n", CSVOptions{}, 2, 15},
+		{"time", "id,account_id,amount,currency,category,status,counterpart_id,created_at,updated_at\n" +
+			"p1,1,100,TJS,auto,Ok,,yesterday,\n", CSVOptions{}, 2, 23},
+		{"header columns", "id,account_id,amount,currency,category,status,counterpart_id,created_at\n", CSVOptions{}, 1, 1},
+	}
+	for _, tt := range tests {
+		_, err := ReadPaymentsCSV(strings.NewReader(tt.data), tt.opts)
+
+		var csvErr *CSVError
+		if !errors.As(err, &csvErr) || !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("%s: ReadPaymentsCSV() must return CSVError, returned = %v", tt.name, err)
+			continue
+		}
+		if csvErr.Line != tt.line || csvErr.Column != tt.column {
+			t.Errorf("%s: ReadPaymentsCSV() error at %d:%d, want %d:%d (%v)", tt.name, csvErr.Line, csvErr.Column, tt.line, tt.column, err)
+		}
+	}
+
+	if _, err := ReadPaymentsCSV(strings.NewReader(header), CSVOptions{Comma: '"'}); err == nil {
+		t.Errorf("ReadPaymentsCSV(): must reject a quote as delimiter")
+	}
+}
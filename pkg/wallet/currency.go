@@ -0,0 +1,275 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// DefaultCurrency валюта счетов, зарегистрированных через RegisterAccount,
+// и записей из дампов, в которых валюта не указана.
+const DefaultCurrency = types.CurrencyTJS
+
+var ErrInvalidCurrency = errors.New("invalid currency code")
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+var ErrRateNotFound = errors.New("exchange rate not found")
+var ErrInvalidRate = errors.New("invalid exchange rate")
+
+// ErrMoneyOverflow возвращается, если сумма или баланс не помещаются в Money.
+var ErrMoneyOverflow = types.ErrMoneyOverflow
+
+// Rate курс обмена в виде дроби: сумма в валюте назначения равна
+// amount * Num / Den, обе суммы в минимальных единицах своих валют.
+// Дробь вместо float64 нужна, чтобы пересчёт был точным и воспроизводимым.
+type Rate struct {
+	Num int64
+	Den int64
+}
+
+// RateProvider источник курсов обмена.
+type RateProvider interface {
+	// Rate возвращает курс обмена from -> to или ErrRateNotFound.
+	Rate(from, to types.Currency) (Rate, error)
+}
+
+// RoundingMode правило округления при пересчёте в другую валюту.
+type RoundingMode int
+
+const (
+	// RoundDown отбрасывает остаток.
+	RoundDown RoundingMode = iota
+	// RoundUp добавляет минимальную единицу при любом остатке.
+	RoundUp
+	// RoundHalfEven округляет к ближайшему, ровно половину к чётному.
+	RoundHalfEven
+)
+
+// Convert пересчитывает положительную сумму по курсу с заданным округлением.
+// Если результат не помещается в Money, возвращает ErrMoneyOverflow.
+func Convert(amount types.Money, rate Rate, mode RoundingMode) (types.Money, error) {
+	if amount <= 0 {
+		return 0, ErrAmountMustBePositive
+	}
+	if rate.Num <= 0 || rate.Den <= 0 {
+		return 0, ErrInvalidRate
+	}
+
+	den := big.NewInt(rate.Den)
+	product := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(rate.Num))
+	quo, rem := new(big.Int).QuoRem(product, den, new(big.Int))
+	if rem.Sign() != 0 {
+		switch mode {
+		case RoundUp:
+			quo.Add(quo, big.NewInt(1))
+		case RoundHalfEven:
+			switch new(big.Int).Lsh(rem, 1).Cmp(den) {
+			case 1:
+				quo.Add(quo, big.NewInt(1))
+			case 0:
+				if quo.Bit(0) == 1 {
+					quo.Add(quo, big.NewInt(1))
+				}
+			}
+		}
+	}
+	if !quo.IsInt64() {
+		return 0, ErrMoneyOverflow
+	}
+	return types.Money(quo.Int64()), nil
+}
+
+// StaticRates курсы, заданные вручную. Если задан только обратный курс,
+// используется он, перевёрнутый. Безопасен для одновременного использования.
+type StaticRates struct {
+	mu    sync.RWMutex
+	rates map[[2]types.Currency]Rate
+}
+
+// NewStaticRates создаёт пустой набор курсов.
+func NewStaticRates() *StaticRates {
+	return &StaticRates{rates: make(map[[2]types.Currency]Rate)}
+}
+
+// Set задаёт курс from -> to.
+func (r *StaticRates) Set(from, to types.Currency, rate Rate) error {
+	if rate.Num <= 0 || rate.Den <= 0 {
+		return ErrInvalidRate
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rates[[2]types.Currency{from, to}] = rate
+	return nil
+}
+
+func (r *StaticRates) Rate(from, to types.Currency) (Rate, error) {
+	if from == to {
+		return Rate{Num: 1, Den: 1}, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if rate, ok := r.rates[[2]types.Currency{from, to}]; ok {
+		return rate, nil
+	}
+	if rate, ok := r.rates[[2]types.Currency{to, from}]; ok {
+		return Rate{Num: rate.Den, Den: rate.Num}, nil
+	}
+	return Rate{}, fmt.Errorf("%w: %s -> %s", ErrRateNotFound, from, to)
+}
+
+// SetRateProvider задаёт источник курсов для PayConverted и TransferConverted.
+func (s *Service) SetRateProvider(provider RateProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rates = provider
+}
+
+// RegisterAccountWithCurrency регистрирует счёт в заданной валюте.
+// Валюту счёта изменить нельзя.
+func (s *Service) RegisterAccountWithCurrency(phone types.Phone, currency types.Currency) (*types.Account, error) {
+	currency, err := parseCurrency(string(currency))
+	if err != nil {
+		return nil, err
+	}
+	return s.registerAccount(phone, currency)
+}
+
+// PayInCurrency как Pay, но сумма указана в валюте currency. Если она не
+// совпадает с валютой счёта, возвращает ErrCurrencyMismatch.
+func (s *Service) PayInCurrency(accountID int64, amount types.Money, currency types.Currency, category types.PaymentCategory) (*types.Payment, error) {
+	amount, err := s.amountForAccount(accountID, amount, currency, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.Pay(accountID, amount, category)
+}
+
+// PayConverted как PayInCurrency, но сумму в чужой валюте пересчитывает в
+// валюту счёта. При списании остаток округляется вверх (RoundUp), чтобы
+// округление не уменьшало сумму платежа. Платёж записывается в валюте счёта.
+func (s *Service) PayConverted(accountID int64, amount types.Money, currency types.Currency, category types.PaymentCategory) (*types.Payment, error) {
+	amount, err := s.amountForAccount(accountID, amount, currency, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.Pay(accountID, amount, category)
+}
+
+// TransferConverted как Transfer, но разрешает перевод на счёт в другой
+// валюте. amount указывается в валюте отправителя, получатель получает сумму,
+// пересчитанную с округлением вниз (RoundDown): округление никогда не создаёт
+// денег. Отмена такого перевода возвращает обеим сторонам исходные суммы.
+func (s *Service) TransferConverted(fromAccountID int64, toPhone types.Phone, amount types.Money) (*types.Payment, error) {
+	return s.transfer(fromAccountID, toPhone, amount, true, "")
+}
+
+// amountForAccount переводит сумму в валюту счёта.
+func (s *Service) amountForAccount(accountID int64, amount types.Money, currency types.Currency, convert bool) (types.Money, error) {
+	if amount <= 0 {
+		return 0, ErrAmountMustBePositive
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, err := s.storage().Accounts().ByID(accountID)
+	if err != nil {
+		return 0, err
+	}
+	if currencyOf(currency) == currencyOf(account.Currency) {
+		return amount, nil
+	}
+	if !convert {
+		return 0, ErrCurrencyMismatch
+	}
+	return s.convert(amount, currencyOf(currency), currencyOf(account.Currency), RoundUp)
+}
+
+// convert пересчитывает сумму по курсу из RateProvider, вызывать под mu.RLock.
+func (s *Service) convert(amount types.Money, from, to types.Currency, mode RoundingMode) (types.Money, error) {
+	if s.rates == nil {
+		return 0, fmt.Errorf("%w: %s -> %s", ErrRateNotFound, from, to)
+	}
+	rate, err := s.rates.Rate(from, to)
+	if err != nil {
+		return 0, err
+	}
+	converted, err := Convert(amount, rate, mode)
+	if err != nil {
+		return 0, err
+	}
+	if converted <= 0 {
+		// сумма меньше минимальной единицы валюты назначения
+		return 0, ErrAmountMustBePositive
+	}
+	return converted, nil
+}
+
+// postMove проводит движение денег между кошельками по платежам сторон.
+// Если валюты разные, деньги проходят через счета обмена exchange:<валюта>
+// двумя проводками, и каждая из них сбалансирована в своей валюте. Обе
+// проводки проверяются до записи любой из них, поэтому ошибка второй не
+// оставляет в книге половину движения.
+func (s *Service) postMove(kind types.EntryKind, paymentID string, from, to *types.Payment) error {
+	if currencyOf(from.Currency) == currencyOf(to.Currency) {
+		return s.post(kind, paymentID,
+			types.Posting{Account: walletLedgerAccount(from.AccountID), Amount: -from.Amount},
+			types.Posting{Account: walletLedgerAccount(to.AccountID), Amount: to.Amount},
+		)
+	}
+	if from.Amount <= 0 || to.Amount <= 0 {
+		return ErrAmountMustBePositive
+	}
+
+	out, err := s.prepareEntry(kind, paymentID,
+		types.Posting{Account: walletLedgerAccount(from.AccountID), Amount: -from.Amount},
+		types.Posting{Account: exchangeLedgerAccount(currencyOf(from.Currency)), Amount: from.Amount},
+	)
+	if err != nil {
+		return err
+	}
+	in, err := s.prepareEntry(kind, paymentID,
+		types.Posting{Account: exchangeLedgerAccount(currencyOf(to.Currency)), Amount: -to.Amount},
+		types.Posting{Account: walletLedgerAccount(to.AccountID), Amount: to.Amount},
+	)
+	if err != nil {
+		return err
+	}
+	return s.commitEntries(out, in)
+}
+
+func exchangeLedgerAccount(currency types.Currency) types.LedgerAccount {
+	return types.LedgerAccount("exchange:" + string(currency))
+}
+
+// currencyOf возвращает DefaultCurrency для записей, созданных без валюты.
+func currencyOf(currency types.Currency) types.Currency {
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+func isDefaultCurrency(currency types.Currency) bool {
+	return currencyOf(currency) == DefaultCurrency
+}
+
+// parseCurrency проверяет, что код состоит из трёх заглавных латинских букв.
+func parseCurrency(code string) (types.Currency, error) {
+	if len(code) != 3 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+		}
+	}
+	return types.Currency(code), nil
+}
@@ -0,0 +1,220 @@
+package wallet
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func newCurrencyService(t *testing.T) (*Service, *types.Account, *types.Account) {
+	t.Helper()
+
+	s := &Service{}
+	rates := NewStaticRates()
+	// 1 USD = 10.95 TJS
+	if err := rates.Set(types.CurrencyUSD, types.CurrencyTJS, Rate{Num: 1095, Den: 100}); err != nil {
+		t.Fatal(err)
+	}
+	s.SetRateProvider(rates)
+
+	somoni, _ := s.RegisterAccount("+992900000001")
+	dollar, err := s.RegisterAccountWithCurrency("+992900000002", types.CurrencyUSD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Deposit(somoni.ID, 100_000)
+	_ = s.Deposit(dollar.ID, 10_000)
+	return s, somoni, dollar
+}
+
+func TestConvert_rounding(t *testing.T) {
+	tests := []struct {
+		amount types.Money
+		rate   Rate
+		mode   RoundingMode
+		want   types.Money
+	}{
+		{100, Rate{Num: 1095, Den: 100}, RoundDown, 1_095},
+		{1, Rate{Num: 100, Den: 1095}, RoundDown, 0},
+		{1, Rate{Num: 100, Den: 1095}, RoundUp, 1},
+		{5, Rate{Num: 1, Den: 2}, RoundHalfEven, 2},
+		{7, Rate{Num: 1, Den: 2}, RoundHalfEven, 4},
+		{8, Rate{Num: 1, Den: 3}, RoundHalfEven, 3},
+		{7, Rate{Num: 1, Den: 3}, RoundHalfEven, 2},
+	}
+	for _, tt := range tests {
+		got, err := Convert(tt.amount, tt.rate, tt.mode)
+		if err != nil {
+			t.Fatalf("Convert(%v, %v, %v): error = %v", tt.amount, tt.rate, tt.mode, err)
+		}
+		if got != tt.want {
+			t.Errorf("Convert(%v, %v, %v) = %v, want %v", tt.amount, tt.rate, tt.mode, got, tt.want)
+		}
+	}
+
+	if _, err := Convert(1<<62, Rate{Num: 4, Den: 1}, RoundDown); err != ErrMoneyOverflow {
+		t.Errorf("Convert(): must return ErrMoneyOverflow, returned = %v", err)
+	}
+	if _, err := Convert(100, Rate{Num: 1, Den: 0}, RoundDown); err != ErrInvalidRate {
+		t.Errorf("Convert(): must return ErrInvalidRate, returned = %v", err)
+	}
+}
+
+func TestStaticRates_Rate(t *testing.T) {
+	rates := NewStaticRates()
+	_ = rates.Set(types.CurrencyUSD, types.CurrencyRUB, Rate{Num: 90, Den: 1})
+
+	if rate, _ := rates.Rate(types.CurrencyRUB, types.CurrencyUSD); rate != (Rate{Num: 1, Den: 90}) {
+		t.Errorf("Rate(): inverse rate = %v", rate)
+	}
+	if rate, _ := rates.Rate(types.CurrencyTJS, types.CurrencyTJS); rate != (Rate{Num: 1, Den: 1}) {
+		t.Errorf("Rate(): same currency rate = %v", rate)
+	}
+	if _, err := rates.Rate(types.CurrencyTJS, types.CurrencyUSD); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("Rate(): must return ErrRateNotFound, returned = %v", err)
+	}
+	if err := rates.Set(types.CurrencyTJS, types.CurrencyUSD, Rate{Num: -1, Den: 1}); err != ErrInvalidRate {
+		t.Errorf("Set(): must return ErrInvalidRate, returned = %v", err)
+	}
+}
+
+func TestService_RegisterAccountWithCurrency_invalid(t *testing.T) {
+	s := &Service{}
+	for _, code := range []types.Currency{"", "usd", "DOLLAR"} {
+		if _, err := s.RegisterAccountWithCurrency("+992900000001", code); !errors.Is(err, ErrInvalidCurrency) {
+			t.Errorf("RegisterAccountWithCurrency(%q): must return ErrInvalidCurrency, returned = %v", code, err)
+		}
+	}
+}
+
+func TestService_PayInCurrency(t *testing.T) {
+	s, somoni, dollar := newCurrencyService(t)
+
+	payment, err := s.PayInCurrency(dollar.ID, 500, types.CurrencyUSD, "food")
+	if err != nil {
+		t.Fatalf("PayInCurrency(): error = %v", err)
+	}
+	if payment.Currency != types.CurrencyUSD {
+		t.Errorf("PayInCurrency(): payment currency = %v", payment.Currency)
+	}
+	if _, err := s.PayInCurrency(somoni.ID, 500, types.CurrencyUSD, "food"); err != ErrCurrencyMismatch {
+		t.Errorf("PayInCurrency(): must return ErrCurrencyMismatch, returned = %v", err)
+	}
+	assertBalance(t, s, dollar.ID, 9_500)
+	assertBalance(t, s, somoni.ID, 100_000)
+}
+
+func TestService_PayConverted(t *testing.T) {
+	s, somoni, _ := newCurrencyService(t)
+
+	// 0.01 USD = 0.1095 TJS, списание округляется вверх до 0.11
+	payment, err := s.PayConverted(somoni.ID, 1, types.CurrencyUSD, "food")
+	if err != nil {
+		t.Fatalf("PayConverted(): error = %v", err)
+	}
+	if payment.Amount != 11 || payment.Currency != types.CurrencyTJS {
+		t.Errorf("PayConverted(): payment = %v %v, want 11 TJS", payment.Amount, payment.Currency)
+	}
+	assertBalance(t, s, somoni.ID, 99_989)
+
+	if _, err := s.PayConverted(somoni.ID, 100, types.CurrencyRUB, "food"); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("PayConverted(): must return ErrRateNotFound, returned = %v", err)
+	}
+}
+
+func TestService_TransferConverted(t *testing.T) {
+	s, somoni, dollar := newCurrencyService(t)
+
+	if _, err := s.Transfer(somoni.ID, dollar.Phone, 1_000); err != ErrCurrencyMismatch {
+		t.Errorf("Transfer(): must return ErrCurrencyMismatch, returned = %v", err)
+	}
+
+	// 10.00 TJS = 0.913... USD, зачисление округляется вниз до 0.91
+	out, err := s.TransferConverted(somoni.ID, dollar.Phone, 1_000)
+	if err != nil {
+		t.Fatalf("TransferConverted(): error = %v", err)
+	}
+	in, _ := s.FindPaymentByID(out.CounterpartID)
+	if out.Amount != 1_000 || out.Currency != types.CurrencyTJS || in.Amount != 91 || in.Currency != types.CurrencyUSD {
+		t.Errorf("TransferConverted(): out = %v %v, in = %v %v", out.Amount, out.Currency, in.Amount, in.Currency)
+	}
+	assertBalance(t, s, somoni.ID, 99_000)
+	assertBalance(t, s, dollar.ID, 10_091)
+
+	discrepancies, err := s.VerifyLedger()
+	if err != nil || len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v, error = %v", discrepancies, err)
+	}
+
+	// отмена возвращает исходные суммы без повторного пересчёта
+	if err := s.Reject(out.ID); err != nil {
+		t.Fatalf("Reject(): error = %v", err)
+	}
+	assertBalance(t, s, somoni.ID, 100_000)
+	assertBalance(t, s, dollar.ID, 10_000)
+}
+
+func TestService_TransferConverted_overflow(t *testing.T) {
+	s, somoni, dollar := newCurrencyService(t)
+	// зачисление 0.91 USD переполнит кошелёк получателя
+	if err := s.Deposit(dollar.ID, math.MaxInt64-10_050); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := s.storage().Ledger().All()
+
+	if _, err := s.TransferConverted(somoni.ID, dollar.Phone, 1_000); !errors.Is(err, types.ErrMoneyOverflow) {
+		t.Fatalf("TransferConverted(): must return ErrMoneyOverflow, returned = %v", err)
+	}
+	// списание не проведено без зачисления
+	if after, _ := s.storage().Ledger().All(); len(after) != len(before) {
+		t.Errorf("TransferConverted(): %d ledger entries appended despite the overflow", len(after)-len(before))
+	}
+	assertBalance(t, s, somoni.ID, 100_000)
+	discrepancies, err := s.VerifyLedger()
+	if err != nil || len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v, error = %v", discrepancies, err)
+	}
+}
+
+func TestService_Currency_survivesExportImport(t *testing.T) {
+	s, _, dollar := newCurrencyService(t)
+	payment, _ := s.PayInCurrency(dollar.ID, 500, types.CurrencyUSD, "food")
+	favorite, _ := s.FavoritePayment(payment.ID, "lunch")
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	account, _ := imported.FindAccountByID(dollar.ID)
+	gotPayment, _ := imported.FindPaymentByID(payment.ID)
+	gotFavorite, _ := imported.FindFavoriteByID(favorite.ID)
+	if account.Currency != types.CurrencyUSD || gotPayment.Currency != types.CurrencyUSD || gotFavorite.Currency != types.CurrencyUSD {
+		t.Errorf("Import(): currencies = %v, %v, %v", account.Currency, gotPayment.Currency, gotFavorite.Currency)
+	}
+	if _, err := imported.PayFromFavorite(favorite.ID); err != nil {
+		t.Errorf("PayFromFavorite(): error = %v", err)
+	}
+}
+
+func TestParse_currencyDefaults(t *testing.T) {
+	account, err := parseAccount("1;+992900000001;100")
+	if err != nil || account.Currency != DefaultCurrency {
+		t.Errorf("parseAccount(): currency = %v, error = %v", account.Currency, err)
+	}
+	payment, err := parsePayment("p1;1;100;auto;INPROGRESS;;USD")
+	if err != nil || payment.Currency != types.CurrencyUSD || payment.CounterpartID != "" {
+		t.Errorf("parsePayment(): payment = %v, error = %v", payment, err)
+	}
+	if got := formatPayment(payment); got != "p1;1;100;auto;INPROGRESS;;USD" {
+		t.Errorf("formatPayment() = %q", got)
+	}
+	if _, err := parseFavorite("f1;1;name;100;auto;usd"); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("parseFavorite(): must return ErrInvalidRecord, returned = %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// ErrInvalidRecord возвращается, если строку дампа не удалось разобрать.
+var ErrInvalidRecord = errors.New("invalid dump record")
+
+// Строки дампа: поля разделены ";", одна запись на строку (без "\n").
+// Разделители и переводы строк внутри полей экранируются (см. escapeField).
+// Стороны проводки записываются в последнем поле как "счёт=сумма" через ",".
+// Валюта пишется последним полем и только если она отличается от
+// DefaultCurrency, поэтому старые дампы читаются как дампы в DefaultCurrency.
+// Время создания и изменения записи (наносекунды Unix) дописывается после
+// валюты только у записей, где оно известно; тогда валюта пишется всегда.
+// Записи старых дампов читаются с нулевым временем.
+
+// hasTimes сообщает, нужно ли писать поля времени.
+func hasTimes(created, updated time.Time) bool {
+	return !created.IsZero() || !updated.IsZero()
+}
+
+// formatTime пишет время в наносекундах Unix, нулевое время — пустым полем.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func parseTime(field string) (time.Time, error) {
+	if field == "" {
+		return time.Time{}, nil
+	}
+	nanos, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+// parseTimes разбирает пару полей "создана;изменена".
+func parseTimes(created, updated string) (time.Time, time.Time, error) {
+	createdAt, err := parseTime(created)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("created: %v", err)
+	}
+	updatedAt, err := parseTime(updated)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("updated: %v", err)
+	}
+	return createdAt, updatedAt, nil
+}
+
+func formatAccount(account types.Account) string {
+	line := strconv.FormatInt(int64(account.ID), 10) + ";" +
+		escapeField(string(account.Phone)) + ";" +
+		strconv.FormatInt(int64(account.Balance), 10)
+	if hasTimes(account.CreatedAt, account.UpdatedAt) {
+		return line + ";" + string(currencyOf(account.Currency)) + ";" +
+			formatTime(account.CreatedAt) + ";" + formatTime(account.UpdatedAt)
+	}
+	if !isDefaultCurrency(account.Currency) {
+		line += ";" + string(account.Currency)
+	}
+	return line
+}
+
+// formatPayment добавляет шестое поле только для переводов (или пустое,
+// если нужна валюта), поэтому строки обычных платежей совпадают со старым форматом.
+func formatPayment(payment types.Payment) string {
+	line := escapeField(payment.ID) + ";" +
+		strconv.FormatInt(int64(payment.AccountID), 10) + ";" +
+		strconv.FormatInt(int64(payment.Amount), 10) + ";" +
+		escapeField(string(payment.Category)) + ";" +
+		escapeField(string(payment.Status))
+	if hasTimes(payment.CreatedAt, payment.UpdatedAt) {
+		return line + ";" + escapeField(payment.CounterpartID) + ";" +
+			string(currencyOf(payment.Currency)) + ";" +
+			formatTime(payment.CreatedAt) + ";" + formatTime(payment.UpdatedAt)
+	}
+	if payment.CounterpartID != "" || !isDefaultCurrency(payment.Currency) {
+		line += ";" + escapeField(payment.CounterpartID)
+	}
+	if !isDefaultCurrency(payment.Currency) {
+		line += ";" + string(payment.Currency)
+	}
+	return line
+}
+
+func formatFavorite(favorite types.Favorite) string {
+	line := escapeField(favorite.ID) + ";" +
+		strconv.FormatInt(int64(favorite.AccountID), 10) + ";" +
+		escapeField(favorite.Name) + ";" +
+		strconv.FormatInt(int64(favorite.Amount), 10) + ";" +
+		escapeField(string(favorite.Category))
+	if hasTimes(favorite.CreatedAt, favorite.UpdatedAt) {
+		return line + ";" + string(currencyOf(favorite.Currency)) + ";" +
+			formatTime(favorite.CreatedAt) + ";" + formatTime(favorite.UpdatedAt)
+	}
+	if !isDefaultCurrency(favorite.Currency) {
+		line += ";" + string(favorite.Currency)
+	}
+	return line
+}
+
+func parseAccount(line string) (types.Account, error) {
+	fields := splitFields(line)
+	if len(fields) != 3 && len(fields) != 4 && len(fields) != 6 {
+		return types.Account{}, fmt.Errorf("%w: account %q: want 3, 4 or 6 fields, got %d", ErrInvalidRecord, line, len(fields))
+	}
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return types.Account{}, fmt.Errorf("%w: account %q: id: %v", ErrInvalidRecord, line, err)
+	}
+	balance, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return types.Account{}, fmt.Errorf("%w: account %q: balance: %v", ErrInvalidRecord, line, err)
+	}
+	currency := DefaultCurrency
+	if len(fields) >= 4 {
+		currency, err = parseCurrency(fields[3])
+		if err != nil {
+			return types.Account{}, fmt.Errorf("%w: account %q: %v", ErrInvalidRecord, line, err)
+		}
+	}
+	account := types.Account{
+		ID:       id,
+		Phone:    types.Phone(fields[1]),
+		Balance:  types.Money(balance),
+		Currency: currency,
+	}
+	if len(fields) == 6 {
+		account.CreatedAt, account.UpdatedAt, err = parseTimes(fields[4], fields[5])
+		if err != nil {
+			return types.Account{}, fmt.Errorf("%w: account %q: %v", ErrInvalidRecord, line, err)
+		}
+	}
+	return account, nil
+}
+
+func parsePayment(line string) (types.Payment, error) {
+	fields := splitFields(line)
+	if len(fields) < 5 || len(fields) > 7 && len(fields) != 9 {
+		return types.Payment{}, fmt.Errorf("%w: payment %q: want 5 to 7 or 9 fields, got %d", ErrInvalidRecord, line, len(fields))
+	}
+	accountID, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return types.Payment{}, fmt.Errorf("%w: payment %q: account id: %v", ErrInvalidRecord, line, err)
+	}
+	amount, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return types.Payment{}, fmt.Errorf("%w: payment %q: amount: %v", ErrInvalidRecord, line, err)
+	}
+	payment := types.Payment{
+		ID:        fields[0],
+		AccountID: accountID,
+		Amount:    types.Money(amount),
+		Category:  types.PaymentCategory(fields[3]),
+		Status:    types.PaymentStatus(fields[4]),
+		Currency:  DefaultCurrency,
+	}
+	if len(fields) >= 6 {
+		payment.CounterpartID = fields[5]
+	}
+	if len(fields) >= 7 {
+		payment.Currency, err = parseCurrency(fields[6])
+		if err != nil {
+			return types.Payment{}, fmt.Errorf("%w: payment %q: %v", ErrInvalidRecord, line, err)
+		}
+	}
+	if len(fields) == 9 {
+		payment.CreatedAt, payment.UpdatedAt, err = parseTimes(fields[7], fields[8])
+		if err != nil {
+			return types.Payment{}, fmt.Errorf("%w: payment %q: %v", ErrInvalidRecord, line, err)
+		}
+	}
+	return payment, nil
+}
+
+func parseFavorite(line string) (types.Favorite, error) {
+	fields := splitFields(line)
+	if len(fields) != 5 && len(fields) != 6 && len(fields) != 8 {
+		return types.Favorite{}, fmt.Errorf("%w: favorite %q: want 5, 6 or 8 fields, got %d", ErrInvalidRecord, line, len(fields))
+	}
+	accountID, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return types.Favorite{}, fmt.Errorf("%w: favorite %q: account id: %v", ErrInvalidRecord, line, err)
+	}
+	amount, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return types.Favorite{}, fmt.Errorf("%w: favorite %q: amount: %v", ErrInvalidRecord, line, err)
+	}
+	currency := DefaultCurrency
+	if len(fields) >= 6 {
+		currency, err = parseCurrency(fields[5])
+		if err != nil {
+			return types.Favorite{}, fmt.Errorf("%w: favorite %q: %v", ErrInvalidRecord, line, err)
+		}
+	}
+	favorite := types.Favorite{
+		ID:        fields[0],
+		AccountID: accountID,
+		Name:      fields[2],
+		Amount:    types.Money(amount),
+		Category:  types.PaymentCategory(fields[4]),
+		Currency:  currency,
+	}
+	if len(fields) == 8 {
+		favorite.CreatedAt, favorite.UpdatedAt, err = parseTimes(fields[6], fields[7])
+		if err != nil {
+			return types.Favorite{}, fmt.Errorf("%w: favorite %q: %v", ErrInvalidRecord, line, err)
+		}
+	}
+	return favorite, nil
+}
+
+func formatEntry(entry types.LedgerEntry) string {
+	postings := make([]string, 0, len(entry.Postings))
+	for _, posting := range entry.Postings {
+		postings = append(postings, escapePostingAccount(posting.Account)+"="+strconv.FormatInt(int64(posting.Amount), 10))
+	}
+	return escapeField(entry.ID) + ";" +
+		escapeField(string(entry.Kind)) + ";" +
+		escapeField(entry.PaymentID) + ";" +
+		strings.Join(postings, ",")
+}
+
+func parseEntry(line string) (types.LedgerEntry, error) {
+	fields := strings.Split(line, ";")
+	if len(fields) != 4 {
+		return types.LedgerEntry{}, fmt.Errorf("%w: entry %q: want 4 fields, got %d", ErrInvalidRecord, line, len(fields))
+	}
+	entry := types.LedgerEntry{
+		ID:        unescapeField(fields[0]),
+		Kind:      types.EntryKind(unescapeField(fields[1])),
+		PaymentID: unescapeField(fields[2]),
+	}
+	for _, posting := range strings.Split(fields[3], ",") {
+		i := strings.LastIndex(posting, "=")
+		if i < 0 {
+			return types.LedgerEntry{}, fmt.Errorf("%w: entry %q: posting %q", ErrInvalidRecord, line, posting)
+		}
+		amount, err := strconv.ParseInt(posting[i+1:], 10, 64)
+		if err != nil {
+			return types.LedgerEntry{}, fmt.Errorf("%w: entry %q: amount: %v", ErrInvalidRecord, line, err)
+		}
+		entry.Postings = append(entry.Postings, types.Posting{
+			Account: types.LedgerAccount(unescapeField(posting[:i])),
+			Amount:  types.Money(amount),
+		})
+	}
+	return entry, nil
+}
+
+// formatStatusChange хранит время в наносекундах Unix, чтобы не терять точность.
+func formatStatusChange(change types.PaymentStatusChange) string {
+	return escapeField(change.PaymentID) + ";" +
+		escapeField(string(change.From)) + ";" +
+		escapeField(string(change.To)) + ";" +
+		strconv.FormatInt(change.At.UnixNano(), 10)
+}
+
+func parseStatusChange(line string) (types.PaymentStatusChange, error) {
+	fields := splitFields(line)
+	if len(fields) != 4 {
+		return types.PaymentStatusChange{}, fmt.Errorf("%w: status %q: want 4 fields, got %d", ErrInvalidRecord, line, len(fields))
+	}
+	at, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return types.PaymentStatusChange{}, fmt.Errorf("%w: status %q: time: %v", ErrInvalidRecord, line, err)
+	}
+	return types.PaymentStatusChange{
+		PaymentID: fields[0],
+		From:      types.PaymentStatus(fields[1]),
+		To:        types.PaymentStatus(fields[2]),
+		At:        time.Unix(0, at).UTC(),
+	}, nil
+}
+
+// formatIdempotencyRecord хранит срок действия ключа в наносекундах Unix.
+func formatIdempotencyRecord(record types.IdempotencyRecord) string {
+	return escapeField(record.Key) + ";" +
+		escapeField(record.Request) + ";" +
+		escapeField(record.PaymentID) + ";" +
+		escapeField(record.Err) + ";" +
+		strconv.FormatInt(record.ExpiresAt.UnixNano(), 10)
+}
+
+func parseIdempotencyRecord(line string) (types.IdempotencyRecord, error) {
+	fields := splitFields(line)
+	if len(fields) != 5 {
+		return types.IdempotencyRecord{}, fmt.Errorf("%w: key %q: want 5 fields, got %d", ErrInvalidRecord, line, len(fields))
+	}
+	expires, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return types.IdempotencyRecord{}, fmt.Errorf("%w: key %q: expires: %v", ErrInvalidRecord, line, err)
+	}
+	return types.IdempotencyRecord{
+		Key:       fields[0],
+		Request:   fields[1],
+		PaymentID: fields[2],
+		Err:       fields[3],
+		ExpiresAt: time.Unix(0, expires).UTC(),
+	}, nil
+}
@@ -0,0 +1,331 @@
+package wallet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// DefaultEventBuffer размер очереди воркера подписки по умолчанию.
+const DefaultEventBuffer = 64
+
+// Event событие изменения сервиса. Конкретный тип — одно из AccountRegistered,
+// Deposited, PaymentCreated, PaymentRejected, PaymentRepeated, FavoriteCreated;
+// события передаются по значению, обработчик может их хранить.
+type Event interface {
+	Header() EventHeader
+	withSeq(seq uint64) Event
+}
+
+// EventHeader общие поля событий.
+type EventHeader struct {
+	// Seq номер события в сервисе. Номера растут без пропусков, пока есть
+	// подписчики, поэтому пропуск в номерах означает отброшенное событие.
+	Seq       uint64
+	AccountID int64
+	At        time.Time
+}
+
+func (h EventHeader) Header() EventHeader {
+	return h
+}
+
+// AccountRegistered зарегистрирован счёт.
+type AccountRegistered struct {
+	EventHeader
+	Account types.Account
+}
+
+// Deposited на счёт зачислены деньги, Balance — баланс после зачисления.
+type Deposited struct {
+	EventHeader
+	Amount   types.Money
+	Currency types.Currency
+	Balance  types.Money
+}
+
+// PaymentCreated создан платёж. Перевод создаёт два платежа, у каждой
+// стороны своё событие.
+type PaymentCreated struct {
+	EventHeader
+	Payment types.Payment
+}
+
+// PaymentRejected платёж отменён, Payment — платёж с новым статусом.
+// Отмена перевода отменяет оба его платежа.
+type PaymentRejected struct {
+	EventHeader
+	From    types.PaymentStatus
+	Payment types.Payment
+}
+
+// PaymentRepeated платёж создан повтором платежа OriginalID. Идёт сразу
+// после PaymentCreated того же платежа.
+type PaymentRepeated struct {
+	EventHeader
+	OriginalID string
+	Payment    types.Payment
+}
+
+// FavoriteCreated платёж добавлен в избранное.
+type FavoriteCreated struct {
+	EventHeader
+	Favorite types.Favorite
+}
+
+func (e AccountRegistered) withSeq(seq uint64) Event { e.Seq = seq; return e }
+func (e Deposited) withSeq(seq uint64) Event         { e.Seq = seq; return e }
+func (e PaymentCreated) withSeq(seq uint64) Event    { e.Seq = seq; return e }
+func (e PaymentRejected) withSeq(seq uint64) Event   { e.Seq = seq; return e }
+func (e PaymentRepeated) withSeq(seq uint64) Event   { e.Seq = seq; return e }
+func (e FavoriteCreated) withSeq(seq uint64) Event   { e.Seq = seq; return e }
+
+// EventHandler обрабатывает события подписки.
+type EventHandler func(event Event)
+
+// OverflowPolicy что делать с событием, если очередь воркера подписки полна.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock изменение сервиса ждёт, пока в очереди освободится место.
+	// Обработчик такой подписки может читать сервис, но не должен его менять:
+	// его изменение ждало бы рассылки, которая ждёт самого обработчика.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest отбрасывает новое событие.
+	OverflowDropNewest
+	// OverflowDropOldest отбрасывает самое старое событие в очереди.
+	OverflowDropOldest
+)
+
+// SubscribeOptions настройки подписки.
+type SubscribeOptions struct {
+	// Buffer размер очереди каждого воркера, <= 0 — DefaultEventBuffer.
+	Buffer int
+	// Workers сколько обработчиков работает параллельно, <= 0 — один.
+	// События одного счёта всегда попадают в один воркер и приходят в
+	// порядке изменений счёта.
+	Workers int
+	// Overflow поведение при полной очереди, по умолчанию OverflowBlock.
+	Overflow OverflowPolicy
+}
+
+// Subscription подписка на события сервиса, см. Service.Subscribe.
+type Subscription struct {
+	dropped uint64 // atomic, первое поле ради выравнивания на 32-битных платформах
+
+	bus       *eventBus
+	handler   EventHandler
+	overflow  OverflowPolicy
+	queues    []chan Event
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// eventBus подписчики сервиса и события, ещё не разосланные им.
+//
+// Изменение записывает событие в outbox под блокировками, которые
+// упорядочивают изменения счёта, а рассылает после их снятия (flushEvents),
+// поэтому ожидание места в очереди не держит блокировки сервиса.
+// Рассылка идёт по одной и в порядке outbox.
+type eventBus struct {
+	mu     sync.Mutex
+	subs   []*Subscription // заменяется целиком: outbox и рассылка держат копии без mu
+	seq    uint64
+	outbox []outboxEntry
+
+	dispatchMu sync.Mutex
+}
+
+// outboxEntry событие и подписчики на момент изменения: подписка,
+// оформленная после изменения, но до рассылки, его не получает.
+type outboxEntry struct {
+	event Event
+	subs  []*Subscription
+}
+
+// Subscribe подписывает handler на события изменений, сделанных после
+// возврата из Subscribe. Импорт и слияние дампов событий не создают, повтор
+// операции с тем же ключом идемпотентности — тоже.
+//
+// События доставляются асинхронно: каждый воркер подписки вызывает handler
+// последовательно для событий из своей очереди.
+func (s *Service) Subscribe(handler EventHandler, opts SubscribeOptions) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultEventBuffer
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+
+	sub := &Subscription{
+		bus:      &s.events,
+		handler:  handler,
+		overflow: opts.Overflow,
+		queues:   make([]chan Event, opts.Workers),
+		done:     make(chan struct{}),
+	}
+	for i := range sub.queues {
+		sub.queues[i] = make(chan Event, opts.Buffer)
+		sub.wg.Add(1)
+		go sub.work(sub.queues[i])
+	}
+
+	b := &s.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := make([]*Subscription, 0, len(b.subs)+1)
+	b.subs = append(append(subs, b.subs...), sub)
+	return sub
+}
+
+// Close отменяет подписку, доставляет события, уже стоящие в очередях, и
+// ждёт завершения обработчиков. Из обработчика этой подписки не вызывать.
+func (sub *Subscription) Close() {
+	sub.closeOnce.Do(func() {
+		b := sub.bus
+		b.mu.Lock()
+		subs := make([]*Subscription, 0, len(b.subs))
+		for _, other := range b.subs {
+			if other != sub {
+				subs = append(subs, other)
+			}
+		}
+		b.subs = subs
+		b.mu.Unlock()
+
+		close(sub.done)
+	})
+	sub.wg.Wait()
+}
+
+// Dropped сколько событий отброшено из-за полной очереди.
+func (sub *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+func (sub *Subscription) work(queue chan Event) {
+	defer sub.wg.Done()
+
+	for {
+		select {
+		case event := <-queue:
+			sub.handler(event)
+		case <-sub.done:
+			for {
+				select {
+				case event := <-queue:
+					sub.handler(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// send кладёт событие в очередь воркера его счёта. Вызывается только из
+// рассылки, поэтому других отправителей в очередь нет. Подписке, закрытой
+// после изменения, событие уже не нужно.
+func (sub *Subscription) send(event Event) {
+	select {
+	case <-sub.done:
+		return
+	default:
+	}
+
+	queue := sub.queues[uint64(event.Header().AccountID)%uint64(len(sub.queues))]
+	switch sub.overflow {
+	case OverflowDropNewest:
+		select {
+		case queue <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- event:
+				return
+			default:
+			}
+			select {
+			case <-queue:
+				atomic.AddUint64(&sub.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case queue <- event:
+		case <-sub.done:
+		}
+	}
+}
+
+// record ставит событие в outbox. Вызывать под блокировкой, которая
+// упорядочивает изменения счёта события, и до снятия блокировок сервиса
+// отложить flushEvents.
+func (b *eventBus) record(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.subs) == 0 {
+		return
+	}
+	b.seq++
+	b.outbox = append(b.outbox, outboxEntry{event: event.withSeq(b.seq), subs: b.subs})
+}
+
+// flushEvents рассылает события из outbox подписчикам, записанным вместе с
+// ними. Вызывать без блокировок сервиса: при OverflowBlock рассылка ждёт
+// обработчиков.
+func (s *Service) flushEvents() {
+	b := &s.events
+
+	b.mu.Lock()
+	pending := len(b.outbox)
+	b.mu.Unlock()
+	if pending == 0 {
+		return
+	}
+
+	b.dispatchMu.Lock()
+	defer b.dispatchMu.Unlock()
+
+	for {
+		b.mu.Lock()
+		entries := b.outbox
+		b.outbox = nil
+		b.mu.Unlock()
+		if len(entries) == 0 {
+			return
+		}
+
+		for _, entry := range entries {
+			for _, sub := range entry.subs {
+				sub.send(entry.event)
+			}
+		}
+	}
+}
+
+// recordPaymentCreated записывает PaymentCreated, а для повтора ещё и
+// PaymentRepeated. Вызывать под блокировкой счёта платежа.
+func (s *Service) recordPaymentCreated(payment *types.Payment, repeatOf string) {
+	header := EventHeader{AccountID: payment.AccountID, At: payment.CreatedAt}
+	s.events.record(PaymentCreated{EventHeader: header, Payment: *payment})
+	if repeatOf != "" {
+		s.events.record(PaymentRepeated{EventHeader: header, OriginalID: repeatOf, Payment: *payment})
+	}
+}
+
+// recordPaymentRejected записывает PaymentRejected. Вызывать под
+// блокировкой счёта платежа.
+func (s *Service) recordPaymentRejected(payment *types.Payment, from types.PaymentStatus) {
+	header := EventHeader{AccountID: payment.AccountID, At: payment.UpdatedAt}
+	s.events.record(PaymentRejected{EventHeader: header, From: from, Payment: *payment})
+}
@@ -0,0 +1,316 @@
+package wallet
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// eventRecorder собирает события подписки.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) handle(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) all() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Event(nil), r.events...)
+}
+
+func eventNames(events []Event) []string {
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		names = append(names, fmt.Sprintf("%T:%d", event, event.Header().AccountID))
+	}
+	return names
+}
+
+func TestService_Subscribe_events(t *testing.T) {
+	s := &Service{}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.SetClock(ClockFunc(func() time.Time { return now }))
+
+	// до подписки событий нет
+	_, _ = s.RegisterAccount("+992900000000")
+
+	r := &eventRecorder{}
+	sub := s.Subscribe(r.handle, SubscribeOptions{})
+
+	first, _ := s.RegisterAccount("+992900000001")
+	second, _ := s.RegisterAccount("+992900000002")
+	_ = s.Deposit(first.ID, 1000)
+	payment, _ := s.Pay(first.ID, 100, "auto")
+	repeated, _ := s.Repeat(payment.ID)
+	favorite, _ := s.FavoritePayment(payment.ID, "car")
+	_ = s.Reject(payment.ID)
+	transfer, _ := s.Transfer(first.ID, second.Phone, 50)
+	_ = s.Reject(transfer.ID)
+
+	// неудачные операции и повтор по ключу событий не создают
+	_, _ = s.Pay(first.ID, 1_000_000, "auto")
+	_, _ = s.RegisterAccount("+992900000001")
+	_ = s.DepositWithKey("k", second.ID, 10)
+	_ = s.DepositWithKey("k", second.ID, 10)
+
+	sub.Close()
+	_ = s.Deposit(first.ID, 1)
+
+	events := r.all()
+	want := []string{
+		"wallet.AccountRegistered:2",
+		"wallet.AccountRegistered:3",
+		"wallet.Deposited:2",
+		"wallet.PaymentCreated:2",
+		"wallet.PaymentCreated:2",
+		"wallet.PaymentRepeated:2",
+		"wallet.FavoriteCreated:2",
+		"wallet.PaymentRejected:2",
+		"wallet.PaymentCreated:2",
+		"wallet.PaymentCreated:3",
+		"wallet.PaymentRejected:2",
+		"wallet.PaymentRejected:3",
+		"wallet.Deposited:3",
+	}
+	if got := eventNames(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i, event := range events {
+		if event.Header().Seq != uint64(i+1) || !event.Header().At.Equal(now) {
+			t.Errorf("event %d header = %+v", i, event.Header())
+		}
+	}
+
+	if e := events[0].(AccountRegistered); e.Account.Phone != "+992900000001" {
+		t.Errorf("AccountRegistered = %+v", e)
+	}
+	if e := events[2].(Deposited); e.Amount != 1000 || e.Balance != 1000 || e.Currency != DefaultCurrency {
+		t.Errorf("Deposited = %+v", e)
+	}
+	if e := events[3].(PaymentCreated); e.Payment != *payment {
+		t.Errorf("PaymentCreated = %+v, want %+v", e.Payment, *payment)
+	}
+	if e := events[5].(PaymentRepeated); e.OriginalID != payment.ID || e.Payment != *repeated {
+		t.Errorf("PaymentRepeated = %+v", e)
+	}
+	if e := events[6].(FavoriteCreated); e.Favorite != *favorite {
+		t.Errorf("FavoriteCreated = %+v", e)
+	}
+	e := events[7].(PaymentRejected)
+	if e.From != types.PaymentStatusInProgress || e.Payment.Status != types.PaymentStatusFail || e.Payment.ID != payment.ID {
+		t.Errorf("PaymentRejected = %+v", e)
+	}
+	if e := events[8].(PaymentCreated); e.Payment.ID != transfer.ID || e.Payment.CounterpartID == "" {
+		t.Errorf("transfer PaymentCreated = %+v", e)
+	}
+}
+
+func TestService_Subscribe_orderPerAccount(t *testing.T) {
+	s := &Service{}
+
+	ids := make([]int64, 6)
+	for i := range ids {
+		account, _ := s.RegisterAccount(types.Phone("+99290000" + strconv.Itoa(1000+i)))
+		ids[i] = account.ID
+	}
+
+	var mu sync.Mutex
+	balances := map[int64][]types.Money{}
+	sub := s.Subscribe(func(event Event) {
+		deposited := event.(Deposited)
+		mu.Lock()
+		defer mu.Unlock()
+		balances[deposited.AccountID] = append(balances[deposited.AccountID], deposited.Balance)
+	}, SubscribeOptions{Buffer: 2, Workers: 3})
+
+	const deposits = 50
+	wg := sync.WaitGroup{}
+	for _, id := range ids {
+		for g := 0; g < 2; g++ {
+			wg.Add(1)
+			go func(id int64) {
+				defer wg.Done()
+				for i := 0; i < deposits; i++ {
+					_ = s.Deposit(id, 1)
+				}
+			}(id)
+		}
+	}
+	wg.Wait()
+	sub.Close()
+
+	for _, id := range ids {
+		got := balances[id]
+		if len(got) != 2*deposits {
+			t.Fatalf("account %d: %d events, want %d", id, len(got), 2*deposits)
+		}
+		for i, balance := range got {
+			if balance != types.Money(i+1) {
+				t.Fatalf("account %d: balances out of order: %v", id, got)
+			}
+		}
+	}
+}
+
+func TestService_Subscribe_overflow(t *testing.T) {
+	tests := []struct {
+		overflow OverflowPolicy
+		want     []uint64
+		dropped  uint64
+	}{
+		{OverflowBlock, []uint64{1, 2, 3, 4, 5}, 0},
+		{OverflowDropNewest, []uint64{1, 2}, 3},
+		{OverflowDropOldest, []uint64{1, 5}, 3},
+	}
+	for _, test := range tests {
+		s := &Service{}
+		account, _ := s.RegisterAccount("+992900000001")
+
+		started, release := make(chan struct{}), make(chan struct{})
+		r := &eventRecorder{}
+		sub := s.Subscribe(func(event Event) {
+			if event.Header().Seq == 1 {
+				close(started)
+				<-release
+			}
+			r.handle(event)
+		}, SubscribeOptions{Buffer: 1, Overflow: test.overflow})
+
+		// первое событие занимает обработчик, второе — очередь
+		_ = s.Deposit(account.ID, 1)
+		<-started
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 4; i++ {
+				_ = s.Deposit(account.ID, 1)
+			}
+		}()
+
+		if test.overflow == OverflowBlock {
+			select {
+			case <-done:
+				t.Errorf("OverflowBlock: deposits did not wait for the handler")
+			case <-time.After(50 * time.Millisecond):
+			}
+		} else {
+			<-done
+		}
+		close(release)
+		<-done
+		sub.Close()
+
+		got := []uint64{}
+		for _, event := range r.all() {
+			got = append(got, event.Header().Seq)
+		}
+		if !reflect.DeepEqual(got, test.want) || sub.Dropped() != test.dropped {
+			t.Errorf("overflow %d: delivered %v, dropped %d, want %v, %d", test.overflow, got, sub.Dropped(), test.want, test.dropped)
+		}
+	}
+}
+
+func TestService_Subscribe_handlerReadsService(t *testing.T) {
+	s := &Service{}
+	account, _ := s.RegisterAccount("+992900000001")
+
+	balances := make(chan types.Money, 10)
+	sub := s.Subscribe(func(event Event) {
+		// пока рассылка ждёт места в очереди, сервис доступен для чтения
+		current, err := s.FindAccountByID(event.Header().AccountID)
+		if err == nil {
+			balances <- current.Balance
+		}
+	}, SubscribeOptions{Buffer: 1})
+
+	for i := 0; i < 5; i++ {
+		_ = s.Deposit(account.ID, 1)
+	}
+	sub.Close()
+
+	if len(balances) != 5 {
+		t.Errorf("handler read %d balances, want 5", len(balances))
+	}
+}
+
+func TestService_Subscribe_afterChange(t *testing.T) {
+	s := &Service{}
+	account, _ := s.RegisterAccount("+992900000001")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	first := &eventRecorder{}
+	sub := s.Subscribe(func(event Event) {
+		if event.Header().Seq == 1 {
+			close(started)
+			<-release
+		}
+		first.handle(event)
+	}, SubscribeOptions{Buffer: 1})
+
+	// waitOutbox ждёт, пока сервис запишет seq событий и в outbox
+	// останется pending неразосланных
+	waitOutbox := func(seq uint64, pending int) {
+		for {
+			s.events.mu.Lock()
+			ok := s.events.seq == seq && len(s.events.outbox) == pending
+			s.events.mu.Unlock()
+			if ok {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// первое событие занимает обработчик, второе — очередь, рассылка
+	// третьего ждёт места, а четвёртое остаётся в outbox
+	_ = s.Deposit(account.ID, 1)
+	<-started
+	_ = s.Deposit(account.ID, 1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = s.Deposit(account.ID, 1)
+	}()
+	waitOutbox(3, 0)
+	go func() {
+		defer wg.Done()
+		_ = s.Deposit(account.ID, 1)
+	}()
+	waitOutbox(4, 1)
+
+	second := &eventRecorder{}
+	late := s.Subscribe(second.handle, SubscribeOptions{})
+	close(release)
+	wg.Wait()
+	_ = s.Deposit(account.ID, 1)
+	sub.Close()
+	late.Close()
+
+	seqs := func(events []Event) []uint64 {
+		got := []uint64{}
+		for _, event := range events {
+			got = append(got, event.Header().Seq)
+		}
+		return got
+	}
+	if got := seqs(first.all()); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4, 5}) {
+		t.Errorf("first subscription got %v, want [1 2 3 4 5]", got)
+	}
+	if got := seqs(second.all()); !reflect.DeepEqual(got, []uint64{5}) {
+		t.Errorf("late subscription got %v, want [5]", got)
+	}
+}
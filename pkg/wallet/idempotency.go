@@ -0,0 +1,251 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// DefaultIdempotencyTTL сколько по умолчанию помнится результат операции с ключом.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyNotFound возвращается хранилищем, если записи с ключом нет.
+var ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+// ErrIdempotencyKeyReused возвращается, если ключ уже использован для другого запроса.
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with different request")
+
+// ErrInvalidIdempotencyKey возвращается для ключей с ";" или переводом строки,
+// которые нельзя записать в дамп.
+var ErrInvalidIdempotencyKey = errors.New("invalid idempotency key")
+
+// idempotentErrors ошибки, которые запоминаются вместе с ключом: повтор
+// запроса вернёт ту же ошибку. Остальные ошибки (например, сбой хранилища)
+// не запоминаются, и повтор выполнит операцию заново.
+var idempotentErrors = []error{
+	ErrAmountMustBePositive,
+	ErrAccountNotFound,
+	ErrNotEnoughBalance,
+	ErrFavoriteNotFound,
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// SetIdempotencyTTL задаёт, сколько помнится результат операции с ключом.
+// Значение <= 0 возвращает DefaultIdempotencyTTL.
+func (s *Service) SetIdempotencyTTL(ttl time.Duration) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	s.keyTTL = ttl
+}
+
+// DepositWithKey как Deposit, но повтор с тем же ключом не зачисляет деньги
+// второй раз, а возвращает результат первого вызова. Пустой ключ означает
+// обычный Deposit.
+func (s *Service) DepositWithKey(key string, accountID int64, amount types.Money) error {
+	if key == "" {
+		return s.Deposit(accountID, amount)
+	}
+
+	request := fmt.Sprintf("deposit:%d:%d", accountID, amount)
+	_, err := s.idempotent(key, request, func() (string, error) {
+		return "", s.Deposit(accountID, amount)
+	})
+	return err
+}
+
+// PayWithKey как Pay, но повтор с тем же ключом возвращает исходный платёж
+// (или исходную ошибку) и не списывает деньги второй раз. Пустой ключ
+// означает обычный Pay.
+func (s *Service) PayWithKey(key string, accountID int64, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	if key == "" {
+		return s.Pay(accountID, amount, category)
+	}
+
+	request := fmt.Sprintf("pay:%d:%d:%s", accountID, amount, category)
+	return s.idempotentPayment(key, request, func() (*types.Payment, error) {
+		return s.Pay(accountID, amount, category)
+	})
+}
+
+// PayFromFavoriteWithKey как PayFromFavorite, но с ключом идемпотентности (см. PayWithKey).
+func (s *Service) PayFromFavoriteWithKey(key string, favoriteID string) (*types.Payment, error) {
+	if key == "" {
+		return s.PayFromFavorite(favoriteID)
+	}
+
+	request := "favorite:" + favoriteID
+	return s.idempotentPayment(key, request, func() (*types.Payment, error) {
+		return s.PayFromFavorite(favoriteID)
+	})
+}
+
+// PurgeExpiredKeys удаляет записи с истёкшим сроком и возвращает их количество.
+func (s *Service) PurgeExpiredKeys() (int, error) {
+	keys := s.storage().Keys()
+
+	records, err := keys.All()
+	if err != nil {
+		return 0, err
+	}
+	now := s.now()
+	purged := 0
+	for _, record := range records {
+		if record.ExpiresAt.After(now) {
+			continue
+		}
+		unlock := s.lockKey(record.Key)
+		// пока ждали блокировку, ключ могли использовать заново
+		current, err := keys.ByKey(record.Key)
+		if err == nil && !current.ExpiresAt.After(now) {
+			err = s.saveKeys(func() error {
+				return keys.Delete(record.Key)
+			})
+			if err == nil {
+				purged++
+			}
+		}
+		unlock()
+		if err != nil && err != ErrIdempotencyKeyNotFound {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func (s *Service) idempotentPayment(key, request string, run func() (*types.Payment, error)) (*types.Payment, error) {
+	var payment *types.Payment
+	record, err := s.idempotent(key, request, func() (string, error) {
+		var err error
+		payment, err = run()
+		if err != nil {
+			return "", err
+		}
+		return payment.ID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if payment != nil {
+		return payment, nil
+	}
+	// повтор: возвращаем исходный платёж в его текущем состоянии
+	return s.FindPaymentByID(record.PaymentID)
+}
+
+// idempotent выполняет run не больше одного раза на ключ за время жизни
+// ключа. Запросы с одним ключом выполняются по очереди, поэтому повтор,
+// пришедший во время первого вызова, дождётся его и получит его результат.
+//
+// Результат запоминается после выполнения операции: если процесс упадёт
+// между ними, повтор выполнит операцию ещё раз.
+func (s *Service) idempotent(key, request string, run func() (string, error)) (*types.IdempotencyRecord, error) {
+	if strings.ContainsAny(key, ";\r\n") {
+		return nil, ErrInvalidIdempotencyKey
+	}
+	keys := s.storage().Keys()
+
+	unlock := s.lockKey(key)
+	defer unlock()
+
+	now := s.now()
+	record, err := keys.ByKey(key)
+	if err != nil && err != ErrIdempotencyKeyNotFound {
+		return nil, err
+	}
+	if err == nil && record.ExpiresAt.After(now) {
+		if record.Request != request {
+			return nil, ErrIdempotencyKeyReused
+		}
+		return record, idempotentError(record.Err)
+	}
+
+	paymentID, err := run()
+	if err != nil && idempotentError(err.Error()) == nil {
+		return nil, err
+	}
+	record = &types.IdempotencyRecord{
+		Key:       key,
+		Request:   request,
+		PaymentID: paymentID,
+		ExpiresAt: now.Add(s.idempotencyTTL()),
+	}
+	if err != nil {
+		record.Err = err.Error()
+	}
+	saveErr := s.saveKeys(func() error {
+		return keys.Save(record)
+	})
+	if saveErr != nil {
+		return nil, saveErr
+	}
+	return record, err
+}
+
+// saveKeys меняет ключи идемпотентности отдельным изменением хранилища,
+// см. atomically.
+func (s *Service) saveKeys(fn func() error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.atomically(fn)
+}
+
+// idempotentError восстанавливает запомненную ошибку по её тексту.
+func idempotentError(text string) error {
+	if text == "" {
+		return nil
+	}
+	for _, err := range idempotentErrors {
+		if err.Error() == text {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) idempotencyTTL() time.Duration {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	if s.keyTTL <= 0 {
+		return DefaultIdempotencyTTL
+	}
+	return s.keyTTL
+}
+
+// lockKey блокирует ключ идемпотентности. Блокировка удаляется, когда её
+// больше никто не ждёт, поэтому ключи не копятся в памяти.
+func (s *Service) lockKey(key string) func() {
+	s.keysMu.Lock()
+	if s.keyLocks == nil {
+		s.keyLocks = make(map[string]*keyLock)
+	}
+	lock, ok := s.keyLocks[key]
+	if !ok {
+		lock = &keyLock{}
+		s.keyLocks[key] = lock
+	}
+	lock.refs++
+	s.keysMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		s.keysMu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(s.keyLocks, key)
+		}
+		s.keysMu.Unlock()
+	}
+}
@@ -0,0 +1,189 @@
+package wallet
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestService_PayWithKey_retry(t *testing.T) {
+	s, from, _ := newTransferService(t)
+
+	first, err := s.PayWithKey("order-1", from.ID, 300, "auto")
+	if err != nil {
+		t.Fatalf("PayWithKey(): error = %v", err)
+	}
+	retry, err := s.PayWithKey("order-1", from.ID, 300, "auto")
+	if err != nil {
+		t.Fatalf("PayWithKey(): retry error = %v", err)
+	}
+	if retry.ID != first.ID {
+		t.Errorf("PayWithKey(): retry must return payment %v, got %v", first.ID, retry.ID)
+	}
+	assertBalance(t, s, from.ID, 700)
+
+	if _, err := s.PayWithKey("order-1", from.ID, 500, "auto"); err != ErrIdempotencyKeyReused {
+		t.Errorf("PayWithKey(): must return ErrIdempotencyKeyReused, returned = %v", err)
+	}
+	if _, err := s.PayWithKey("order;1", from.ID, 300, "auto"); err != ErrInvalidIdempotencyKey {
+		t.Errorf("PayWithKey(): must return ErrInvalidIdempotencyKey, returned = %v", err)
+	}
+
+	// без ключа каждый вызов выполняется
+	_, _ = s.PayWithKey("", from.ID, 100, "auto")
+	_, _ = s.PayWithKey("", from.ID, 100, "auto")
+	assertBalance(t, s, from.ID, 500)
+}
+
+func TestService_PayWithKey_replaysError(t *testing.T) {
+	s, from, _ := newTransferService(t)
+
+	if _, err := s.PayWithKey("order-1", from.ID, 5_000, "auto"); err != ErrNotEnoughBalance {
+		t.Fatalf("PayWithKey(): must return ErrNotEnoughBalance, returned = %v", err)
+	}
+	_ = s.Deposit(from.ID, 10_000)
+
+	// повтор возвращает исходную ошибку, даже если денег уже хватает
+	if _, err := s.PayWithKey("order-1", from.ID, 5_000, "auto"); err != ErrNotEnoughBalance {
+		t.Errorf("PayWithKey(): retry must return ErrNotEnoughBalance, returned = %v", err)
+	}
+	assertBalance(t, s, from.ID, 11_000)
+}
+
+func TestService_DepositWithKey_retry(t *testing.T) {
+	s, from, _ := newTransferService(t)
+
+	for i := 0; i < 3; i++ {
+		if err := s.DepositWithKey("topup-1", from.ID, 500); err != nil {
+			t.Fatalf("DepositWithKey(): error = %v", err)
+		}
+	}
+	assertBalance(t, s, from.ID, 1_500)
+
+	if err := s.DepositWithKey("topup-2", 404, 500); err != ErrAccountNotFound {
+		t.Errorf("DepositWithKey(): must return ErrAccountNotFound, returned = %v", err)
+	}
+	if err := s.DepositWithKey("topup-2", 404, 500); err != ErrAccountNotFound {
+		t.Errorf("DepositWithKey(): retry must return ErrAccountNotFound, returned = %v", err)
+	}
+}
+
+func TestService_PayFromFavoriteWithKey_retry(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 100, "phone")
+	favorite, _ := s.FavoritePayment(payment.ID, "phone")
+
+	first, err := s.PayFromFavoriteWithKey("fav-1", favorite.ID)
+	if err != nil {
+		t.Fatalf("PayFromFavoriteWithKey(): error = %v", err)
+	}
+	retry, _ := s.PayFromFavoriteWithKey("fav-1", favorite.ID)
+	if retry == nil || retry.ID != first.ID {
+		t.Errorf("PayFromFavoriteWithKey(): retry must return payment %v, got %v", first.ID, retry)
+	}
+	assertBalance(t, s, from.ID, 800)
+}
+
+func TestService_PayWithKey_concurrentRetries(t *testing.T) {
+	s, from, _ := newTransferService(t)
+
+	ids := make(chan string, stressGoroutines)
+	wg := sync.WaitGroup{}
+	for i := 0; i < stressGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payment, err := s.PayWithKey("order-1", from.ID, 100, "auto")
+			if err != nil {
+				t.Errorf("PayWithKey(): error = %v", err)
+				return
+			}
+			ids <- payment.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		seen[id] = true
+	}
+	if len(seen) != 1 {
+		t.Errorf("PayWithKey(): concurrent retries created %v payments", len(seen))
+	}
+	assertBalance(t, s, from.ID, 900)
+}
+
+func TestService_PayWithKey_expiry(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	s.SetIdempotencyTTL(time.Millisecond)
+
+	first, _ := s.PayWithKey("order-1", from.ID, 100, "auto")
+	time.Sleep(5 * time.Millisecond)
+
+	// после истечения срока ключ можно использовать заново
+	second, err := s.PayWithKey("order-1", from.ID, 200, "auto")
+	if err != nil {
+		t.Fatalf("PayWithKey(): error = %v", err)
+	}
+	if second.ID == first.ID {
+		t.Errorf("PayWithKey(): expired key must not return the old payment")
+	}
+	assertBalance(t, s, from.ID, 700)
+
+	time.Sleep(5 * time.Millisecond)
+	purged, err := s.PurgeExpiredKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("PurgeExpiredKeys(): purged %v, want 1", purged)
+	}
+	if records, _ := s.storage().Keys().All(); len(records) != 0 {
+		t.Errorf("PurgeExpiredKeys(): left %v records", len(records))
+	}
+}
+
+func TestService_PayWithKey_survivesExportImport(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	first, _ := s.PayWithKey("order-1", from.ID, 300, "auto")
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	retry, err := imported.PayWithKey("order-1", from.ID, 300, "auto")
+	if err != nil {
+		t.Fatalf("PayWithKey(): error = %v", err)
+	}
+	if retry.ID != first.ID {
+		t.Errorf("PayWithKey(): retry after Import must return payment %v, got %v", first.ID, retry.ID)
+	}
+	assertBalance(t, imported, from.ID, 700)
+}
+
+func TestFileRepository_keysSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 4)
+	account, _ := s.RegisterAccount("+992900000001")
+	_ = s.DepositWithKey("topup-1", account.ID, 1_000)
+	first, _ := s.PayWithKey("order-1", account.ID, 300, "auto")
+	_ = repo.Close()
+
+	restored, repo := openFileService(t, dir, 4)
+	defer repo.Close()
+
+	_ = restored.DepositWithKey("topup-1", account.ID, 1_000)
+	retry, err := restored.PayWithKey("order-1", account.ID, 300, "auto")
+	if err != nil {
+		t.Fatalf("PayWithKey(): error = %v", err)
+	}
+	if retry.ID != first.ID {
+		t.Errorf("PayWithKey(): retry after restart must return payment %v, got %v", first.ID, retry.ID)
+	}
+	assertBalance(t, restored, account.ID, 700)
+}
@@ -0,0 +1,552 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// Файлы дампа, которые пишет Export (см. также manifestFileName).
+const (
+	accountsFileName  = "accounts.dump"
+	paymentsFileName  = "payments.dump"
+	favoritesFileName = "favorites.dump"
+	keysFileName      = "keys.dump"
+)
+
+// maxImportErrors ограничивает число ошибок, которые хранит ImportError,
+// чтобы испорченный многогигабайтный файл не занял всю память.
+const maxImportErrors = 100
+
+// ImportOptions настройки ImportStrict.
+type ImportOptions struct {
+	// DryRun только проверяет дамп и считает, что было бы создано и
+	// обновлено. Сервис при этом не меняется.
+	DryRun bool
+	// Merge решает конфликты с уже сохранёнными записями, по умолчанию
+	// MergeOverwrite.
+	Merge MergePolicy
+}
+
+// ImportCounts сколько записей одного вида создано, обновлено и пропущено
+// по политике слияния.
+type ImportCounts struct {
+	Created int
+	Updated int
+	Skipped int
+}
+
+// ImportReport итог ImportStrict. При DryRun описывает изменения, которые
+// были бы сделаны. Keys считает только действующие ключи идемпотентности.
+type ImportReport struct {
+	Accounts  ImportCounts
+	Payments  ImportCounts
+	Favorites ImportCounts
+	Keys      int
+	// Checkpoint отметка источника, до которой применена дельта (только
+	// ImportDelta, и только если дельта записана)
+	Checkpoint ChangeCheckpoint
+}
+
+// LineError ошибка в строке файла дампа, Line считается с 1.
+type LineError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ImportError собирает все ошибки, найденные ImportStrict, в порядке файлов
+// и строк. errors.Is проверяет каждую из них.
+type ImportError struct {
+	Errors []*LineError
+	// Omitted число ошибок сверх maxImportErrors, которые не сохранены.
+	Omitted int
+}
+
+func (e *ImportError) Error() string {
+	lines := make([]string, 0, len(e.Errors)+1)
+	for _, err := range e.Errors {
+		lines = append(lines, err.Error())
+	}
+	if e.Omitted > 0 {
+		lines = append(lines, fmt.Sprintf("and %d more", e.Omitted))
+	}
+	return fmt.Sprintf("%d invalid dump records:\n%s", len(e.Errors)+e.Omitted, strings.Join(lines, "\n"))
+}
+
+// Unwrap возвращает первую ошибку, чтобы errors.As находил *LineError.
+func (e *ImportError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[0]
+}
+
+func (e *ImportError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportStrict читает дамп Export из каталога dir, но, в отличие от Import,
+// сначала проверяет каждую запись: число полей, числа, известные статусы,
+// ссылки платежей и избранного на счета и платежей друг на друга. Все
+// найденные ошибки возвращаются одной *ImportError с файлами и строками,
+// и тогда сервис не меняется. Файлы читаются потоково, дважды: на проверку
+// и на загрузку, а загруженные записи переносятся в хранилище одним пакетом. Отсутствующий файл считается пустым, отсутствующий
+// каталог — ошибкой. Манифест Export, если он есть, проверяется до всего.
+func (s *Service) ImportStrict(dir string, opts ImportOptions) (ImportReport, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	if !info.IsDir() {
+		return ImportReport{}, fmt.Errorf("%s is not a directory", dir)
+	}
+	err = verifyManifest(dir)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	return s.importDump(dirDump(dir), opts)
+}
+
+// dumpReader вызывает fn для каждой непустой строки файла дампа name
+// вместе с её номером. Отсутствующий файл считается пустым.
+type dumpReader func(name string, fn func(line string, n int) error) error
+
+// dirDump читает файлы дампа из каталога dir.
+func dirDump(dir string) dumpReader {
+	return func(name string, fn func(line string, n int) error) error {
+		return readDumpLines(dir, name, fn)
+	}
+}
+
+// importDump проверяет и загружает дамп, как описано в ImportStrict.
+func (s *Service) importDump(read dumpReader, opts ImportOptions) (ImportReport, error) {
+	// импорт меняет всё состояние сразу, поэтому останавливаем все операции
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check := newImportCheck(s.storage(), s.now())
+	check.policy = opts.Merge
+	err := check.run(read)
+	if err != nil {
+		return check.report, err
+	}
+	if len(check.errs.Errors) > 0 {
+		return check.report, &check.errs
+	}
+	if opts.DryRun {
+		return check.report, nil
+	}
+
+	err = s.loadDump(read, check)
+	if err != nil {
+		return check.report, err
+	}
+	return check.report, nil
+}
+
+// loadDump загружает уже проверенный дамп, пропуская записи, которые
+// check решил не сохранять. Записи сначала собираются в памяти, а в
+// хранилище сервиса попадают одним пакетом, как в Import. Вызывать под
+// mu.Lock.
+func (s *Service) loadDump(read dumpReader, check *importCheck) error {
+	staging := NewMemoryRepository()
+
+	err := read(accountsFileName, func(line string, _ int) error {
+		account, err := parseAccount(line)
+		if err != nil {
+			return err
+		}
+		if check.skipped(changeAccount, strconv.FormatInt(account.ID, 10)) {
+			return nil
+		}
+		return staging.Accounts().Save(&account)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = read(paymentsFileName, func(line string, _ int) error {
+		payment, err := parsePayment(line)
+		if err != nil {
+			return err
+		}
+		if check.skipped(changePayment, payment.ID) {
+			return nil
+		}
+		return staging.Payments().Save(&payment)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = read(favoritesFileName, func(line string, _ int) error {
+		favorite, err := parseFavorite(line)
+		if err != nil {
+			return err
+		}
+		if check.skipped(changeFavorite, favorite.ID) {
+			return nil
+		}
+		return staging.Favorites().Save(&favorite)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = read(keysFileName, func(line string, _ int) error {
+		record, err := parseIdempotencyRecord(line)
+		if err != nil {
+			return err
+		}
+		if !record.ExpiresAt.After(check.now) {
+			return nil
+		}
+		return staging.Keys().Save(&record)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.atomically(func() error {
+		return s.applyImport(staging)
+	})
+}
+
+// importCheck проверяет дамп построчно и помнит только ID и телефоны,
+// нужные для проверки ссылок.
+type importCheck struct {
+	repo   Repository
+	now    time.Time
+	report ImportReport
+	errs   ImportError
+	// source заменяет имя файла в ошибках, если строки пришли не из файлов дампа
+	source string
+	policy MergePolicy
+	// skip записи, которые по политике слияния сохранять не нужно
+	skip map[changeKey]bool
+
+	currencies   map[int64]types.Currency
+	phones       map[types.Phone]int64
+	payments     map[string]bool
+	favorites    map[string]bool
+	counterparts []pendingCounterpart
+}
+
+func newImportCheck(repo Repository, now time.Time) *importCheck {
+	return &importCheck{
+		repo:       repo,
+		now:        now,
+		currencies: make(map[int64]types.Currency),
+		phones:     make(map[types.Phone]int64),
+		payments:   make(map[string]bool),
+		favorites:  make(map[string]bool),
+		skip:       make(map[changeKey]bool),
+	}
+}
+
+// pendingCounterpart ссылка на парный платёж, который может встретиться
+// в файле позже.
+type pendingCounterpart struct {
+	line          int
+	paymentID     string
+	counterpartID string
+}
+
+func (c *importCheck) run(read dumpReader) error {
+	err := read(accountsFileName, c.account)
+	if err != nil {
+		return err
+	}
+	err = read(paymentsFileName, c.payment)
+	if err != nil {
+		return err
+	}
+	err = read(favoritesFileName, c.favorite)
+	if err != nil {
+		return err
+	}
+	err = read(keysFileName, c.key)
+	if err != nil {
+		return err
+	}
+	c.finish()
+	return nil
+}
+
+// finish проверяет ссылки на парные платежи, которые могли встретиться
+// позже ссылающейся строки, и упорядочивает ошибки по файлам и строкам.
+func (c *importCheck) finish() {
+	for _, pending := range c.counterparts {
+		if c.payments[pending.counterpartID] {
+			continue
+		}
+		if _, err := c.repo.Payments().ByID(pending.counterpartID); err != nil {
+			c.fail(paymentsFileName, pending.line, "payment %q: unknown counterpart payment %q", pending.paymentID, pending.counterpartID)
+		}
+	}
+
+	order := map[string]int{accountsFileName: 0, paymentsFileName: 1, favoritesFileName: 2, keysFileName: 3}
+	sort.SliceStable(c.errs.Errors, func(i, j int) bool {
+		a, b := c.errs.Errors[i], c.errs.Errors[j]
+		if a.File != b.File {
+			return order[a.File] < order[b.File]
+		}
+		return a.Line < b.Line
+	})
+}
+
+func (c *importCheck) account(line string, n int) error {
+	account, err := parseAccount(line)
+	if err != nil {
+		c.add(accountsFileName, n, err)
+		return nil
+	}
+
+	fail := func(format string, args ...interface{}) error {
+		c.fail(accountsFileName, n, "account %d: %s", account.ID, fmt.Sprintf(format, args...))
+		return nil
+	}
+	if account.ID <= 0 {
+		return fail("id must be positive")
+	}
+	if _, ok := c.currencies[account.ID]; ok {
+		return fail("duplicate id")
+	}
+	if account.Phone == "" {
+		return fail("empty phone")
+	}
+	if account.Balance < 0 {
+		return fail("negative balance")
+	}
+
+	stored, err := c.repo.Accounts().ByID(account.ID)
+	if err == nil {
+		stored.Currency = currencyOf(stored.Currency)
+		what := fmt.Sprintf("account %d", account.ID)
+		if !c.resolve(accountsFileName, n, what, *stored == account, account.UpdatedAt, stored.UpdatedAt) {
+			c.currencies[stored.ID] = stored.Currency
+			c.phones[stored.Phone] = stored.ID
+			c.skipRecord(&c.report.Accounts, changeAccount, strconv.FormatInt(account.ID, 10))
+			return nil
+		}
+	}
+
+	if other, ok := c.phones[account.Phone]; ok {
+		return fail("phone %s already used by account %d", account.Phone, other)
+	}
+	if owner, err := c.repo.Accounts().ByPhone(account.Phone); err == nil && owner.ID != account.ID {
+		return fail("phone %s already registered to account %d", account.Phone, owner.ID)
+	}
+	if stored != nil && stored.Currency != account.Currency {
+		return fail("currency cannot change from %s to %s", stored.Currency, account.Currency)
+	}
+	c.currencies[account.ID] = account.Currency
+	c.phones[account.Phone] = account.ID
+	c.count(&c.report.Accounts, stored != nil)
+	return nil
+}
+
+func (c *importCheck) payment(line string, n int) error {
+	payment, err := parsePayment(line)
+	if err != nil {
+		c.add(paymentsFileName, n, err)
+		return nil
+	}
+
+	fail := func(format string, args ...interface{}) error {
+		c.fail(paymentsFileName, n, "payment %q: %s", payment.ID, fmt.Sprintf(format, args...))
+		return nil
+	}
+	if payment.ID == "" {
+		return fail("empty id")
+	}
+	if c.payments[payment.ID] {
+		return fail("duplicate id")
+	}
+	c.payments[payment.ID] = true
+
+	currency, ok := c.accountCurrency(payment.AccountID)
+	if !ok {
+		return fail("unknown account %d", payment.AccountID)
+	}
+	if payment.Amount <= 0 {
+		return fail("amount must be positive")
+	}
+	if payment.Category == "" {
+		return fail("empty category")
+	}
+	if !isKnownStatus(payment.Status) {
+		return fail("unknown status %q", payment.Status)
+	}
+	if payment.Currency != currency {
+		return fail("currency %s differs from account currency %s", payment.Currency, currency)
+	}
+	if payment.CounterpartID != "" {
+		c.counterparts = append(c.counterparts, pendingCounterpart{line: n, paymentID: payment.ID, counterpartID: payment.CounterpartID})
+	}
+
+	stored, err := c.repo.Payments().ByID(payment.ID)
+	if err == nil {
+		stored.Currency = currencyOf(stored.Currency)
+		what := fmt.Sprintf("payment %q", payment.ID)
+		if !c.resolve(paymentsFileName, n, what, *stored == payment, payment.UpdatedAt, stored.UpdatedAt) {
+			c.skipRecord(&c.report.Payments, changePayment, payment.ID)
+			return nil
+		}
+	}
+	c.count(&c.report.Payments, stored != nil)
+	return nil
+}
+
+func (c *importCheck) favorite(line string, n int) error {
+	favorite, err := parseFavorite(line)
+	if err != nil {
+		c.add(favoritesFileName, n, err)
+		return nil
+	}
+
+	fail := func(format string, args ...interface{}) error {
+		c.fail(favoritesFileName, n, "favorite %q: %s", favorite.ID, fmt.Sprintf(format, args...))
+		return nil
+	}
+	if favorite.ID == "" {
+		return fail("empty id")
+	}
+	if c.favorites[favorite.ID] {
+		return fail("duplicate id")
+	}
+	c.favorites[favorite.ID] = true
+
+	currency, ok := c.accountCurrency(favorite.AccountID)
+	if !ok {
+		return fail("unknown account %d", favorite.AccountID)
+	}
+	if favorite.Amount <= 0 {
+		return fail("amount must be positive")
+	}
+	if favorite.Category == "" {
+		return fail("empty category")
+	}
+	if favorite.Currency != currency {
+		return fail("currency %s differs from account currency %s", favorite.Currency, currency)
+	}
+
+	stored, err := c.repo.Favorites().ByID(favorite.ID)
+	if err == nil {
+		stored.Currency = currencyOf(stored.Currency)
+		what := fmt.Sprintf("favorite %q", favorite.ID)
+		if !c.resolve(favoritesFileName, n, what, *stored == favorite, favorite.UpdatedAt, stored.UpdatedAt) {
+			c.skipRecord(&c.report.Favorites, changeFavorite, favorite.ID)
+			return nil
+		}
+	}
+	c.count(&c.report.Favorites, stored != nil)
+	return nil
+}
+
+func (c *importCheck) key(line string, n int) error {
+	record, err := parseIdempotencyRecord(line)
+	if err != nil {
+		c.add(keysFileName, n, err)
+		return nil
+	}
+	if record.ExpiresAt.After(c.now) {
+		c.report.Keys++
+	}
+	return nil
+}
+
+// accountCurrency ищет счёт сначала в дампе, потом в хранилище.
+func (c *importCheck) accountCurrency(accountID int64) (types.Currency, bool) {
+	if currency, ok := c.currencies[accountID]; ok {
+		return currency, true
+	}
+	stored, err := c.repo.Accounts().ByID(accountID)
+	if err != nil {
+		return "", false
+	}
+	return currencyOf(stored.Currency), true
+}
+
+func (c *importCheck) count(counts *ImportCounts, exists bool) {
+	if exists {
+		counts.Updated++
+	} else {
+		counts.Created++
+	}
+}
+
+func (c *importCheck) skipRecord(counts *ImportCounts, kind, id string) {
+	counts.Skipped++
+	c.skip[changeKey{kind, id}] = true
+}
+
+func (c *importCheck) skipped(kind, id string) bool {
+	return c.skip[changeKey{kind, id}]
+}
+
+func (c *importCheck) fail(file string, line int, format string, args ...interface{}) {
+	c.add(file, line, fmt.Errorf("%w: %s", ErrInvalidRecord, fmt.Sprintf(format, args...)))
+}
+
+func (c *importCheck) add(file string, line int, err error) {
+	if c.source != "" {
+		file = c.source
+	}
+	if len(c.errs.Errors) >= maxImportErrors {
+		c.errs.Omitted++
+		return
+	}
+	c.errs.Errors = append(c.errs.Errors, &LineError{File: file, Line: line, Err: err})
+}
+
+// readDumpLines вызывает fn для каждой непустой строки файла name из dir
+// вместе с её номером. Отсутствующий файл считается пустым.
+func readDumpLines(dir, name string, fn func(line string, n int) error) error {
+	err := decodeDumpFile(filepath.Join(dir, name), func(dec *DumpDecoder) error {
+		return scanDumpLines(dec, fn)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// scanDumpLines вызывает fn для каждой непустой строки dec вместе с её номером.
+func scanDumpLines(dec *DumpDecoder, fn func(line string, n int) error) error {
+	for {
+		line, err := dec.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(line, dec.Line())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", dec.Line(), err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeDumpFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestService_ImportStrict_success(t *testing.T) {
+	s, from, to := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 100, "food")
+	_, _ = s.Transfer(from.ID, to.Phone, 200)
+	_, _ = s.FavoritePayment(payment.ID, "lunch")
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := &Service{}
+	report, err := imported.ImportStrict(dir, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("ImportStrict(DryRun): error = %v", err)
+	}
+	want := ImportReport{
+		Accounts:  ImportCounts{Created: 2},
+		Payments:  ImportCounts{Created: 3},
+		Favorites: ImportCounts{Created: 1},
+	}
+	if report != want {
+		t.Errorf("ImportStrict(DryRun) = %+v, want %+v", report, want)
+	}
+	if accounts, _ := imported.storage().Accounts().All(); len(accounts) != 0 {
+		t.Errorf("ImportStrict(DryRun): saved %v accounts", len(accounts))
+	}
+
+	report, err = imported.ImportStrict(dir, ImportOptions{})
+	if err != nil || report != want {
+		t.Fatalf("ImportStrict() = %+v, %v, want %+v", report, err, want)
+	}
+	wantAccounts, wantPayments, wantFavorites, _ := s.snapshot()
+	gotAccounts, gotPayments, gotFavorites, _ := imported.snapshot()
+	if !reflect.DeepEqual(gotAccounts, wantAccounts) || !reflect.DeepEqual(gotPayments, wantPayments) || !reflect.DeepEqual(gotFavorites, wantFavorites) {
+		t.Errorf("ImportStrict(): state differs from exported service")
+	}
+	if discrepancies, _ := imported.VerifyLedger(); len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v after ImportStrict", discrepancies)
+	}
+	account, _ := imported.RegisterAccount("+992900000003")
+	if account.ID != 3 {
+		t.Errorf("RegisterAccount(): id = %v after ImportStrict, want 3", account.ID)
+	}
+
+	// повторный импорт только обновляет
+	report, err = imported.ImportStrict(dir, ImportOptions{DryRun: true})
+	want = ImportReport{
+		Accounts:  ImportCounts{Updated: 2},
+		Payments:  ImportCounts{Updated: 3},
+		Favorites: ImportCounts{Updated: 1},
+	}
+	if err != nil || report != want {
+		t.Errorf("ImportStrict(DryRun) = %+v, %v, want %+v", report, err, want)
+	}
+}
+
+func TestService_ImportStrict_oneBatch(t *testing.T) {
+	s, from, to := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 100, "food")
+	_, _ = s.Transfer(from.ID, to.Phone, 200)
+	_, _ = s.FavoritePayment(payment.ID, "lunch")
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	assertOneBatch(t, t.TempDir(), "ImportStrict()", func(imported *Service) error {
+		_, err := imported.ImportStrict(dir, ImportOptions{})
+		return err
+	})
+}
+
+func TestService_ImportStrict_errors(t *testing.T) {
+	dir := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000001;1000\n" +
+			"2;+992900000002\n" +
+			"x;+992900000003;0\n" +
+			"4;+992900000001;0\n",
+		paymentsFileName: "p1;1;100;auto;Ok\n" +
+			"\n" +
+			"p2;7;100;auto;Ok\n" +
+			"p3;1;100;auto;DONE\n" +
+			"p4;1;abc;auto;Ok\n" +
+			"p5;1;100;transfer-out;Ok;p9\n" +
+			"p1;1;100;auto;Ok\n",
+		favoritesFileName: "f1;1;car;100;auto\n" +
+			"f2;3;car;100;auto\n" +
+			"f3;1;car;0;auto\n",
+		keysFileName: "k1;pay;p1;;nope\n",
+	})
+
+	s := &Service{}
+	_, err := s.ImportStrict(dir, ImportOptions{})
+
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("ImportStrict() must return ImportError, returned = %v", err)
+	}
+	type position struct {
+		file string
+		line int
+	}
+	want := []position{
+		{accountsFileName, 2},
+		{accountsFileName, 3},
+		{accountsFileName, 4},
+		{paymentsFileName, 3},
+		{paymentsFileName, 4},
+		{paymentsFileName, 5},
+		{paymentsFileName, 6},
+		{paymentsFileName, 7},
+		{favoritesFileName, 2},
+		{favoritesFileName, 3},
+		{keysFileName, 1},
+	}
+	got := []position{}
+	for _, lineErr := range importErr.Errors {
+		got = append(got, position{lineErr.File, lineErr.Line})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportStrict(): errors at %v, want %v\n%v", got, want, err)
+	}
+
+	if accounts, _ := s.storage().Accounts().All(); len(accounts) != 0 {
+		t.Errorf("ImportStrict() saved %v accounts from an invalid dump", len(accounts))
+	}
+}
+
+func TestService_ImportStrict_missing(t *testing.T) {
+	s := &Service{}
+	if _, err := s.ImportStrict(filepath.Join(t.TempDir(), "none"), ImportOptions{}); !os.IsNotExist(err) {
+		t.Errorf("ImportStrict(): must fail for a missing directory, returned = %v", err)
+	}
+
+	// пустой сервис экспортирует пустой каталог
+	report, err := s.ImportStrict(t.TempDir(), ImportOptions{})
+	if err != nil || report != (ImportReport{}) {
+		t.Errorf("ImportStrict() = %+v, %v for an empty directory", report, err)
+	}
+}
+
+func TestService_ImportStrict_errorLimit(t *testing.T) {
+	data := ""
+	for i := 0; i < maxImportErrors+5; i++ {
+		data += "bad\n"
+	}
+	dir := writeDumpFiles(t, map[string]string{accountsFileName: data})
+
+	s := &Service{}
+	_, err := s.ImportStrict(dir, ImportOptions{DryRun: true})
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || len(importErr.Errors) != maxImportErrors || importErr.Omitted != 5 {
+		t.Errorf("ImportStrict(): must keep %d errors and omit 5, returned = %v", maxImportErrors, err)
+	}
+}
@@ -0,0 +1,465 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// JSONVersion версия документа, который пишет ExportJSON.
+const JSONVersion = 1
+
+// jsonFileName имя файла документа для ExportJSONDir и ImportJSONDir.
+const jsonFileName = "wallet.json"
+
+// ErrUnsupportedVersion возвращается для документа неизвестной версии.
+var ErrUnsupportedVersion = errors.New("unsupported document version")
+
+// RecordError описывает запись документа, которая не прошла проверку.
+// Index считается с нуля внутри своего списка (accounts, payments, favorites).
+type RecordError struct {
+	Kind  string
+	Index int
+	ID    string
+	Err   error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("%s #%d (id %q): %v", e.Kind, e.Index, e.ID, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// jsonDocument полное состояние кошелька. Суммы записываются строками в
+// основных единицах с числом знаков, принятым для валюты записи (см.
+// types.DecimalIn): "123.45" для TJS, "12345" для JPY. Так они не теряют
+// точности.
+type jsonDocument struct {
+	Version       int            `json:"version"`
+	NextAccountID int64          `json:"nextAccountID"`
+	Accounts      []jsonAccount  `json:"accounts"`
+	Payments      []jsonPayment  `json:"payments"`
+	Favorites     []jsonFavorite `json:"favorites"`
+}
+
+type jsonAccount struct {
+	ID        int64          `json:"id"`
+	Phone     types.Phone    `json:"phone"`
+	Balance   types.Decimal  `json:"balance"`
+	Currency  types.Currency `json:"currency"`
+	CreatedAt *time.Time     `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time     `json:"updatedAt,omitempty"`
+}
+
+type jsonPayment struct {
+	ID            string                `json:"id"`
+	AccountID     int64                 `json:"accountID"`
+	Amount        types.Decimal         `json:"amount"`
+	Category      types.PaymentCategory `json:"category"`
+	Status        types.PaymentStatus   `json:"status"`
+	CounterpartID string                `json:"counterpartID,omitempty"`
+	Currency      types.Currency        `json:"currency"`
+	CreatedAt     *time.Time            `json:"createdAt,omitempty"`
+	UpdatedAt     *time.Time            `json:"updatedAt,omitempty"`
+}
+
+type jsonFavorite struct {
+	ID        string                `json:"id"`
+	AccountID int64                 `json:"accountID"`
+	Name      string                `json:"name"`
+	Amount    types.Decimal         `json:"amount"`
+	Category  types.PaymentCategory `json:"category"`
+	Currency  types.Currency        `json:"currency"`
+	CreatedAt *time.Time            `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time            `json:"updatedAt,omitempty"`
+}
+
+// jsonTime опускает неизвестное (нулевое) время в документе.
+func jsonTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func fromJSONTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+// ExportJSON записывает счета, платежи, избранное и следующий ID счёта
+// одним JSON-документом. В отличие от Export, имена и категории могут
+// содержать любые символы.
+func (s *Service) ExportJSON(w io.Writer) error {
+	doc, err := s.exportDocument()
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// ImportJSON читает документ ExportJSON. Сначала проверяется весь документ,
+// и только если все записи верны, они добавляются в сервис (существующие
+// записи с теми же ID заменяются) одним пакетом хранилища. Ошибка в записи
+// возвращается как *RecordError, и тогда сервис не меняется.
+func (s *Service) ImportJSON(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var doc jsonDocument
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: data after document", ErrInvalidRecord)
+	}
+	if doc.Version != JSONVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, doc.Version)
+	}
+
+	repo := s.storage()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts, payments, favorites, err := s.validateDocument(&doc)
+	if err != nil {
+		return err
+	}
+
+	// документ уже разобран в записи, пишем их одним пакетом: сбой посреди
+	// записи не оставит в хранилище половину документа
+	err = s.atomically(func() error {
+		for _, account := range accounts {
+			err := repo.Accounts().Save(account)
+			if err != nil {
+				return err
+			}
+		}
+		for _, payment := range payments {
+			err := repo.Payments().Save(payment)
+			if err != nil {
+				return err
+			}
+		}
+		for _, favorite := range favorites {
+			err := repo.Favorites().Save(favorite)
+			if err != nil {
+				return err
+			}
+		}
+		return s.postOpeningBalances(accounts)
+	})
+	if err != nil {
+		return err
+	}
+	if doc.NextAccountID > s.nextAccountID {
+		s.nextAccountID = doc.NextAccountID
+	}
+	for _, account := range accounts {
+		if account.ID > s.nextAccountID {
+			s.nextAccountID = account.ID
+		}
+	}
+	return nil
+}
+
+// ExportJSONDir записывает документ ExportJSON в файл wallet.json каталога dir.
+// Файл заменяется целиком, поэтому сбой посреди записи не портит старый файл.
+func (s *Service) ExportJSONDir(dir string) error {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	err = s.ExportJSON(buf)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, jsonFileName), []string{string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))})
+}
+
+// ImportJSONDir читает файл wallet.json из каталога dir (см. ImportJSON).
+func (s *Service) ImportJSONDir(dir string) error {
+	file, err := os.Open(filepath.Join(dir, jsonFileName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return s.ImportJSON(file)
+}
+
+// exportDocument собирает документ под mu.Lock, чтобы nextAccountID
+// соответствовал записанным счетам.
+func (s *Service) exportDocument() (*jsonDocument, error) {
+	repo := s.storage()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc := &jsonDocument{
+		Version:       JSONVersion,
+		NextAccountID: s.nextAccountID,
+		Accounts:      []jsonAccount{},
+		Payments:      []jsonPayment{},
+		Favorites:     []jsonFavorite{},
+	}
+
+	accounts, err := repo.Accounts().All()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		doc.Accounts = append(doc.Accounts, jsonAccount{
+			ID:        account.ID,
+			Phone:     account.Phone,
+			Balance:   types.DecimalIn(account.Balance, currencyOf(account.Currency)),
+			Currency:  currencyOf(account.Currency),
+			CreatedAt: jsonTime(account.CreatedAt),
+			UpdatedAt: jsonTime(account.UpdatedAt),
+		})
+	}
+
+	payments, err := repo.Payments().All()
+	if err != nil {
+		return nil, err
+	}
+	for _, payment := range payments {
+		doc.Payments = append(doc.Payments, jsonPayment{
+			ID:            payment.ID,
+			AccountID:     payment.AccountID,
+			Amount:        types.DecimalIn(payment.Amount, currencyOf(payment.Currency)),
+			Category:      payment.Category,
+			Status:        payment.Status,
+			CounterpartID: payment.CounterpartID,
+			Currency:      currencyOf(payment.Currency),
+			CreatedAt:     jsonTime(payment.CreatedAt),
+			UpdatedAt:     jsonTime(payment.UpdatedAt),
+		})
+	}
+
+	favorites, err := repo.Favorites().All()
+	if err != nil {
+		return nil, err
+	}
+	for _, favorite := range favorites {
+		doc.Favorites = append(doc.Favorites, jsonFavorite{
+			ID:        favorite.ID,
+			AccountID: favorite.AccountID,
+			Name:      favorite.Name,
+			Amount:    types.DecimalIn(favorite.Amount, currencyOf(favorite.Currency)),
+			Category:  favorite.Category,
+			Currency:  currencyOf(favorite.Currency),
+			CreatedAt: jsonTime(favorite.CreatedAt),
+			UpdatedAt: jsonTime(favorite.UpdatedAt),
+		})
+	}
+	return doc, nil
+}
+
+// validateDocument проверяет записи документа между собой и против уже
+// сохранённых данных, вызывать под mu.Lock.
+func (s *Service) validateDocument(doc *jsonDocument) ([]*types.Account, []*types.Payment, []*types.Favorite, error) {
+	repo := s.storage()
+
+	// валюта счёта по ID: сначала из документа, потом из хранилища
+	currencies := make(map[int64]types.Currency, len(doc.Accounts))
+	phones := make(map[types.Phone]int64, len(doc.Accounts))
+	accounts := make([]*types.Account, 0, len(doc.Accounts))
+	// счета документа заменяют сохранённые с теми же ID, поэтому их телефоны
+	// проверяются по итогу импорта: такие счета могут обменяться телефонами
+	replaced := make(map[int64]bool, len(doc.Accounts))
+	for _, item := range doc.Accounts {
+		replaced[item.ID] = true
+	}
+	for i, item := range doc.Accounts {
+		fail := func(format string, args ...interface{}) error {
+			return recordError("account", i, fmt.Sprint(item.ID), format, args...)
+		}
+
+		if item.ID <= 0 {
+			return nil, nil, nil, fail("id must be positive")
+		}
+		if _, ok := currencies[item.ID]; ok {
+			return nil, nil, nil, fail("duplicate id")
+		}
+		if item.Phone == "" {
+			return nil, nil, nil, fail("empty phone")
+		}
+		if other, ok := phones[item.Phone]; ok {
+			return nil, nil, nil, fail("phone %s already used by account %d", item.Phone, other)
+		}
+		if stored, err := repo.Accounts().ByPhone(item.Phone); err == nil && stored.ID != item.ID && !replaced[stored.ID] {
+			return nil, nil, nil, fail("phone %s already registered to account %d", item.Phone, stored.ID)
+		}
+		currency, err := parseCurrency(string(item.Currency))
+		if err != nil {
+			return nil, nil, nil, fail("%v", err)
+		}
+		if stored, err := repo.Accounts().ByID(item.ID); err == nil && currencyOf(stored.Currency) != currency {
+			return nil, nil, nil, fail("currency of account %d cannot change from %s to %s", item.ID, currencyOf(stored.Currency), currency)
+		}
+
+		balance, err := item.Balance.MoneyIn(currency)
+		if err != nil {
+			return nil, nil, nil, fail("balance: %v", err)
+		}
+
+		currencies[item.ID] = currency
+		phones[item.Phone] = item.ID
+		accounts = append(accounts, &types.Account{
+			ID:        item.ID,
+			Phone:     item.Phone,
+			Balance:   balance,
+			Currency:  currency,
+			CreatedAt: fromJSONTime(item.CreatedAt),
+			UpdatedAt: fromJSONTime(item.UpdatedAt),
+		})
+	}
+	accountCurrency := func(accountID int64) (types.Currency, bool) {
+		if currency, ok := currencies[accountID]; ok {
+			return currency, true
+		}
+		stored, err := repo.Accounts().ByID(accountID)
+		if err != nil {
+			return "", false
+		}
+		return currencyOf(stored.Currency), true
+	}
+
+	paymentIDs := make(map[string]bool, len(doc.Payments))
+	for _, item := range doc.Payments {
+		paymentIDs[item.ID] = true
+	}
+	seen := make(map[string]bool, len(doc.Payments))
+	payments := make([]*types.Payment, 0, len(doc.Payments))
+	for i, item := range doc.Payments {
+		fail := func(format string, args ...interface{}) error {
+			return recordError("payment", i, item.ID, format, args...)
+		}
+
+		if item.ID == "" {
+			return nil, nil, nil, fail("empty id")
+		}
+		if seen[item.ID] {
+			return nil, nil, nil, fail("duplicate id")
+		}
+		seen[item.ID] = true
+		currency, ok := accountCurrency(item.AccountID)
+		if !ok {
+			return nil, nil, nil, fail("unknown account %d", item.AccountID)
+		}
+		if item.Category == "" {
+			return nil, nil, nil, fail("empty category")
+		}
+		if !isKnownStatus(item.Status) {
+			return nil, nil, nil, fail("unknown status %q", item.Status)
+		}
+		if item.CounterpartID != "" && !paymentIDs[item.CounterpartID] {
+			if _, err := repo.Payments().ByID(item.CounterpartID); err != nil {
+				return nil, nil, nil, fail("unknown counterpart payment %q", item.CounterpartID)
+			}
+		}
+		if item.Currency != currency {
+			return nil, nil, nil, fail("currency %s differs from account currency %s", item.Currency, currency)
+		}
+		amount, err := item.Amount.MoneyIn(currency)
+		if err != nil {
+			return nil, nil, nil, fail("amount: %v", err)
+		}
+		if amount <= 0 {
+			return nil, nil, nil, fail("amount must be positive")
+		}
+
+		payments = append(payments, &types.Payment{
+			ID:            item.ID,
+			AccountID:     item.AccountID,
+			Amount:        amount,
+			Category:      item.Category,
+			Status:        item.Status,
+			CounterpartID: item.CounterpartID,
+			Currency:      currency,
+			CreatedAt:     fromJSONTime(item.CreatedAt),
+			UpdatedAt:     fromJSONTime(item.UpdatedAt),
+		})
+	}
+
+	seen = make(map[string]bool, len(doc.Favorites))
+	favorites := make([]*types.Favorite, 0, len(doc.Favorites))
+	for i, item := range doc.Favorites {
+		fail := func(format string, args ...interface{}) error {
+			return recordError("favorite", i, item.ID, format, args...)
+		}
+
+		if item.ID == "" {
+			return nil, nil, nil, fail("empty id")
+		}
+		if seen[item.ID] {
+			return nil, nil, nil, fail("duplicate id")
+		}
+		seen[item.ID] = true
+		currency, ok := accountCurrency(item.AccountID)
+		if !ok {
+			return nil, nil, nil, fail("unknown account %d", item.AccountID)
+		}
+		if item.Category == "" {
+			return nil, nil, nil, fail("empty category")
+		}
+		if item.Currency != currency {
+			return nil, nil, nil, fail("currency %s differs from account currency %s", item.Currency, currency)
+		}
+		amount, err := item.Amount.MoneyIn(currency)
+		if err != nil {
+			return nil, nil, nil, fail("amount: %v", err)
+		}
+		if amount <= 0 {
+			return nil, nil, nil, fail("amount must be positive")
+		}
+
+		favorites = append(favorites, &types.Favorite{
+			ID:        item.ID,
+			AccountID: item.AccountID,
+			Name:      item.Name,
+			Amount:    amount,
+			Category:  item.Category,
+			Currency:  currency,
+			CreatedAt: fromJSONTime(item.CreatedAt),
+			UpdatedAt: fromJSONTime(item.UpdatedAt),
+		})
+	}
+	return accounts, payments, favorites, nil
+}
+
+func recordError(kind string, index int, id string, format string, args ...interface{}) error {
+	return &RecordError{
+		Kind:  kind,
+		Index: index,
+		ID:    id,
+		Err:   fmt.Errorf("%w: %s", ErrInvalidRecord, fmt.Sprintf(format, args...)),
+	}
+}
+
+func isKnownStatus(status types.PaymentStatus) bool {
+	switch status {
+	case types.PaymentStatusOk, types.PaymentStatusFail, types.PaymentStatusInProgress, types.PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
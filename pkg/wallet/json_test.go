@@ -0,0 +1,219 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func TestService_ExportJSON_roundTrip(t *testing.T) {
+	s, from, to := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 100, "food; drinks")
+	_, _ = s.Transfer(from.ID, to.Phone, 200)
+	_, _ = s.FavoritePayment(payment.ID, "lunch;\nevery day")
+	_, _ = s.RegisterAccountWithCurrency("+992900000003", types.CurrencyUSD)
+
+	buf := &bytes.Buffer{}
+	if err := s.ExportJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := &Service{}
+	if err := imported.ImportJSON(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("ImportJSON(): error = %v", err)
+	}
+	wantAccounts, wantPayments, wantFavorites, _ := s.snapshot()
+	gotAccounts, gotPayments, gotFavorites, _ := imported.snapshot()
+	if !reflect.DeepEqual(gotAccounts, wantAccounts) {
+		t.Errorf("ImportJSON(): accounts = %v, want %v", gotAccounts, wantAccounts)
+	}
+	if !reflect.DeepEqual(gotPayments, wantPayments) {
+		t.Errorf("ImportJSON(): payments = %v, want %v", gotPayments, wantPayments)
+	}
+	if !reflect.DeepEqual(gotFavorites, wantFavorites) {
+		t.Errorf("ImportJSON(): favorites = %v, want %v", gotFavorites, wantFavorites)
+	}
+
+	discrepancies, _ := imported.VerifyLedger()
+	if len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v after ImportJSON", discrepancies)
+	}
+	account, _ := imported.RegisterAccount("+992900000004")
+	if account.ID != 4 {
+		t.Errorf("RegisterAccount(): id = %v after ImportJSON, want 4", account.ID)
+	}
+}
+
+func TestService_ImportJSON_currencyExponent(t *testing.T) {
+	doc := `{"version":1,"nextAccountID":2,"accounts":[
+		{"id":1,"phone":"+992900000001","balance":"12345","currency":"JPY"},
+		{"id":2,"phone":"+992900000002","balance":"1.005","currency":"KWD"}
+	],"payments":[],"favorites":[]}`
+
+	s := &Service{}
+	if err := s.ImportJSON(strings.NewReader(doc)); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(t, s, 1, 12345)
+	assertBalance(t, s, 2, 1005)
+
+	buf := &bytes.Buffer{}
+	if err := s.ExportJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"balance": "12345"`, `"balance": "1.005"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("ExportJSON(): document has no %s:\n%s", want, buf)
+		}
+	}
+
+	yen := `{"version":1,"accounts":[{"id":1,"phone":"1","balance":"1.50","currency":"JPY"}]}`
+	var recordErr *RecordError
+	if err := (&Service{}).ImportJSON(strings.NewReader(yen)); !errors.As(err, &recordErr) || recordErr.Kind != "account" {
+		t.Errorf("ImportJSON(): must reject fractional yen, returned = %v", err)
+	}
+}
+
+func TestService_ImportJSON_keepsNextAccountID(t *testing.T) {
+	doc := `{"version":1,"nextAccountID":10,"accounts":[
+		{"id":2,"phone":"+992900000002","balance":"1.50","currency":"TJS"}
+	],"payments":[],"favorites":[]}`
+
+	s := &Service{}
+	if err := s.ImportJSON(strings.NewReader(doc)); err != nil {
+		t.Fatal(err)
+	}
+	account, _ := s.RegisterAccount("+992900000001")
+	if account.ID != 11 {
+		t.Errorf("RegisterAccount(): id = %v, want 11", account.ID)
+	}
+	assertBalance(t, s, 2, 150)
+}
+
+func TestService_ImportJSON_invalid(t *testing.T) {
+	const account = `{"id":1,"phone":"+992900000001","balance":"10.00","currency":"TJS"}`
+	const payment = `{"id":"p1","accountID":1,"amount":"1.00","category":"auto","status":"INPROGRESS","currency":"TJS"}`
+	document := func(accounts, payments, favorites string) string {
+		return `{"version":1,"nextAccountID":1,"accounts":[` + accounts + `],"payments":[` + payments + `],"favorites":[` + favorites + `]}`
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		kind string
+		id   string
+	}{
+		{"duplicate account", document(account+","+account, "", ""), "account", "1"},
+		{"bad currency", document(`{"id":1,"phone":"+992900000001","balance":"1.00","currency":"tjs"}`, "", ""), "account", "1"},
+		{"duplicate phone", document(account+`,{"id":2,"phone":"+992900000001","balance":"1.00","currency":"TJS"}`, "", ""), "account", "2"},
+		{"unknown account", document(account, `{"id":"p1","accountID":7,"amount":"1.00","category":"auto","status":"Ok","currency":"TJS"}`, ""), "payment", "p1"},
+		{"unknown status", document(account, `{"id":"p1","accountID":1,"amount":"1.00","category":"auto","status":"DONE","currency":"TJS"}`, ""), "payment", "p1"},
+		{"negative amount", document(account, `{"id":"p1","accountID":1,"amount":"-1.00","category":"auto","status":"Ok","currency":"TJS"}`, ""), "payment", "p1"},
+		{"unknown counterpart", document(account, `{"id":"p1","accountID":1,"amount":"1.00","category":"transfer-out","status":"Ok","counterpartID":"p2","currency":"TJS"}`, ""), "payment", "p1"},
+		{"currency mismatch", document(account, payment, `{"id":"f1","accountID":1,"name":"car","amount":"1.00","category":"auto","currency":"USD"}`), "favorite", "f1"},
+	}
+	for _, tt := range tests {
+		s := &Service{}
+		err := s.ImportJSON(strings.NewReader(tt.doc))
+
+		var recordErr *RecordError
+		if !errors.As(err, &recordErr) || !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("%s: ImportJSON() must return RecordError, returned = %v", tt.name, err)
+			continue
+		}
+		if recordErr.Kind != tt.kind || recordErr.ID != tt.id {
+			t.Errorf("%s: ImportJSON() error names %s %q, want %s %q", tt.name, recordErr.Kind, recordErr.ID, tt.kind, tt.id)
+		}
+		// ошибка в любой записи не меняет сервис
+		if accounts, _ := s.storage().Accounts().All(); len(accounts) != 0 {
+			t.Errorf("%s: ImportJSON() saved %v accounts from an invalid document", tt.name, len(accounts))
+		}
+	}
+}
+
+func TestService_ImportJSON_malformed(t *testing.T) {
+	tests := map[string]struct {
+		doc  string
+		want error
+	}{
+		"version":       {`{"version":2,"nextAccountID":0,"accounts":[],"payments":[],"favorites":[]}`, ErrUnsupportedVersion},
+		"unknown field": {`{"version":1,"accounts":[],"extra":true}`, ErrInvalidRecord},
+		"bad money":     {`{"version":1,"accounts":[{"id":1,"phone":"1","balance":"1.234","currency":"TJS"}]}`, ErrInvalidRecord},
+		"trailing data": {`{"version":1} {}`, ErrInvalidRecord},
+		"not json":      {`1;+992900000001;100`, ErrInvalidRecord},
+	}
+	for name, tt := range tests {
+		s := &Service{}
+		if err := s.ImportJSON(strings.NewReader(tt.doc)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ImportJSON() must return %v, returned = %v", name, tt.want, err)
+		}
+	}
+}
+
+func TestService_ImportJSON_phoneTaken(t *testing.T) {
+	s := &Service{}
+	_, _ = s.RegisterAccount("+992900000001")
+
+	doc := `{"version":1,"nextAccountID":5,"accounts":[{"id":5,"phone":"+992900000001","balance":"0.00","currency":"TJS"}],"payments":[],"favorites":[]}`
+	var recordErr *RecordError
+	if err := s.ImportJSON(strings.NewReader(doc)); !errors.As(err, &recordErr) || recordErr.ID != "5" {
+		t.Errorf("ImportJSON(): must reject a phone registered to another account, returned = %v", err)
+	}
+}
+
+func TestService_ExportJSONDir(t *testing.T) {
+	s := newTestService()
+	Transactions(s)
+	dir := t.TempDir()
+	if err := s.ExportJSONDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := &Service{}
+	if err := imported.ImportJSONDir(dir); err != nil {
+		t.Fatalf("ImportJSONDir(): error = %v", err)
+	}
+	want, _ := s.ExportAccountHistory(1)
+	got, _ := imported.ExportAccountHistory(1)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ImportJSONDir(): history = %v, want %v", got, want)
+	}
+
+	if err := imported.ImportJSONDir(t.TempDir()); err == nil {
+		t.Errorf("ImportJSONDir(): must fail without %s", jsonFileName)
+	}
+}
+
+func TestService_ImportJSON_swapPhones(t *testing.T) {
+	s := &Service{}
+	_, _ = s.RegisterAccount("+992900000001")
+	_, _ = s.RegisterAccount("+992900000002")
+
+	doc := `{"version":1,"nextAccountID":2,"accounts":[
+		{"id":1,"phone":"+992900000002","balance":"0.00","currency":"TJS"},
+		{"id":2,"phone":"+992900000001","balance":"0.00","currency":"TJS"}
+	],"payments":[],"favorites":[]}`
+	if err := s.ImportJSON(strings.NewReader(doc)); err != nil {
+		t.Fatalf("ImportJSON(): must allow accounts of the document to swap phones, returned = %v", err)
+	}
+	account, err := s.storage().Accounts().ByPhone("+992900000001")
+	if err != nil || account.ID != 2 {
+		t.Errorf("ByPhone() = %v, %v after swapping phones, want account 2", account, err)
+	}
+}
+
+func TestService_ImportJSON_oneBatch(t *testing.T) {
+	doc := `{"version":1,"nextAccountID":2,"accounts":[
+		{"id":1,"phone":"+992900000001","balance":"10.00","currency":"TJS"},
+		{"id":2,"phone":"+992900000002","balance":"5.00","currency":"TJS"}
+	],"payments":[
+		{"id":"p1","accountID":1,"amount":"1.00","category":"auto","status":"Ok","currency":"TJS"}
+	],"favorites":[]}`
+	assertOneBatch(t, t.TempDir(), "ImportJSON()", func(s *Service) error {
+		return s.ImportJSON(strings.NewReader(doc))
+	})
+}
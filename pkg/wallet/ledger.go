@@ -0,0 +1,270 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FrankS17/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+// ErrUnbalancedEntry возвращается, если сумма сторон проводки не равна нулю.
+var ErrUnbalancedEntry = errors.New("unbalanced ledger entry")
+
+// Системные счета книги проводок.
+const (
+	ledgerDeposits types.LedgerAccount = "external:deposits"
+	ledgerOpening  types.LedgerAccount = "external:opening"
+)
+
+const (
+	walletLedgerPrefix   = "wallet:"
+	categoryLedgerPrefix = "category:"
+)
+
+// LedgerDiscrepancy описывает счёт, у которого сохранённый баланс
+// не совпадает с балансом, посчитанным по проводкам.
+type LedgerDiscrepancy struct {
+	AccountID int64
+	Balance   types.Money // баланс, сохранённый в счёте
+	Ledger    types.Money // баланс по проводкам
+}
+
+func walletLedgerAccount(accountID int64) types.LedgerAccount {
+	return types.LedgerAccount(walletLedgerPrefix + strconv.FormatInt(accountID, 10))
+}
+
+func categoryLedgerAccount(category types.PaymentCategory) types.LedgerAccount {
+	return types.LedgerAccount(categoryLedgerPrefix + string(category))
+}
+
+// walletAccountID возвращает ID кошелька, если счёт книги принадлежит клиенту.
+func walletAccountID(account types.LedgerAccount) (int64, bool) {
+	if !strings.HasPrefix(string(account), walletLedgerPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(string(account), walletLedgerPrefix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// post записывает проводку и обновляет кэш балансов затронутых кошельков.
+// Вызывать под блокировками всех затронутых счетов.
+func (s *Service) post(kind types.EntryKind, paymentID string, postings ...types.Posting) error {
+	prepared, err := s.prepareEntry(kind, paymentID, postings...)
+	if err != nil {
+		return err
+	}
+	return s.commitEntries(prepared)
+}
+
+// preparedEntry проводка, проверенная до записи, и новые балансы её кошельков.
+type preparedEntry struct {
+	entry   *types.LedgerEntry
+	changed map[int64]*types.Account
+	order   []int64
+}
+
+// prepareEntry проверяет проводку и считает новые балансы, ничего не записывая.
+func (s *Service) prepareEntry(kind types.EntryKind, paymentID string, postings ...types.Posting) (*preparedEntry, error) {
+	entry := &types.LedgerEntry{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		PaymentID: paymentID,
+		Postings:  postings,
+	}
+	err := checkEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := s.storage()
+
+	// новые балансы считаем до записи проводки: при переполнении в книге
+	// не должно остаться проводки, которой нет в балансах
+	prepared := &preparedEntry{entry: entry, changed: make(map[int64]*types.Account, len(postings))}
+	for _, posting := range postings {
+		accountID, ok := walletAccountID(posting.Account)
+		if !ok {
+			continue
+		}
+		account, ok := prepared.changed[accountID]
+		if !ok {
+			account, err = repo.Accounts().ByID(accountID)
+			if err != nil {
+				return nil, err
+			}
+			prepared.changed[accountID] = account
+			prepared.order = append(prepared.order, accountID)
+		}
+		account.Balance, err = account.Balance.Add(posting.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return prepared, nil
+}
+
+// commitEntries записывает проверенные проводки и балансы их кошельков.
+// Кошельки разных проводок не должны пересекаться: балансы каждой
+// посчитаны без учёта остальных.
+func (s *Service) commitEntries(entries ...*preparedEntry) error {
+	repo := s.storage()
+
+	now := s.now()
+	for _, prepared := range entries {
+		err := repo.Ledger().Append(prepared.entry)
+		if err != nil {
+			return err
+		}
+		for _, accountID := range prepared.order {
+			prepared.changed[accountID].UpdatedAt = now
+			err = repo.Accounts().Save(prepared.changed[accountID])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkEntry(entry *types.LedgerEntry) error {
+	sum := types.Money(0)
+	for _, posting := range entry.Postings {
+		var err error
+		sum, err = sum.Add(posting.Amount)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrUnbalancedEntry, entry.ID, err)
+		}
+	}
+	if sum != 0 || len(entry.Postings) < 2 {
+		return fmt.Errorf("%w: %s", ErrUnbalancedEntry, entry.ID)
+	}
+	return nil
+}
+
+// ledgerBalances считает балансы кошельков по всем проводкам.
+func ledgerBalances(entries []*types.LedgerEntry) (map[int64]types.Money, error) {
+	balances := make(map[int64]types.Money)
+	for _, entry := range entries {
+		err := checkEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		for _, posting := range entry.Postings {
+			if accountID, ok := walletAccountID(posting.Account); ok {
+				balances[accountID], err = balances[accountID].Add(posting.Amount)
+				if err != nil {
+					return nil, fmt.Errorf("wallet %d: %w", accountID, err)
+				}
+			}
+		}
+	}
+	return balances, nil
+}
+
+// postOpeningBalances выравнивает книгу по балансам, пришедшим извне
+// (Import, ImportFromFile), проводками вида opening. Вызывать под mu.Lock.
+func (s *Service) postOpeningBalances(accounts []*types.Account) error {
+	entries, err := s.storage().Ledger().All()
+	if err != nil {
+		return err
+	}
+	balances, err := ledgerBalances(entries)
+	if err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		diff := account.Balance - balances[account.ID]
+		if diff == 0 {
+			continue
+		}
+		entry := &types.LedgerEntry{
+			ID:   uuid.New().String(),
+			Kind: types.EntryKindOpening,
+			Postings: []types.Posting{
+				{Account: ledgerOpening, Amount: -diff},
+				{Account: walletLedgerAccount(account.ID), Amount: diff},
+			},
+		}
+		err = s.storage().Ledger().Append(entry)
+		if err != nil {
+			return err
+		}
+		balances[account.ID] = account.Balance
+	}
+	return nil
+}
+
+// VerifyLedger пересчитывает балансы всех счетов по проводкам и возвращает
+// счета, у которых сохранённый баланс с ними не сходится.
+func (s *Service) VerifyLedger() ([]LedgerDiscrepancy, error) {
+	repo := s.storage()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := repo.Ledger().All()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := ledgerBalances(entries)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := repo.Accounts().All()
+	if err != nil {
+		return nil, err
+	}
+
+	discrepancies := []LedgerDiscrepancy{}
+	for _, account := range accounts {
+		if account.Balance != balances[account.ID] {
+			discrepancies = append(discrepancies, LedgerDiscrepancy{
+				AccountID: account.ID,
+				Balance:   account.Balance,
+				Ledger:    balances[account.ID],
+			})
+		}
+		delete(balances, account.ID)
+	}
+	// проводки по кошелькам, которых нет среди счетов
+	for accountID, balance := range balances {
+		if balance != 0 {
+			discrepancies = append(discrepancies, LedgerDiscrepancy{AccountID: accountID, Ledger: balance})
+		}
+	}
+	sort.Slice(discrepancies, func(i, j int) bool {
+		return discrepancies[i].AccountID < discrepancies[j].AccountID
+	})
+	return discrepancies, nil
+}
+
+// AccountLedger возвращает проводки счёта в порядке записи, из них видно,
+// как сложился текущий баланс.
+func (s *Service) AccountLedger(accountID int64) ([]types.LedgerEntry, error) {
+	repo := s.storage()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, err := repo.Accounts().ByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := repo.Ledger().ByAccount(walletLedgerAccount(accountID))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]types.LedgerEntry, 0, len(stored))
+	for _, entry := range stored {
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,181 @@
+package wallet
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func TestService_AccountLedger_postings(t *testing.T) {
+	s := &Service{}
+	account, _ := s.RegisterAccount("+992900000001")
+	_ = s.Deposit(account.ID, 1_000)
+	payment, _ := s.Pay(account.ID, 300, "auto")
+	_ = s.Reject(payment.ID)
+
+	entries, err := s.AccountLedger(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet := walletLedgerAccount(account.ID)
+	want := []struct {
+		kind     types.EntryKind
+		postings []types.Posting
+	}{
+		{types.EntryKindDeposit, []types.Posting{{Account: ledgerDeposits, Amount: -1_000}, {Account: wallet, Amount: 1_000}}},
+		{types.EntryKindPayment, []types.Posting{{Account: wallet, Amount: -300}, {Account: "category:auto", Amount: 300}}},
+		{types.EntryKindRefund, []types.Posting{{Account: "category:auto", Amount: -300}, {Account: wallet, Amount: 300}}},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("AccountLedger(): got %v entries, want %v", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.Kind != want[i].kind {
+			t.Errorf("AccountLedger(): entry %v kind = %v, want %v", i, entry.Kind, want[i].kind)
+		}
+		if !reflect.DeepEqual(entry.Postings, want[i].postings) {
+			t.Errorf("AccountLedger(): entry %v postings = %v, want %v", i, entry.Postings, want[i].postings)
+		}
+	}
+	if entries[1].PaymentID != payment.ID || entries[2].PaymentID != payment.ID {
+		t.Errorf("AccountLedger(): payment and refund entries must reference payment %v", payment.ID)
+	}
+
+	if _, err := s.AccountLedger(404); err != ErrAccountNotFound {
+		t.Errorf("AccountLedger(): must return ErrAccountNotFound, returned = %v", err)
+	}
+}
+
+func TestService_VerifyLedger_clean(t *testing.T) {
+	s := newTestService()
+	Transactions(s)
+	_ = s.Reject(mustHistory(t, s, 1)[0].ID)
+
+	discrepancies, err := s.VerifyLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v, want none", discrepancies)
+	}
+}
+
+func TestService_VerifyLedger_discrepancy(t *testing.T) {
+	repo := NewMemoryRepository()
+	s, _ := NewService(repo)
+	account, _ := s.RegisterAccount("+992900000001")
+	_ = s.Deposit(account.ID, 1_000)
+
+	// баланс изменили в обход книги
+	stored, _ := repo.Accounts().ByID(account.ID)
+	stored.Balance = 5_000
+	_ = repo.Accounts().Save(stored)
+
+	discrepancies, err := s.VerifyLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LedgerDiscrepancy{{AccountID: account.ID, Balance: 5_000, Ledger: 1_000}}
+	if !reflect.DeepEqual(discrepancies, want) {
+		t.Errorf("VerifyLedger(): got %v, want %v", discrepancies, want)
+	}
+}
+
+func TestService_VerifyLedger_unbalancedEntry(t *testing.T) {
+	repo := NewMemoryRepository()
+	s, _ := NewService(repo)
+	_ = repo.Ledger().Append(&types.LedgerEntry{
+		ID:       "broken",
+		Kind:     types.EntryKindDeposit,
+		Postings: []types.Posting{{Account: walletLedgerAccount(1), Amount: 100}},
+	})
+
+	_, err := s.VerifyLedger()
+	if !errors.Is(err, ErrUnbalancedEntry) {
+		t.Errorf("VerifyLedger(): must return ErrUnbalancedEntry, returned = %v", err)
+	}
+}
+
+func TestService_Import_postsOpeningBalances(t *testing.T) {
+	source := newTestService()
+	Transactions(source)
+	dir := t.TempDir()
+	if err := source.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Service{}
+	if err := s.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	// повторный импорт тех же балансов не должен добавлять проводок
+	if err := s.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	discrepancies, err := s.VerifyLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v after Import", discrepancies)
+	}
+	entries, _ := s.AccountLedger(1)
+	if len(entries) != 1 || entries[0].Kind != types.EntryKindOpening {
+		t.Errorf("AccountLedger(): want one opening entry after Import, got %v", entries)
+	}
+}
+
+func TestFileRepository_ledgerSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 5)
+	fillService(t, s)
+	_ = repo.Close()
+
+	restored, repo := openFileService(t, dir, 5)
+	defer repo.Close()
+
+	discrepancies, err := restored.VerifyLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v after restart", discrepancies)
+	}
+	want, _ := s.AccountLedger(1)
+	got, _ := restored.AccountLedger(1)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("AccountLedger(): got %v, want %v", got, want)
+	}
+}
+
+func mustHistory(t *testing.T, s *testService, accountID int64) []types.Payment {
+	t.Helper()
+
+	payments, err := s.ExportAccountHistory(accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payments
+}
+
+func TestService_Deposit_overflow(t *testing.T) {
+	s := &Service{}
+	account, _ := s.RegisterAccount("+992900000001")
+	if err := s.Deposit(account.ID, math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Deposit(account.ID, 1); err != ErrMoneyOverflow {
+		t.Errorf("Deposit(): must return ErrMoneyOverflow, returned = %v", err)
+	}
+	assertBalance(t, s, account.ID, math.MaxInt64)
+	entries, _ := s.AccountLedger(account.ID)
+	if len(entries) != 1 {
+		t.Errorf("AccountLedger(): overflowing deposit must not be posted, got %v entries", len(entries))
+	}
+}
@@ -0,0 +1,77 @@
+package wallet
+
+import (
+	"sort"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// Accounts возвращает копии всех счетов по возрастанию ID.
+func (s *Service) Accounts() ([]types.Account, error) {
+	repo := s.storage()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := repo.Accounts().All()
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]types.Account, 0, len(stored))
+	for _, account := range stored {
+		accounts = append(accounts, *account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].ID < accounts[j].ID
+	})
+	return accounts, nil
+}
+
+// Payments возвращает копии всех платежей по времени создания, платежи с
+// одинаковым временем (и старые, без времени) — по ID.
+func (s *Service) Payments() ([]types.Payment, error) {
+	repo := s.storage()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := repo.Payments().All()
+	if err != nil {
+		return nil, err
+	}
+	payments := make([]types.Payment, 0, len(stored))
+	for _, payment := range stored {
+		payments = append(payments, *payment)
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		if !payments[i].CreatedAt.Equal(payments[j].CreatedAt) {
+			return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+		}
+		return payments[i].ID < payments[j].ID
+	})
+	return payments, nil
+}
+
+// Favorites возвращает копии всего избранного, упорядоченные по имени, затем по ID.
+func (s *Service) Favorites() ([]types.Favorite, error) {
+	repo := s.storage()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := repo.Favorites().All()
+	if err != nil {
+		return nil, err
+	}
+	favorites := make([]types.Favorite, 0, len(stored))
+	for _, favorite := range stored {
+		favorites = append(favorites, *favorite)
+	}
+	sort.Slice(favorites, func(i, j int) bool {
+		if favorites[i].Name != favorites[j].Name {
+			return favorites[i].Name < favorites[j].Name
+		}
+		return favorites[i].ID < favorites[j].ID
+	})
+	return favorites, nil
+}
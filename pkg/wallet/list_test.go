@@ -0,0 +1,47 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func TestService_Accounts_Payments_Favorites(t *testing.T) {
+	s := &Service{}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.SetClock(ClockFunc(func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}))
+
+	for _, phone := range []string{"+992900000003", "+992900000001", "+992900000002"} {
+		account, _ := s.RegisterAccount(types.Phone(phone))
+		_ = s.Deposit(account.ID, 1000)
+	}
+	first, _ := s.Pay(2, 100, "auto")
+	second, _ := s.Pay(1, 200, "food")
+	third, _ := s.Pay(3, 300, "auto")
+	_, _ = s.FavoritePayment(third.ID, "taxi")
+	_, _ = s.FavoritePayment(first.ID, "car")
+
+	accounts, err := s.Accounts()
+	if err != nil || len(accounts) != 3 || accounts[0].ID != 1 || accounts[2].ID != 3 {
+		t.Errorf("Accounts() = %v, %v, want IDs 1, 2, 3", accounts, err)
+	}
+	// изменение копии не меняет сервис
+	accounts[0].Balance = 0
+	if account, _ := s.FindAccountByID(1); account.Balance != 800 {
+		t.Errorf("Accounts() returned a shared account, balance = %v", account.Balance)
+	}
+
+	payments, err := s.Payments()
+	if err != nil || len(payments) != 3 || payments[0].ID != first.ID || payments[1].ID != second.ID || payments[2].ID != third.ID {
+		t.Errorf("Payments() = %v, %v, want in creation order", payments, err)
+	}
+
+	favorites, err := s.Favorites()
+	if err != nil || len(favorites) != 2 || favorites[0].Name != "car" || favorites[1].Name != "taxi" {
+		t.Errorf("Favorites() = %v, %v, want car, taxi", favorites, err)
+	}
+}
@@ -0,0 +1,388 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// manifestFileName манифест дампа: число записей и SHA-256 каждого файла.
+const manifestFileName = "manifest.dump"
+
+// manifestVersion версия формата манифеста, первая строка "manifest;1".
+const manifestVersion = 1
+
+// ErrManifestMismatch возвращается, если файлы дампа не совпадают с
+// манифестом: дамп повреждён или изменён после Export.
+var ErrManifestMismatch = errors.New("dump does not match manifest")
+
+// Суффиксы файлов незавершённого commit: pendingSuffix у новых файлов
+// дампа и манифеста, commitSuffix у манифеста, прошедшего точку фиксации.
+const (
+	pendingSuffix = ".new"
+	commitSuffix  = ".commit"
+)
+
+// exportFiles файлы дампа Export, манифест manifestFileName.
+var exportFiles = []string{accountsFileName, paymentsFileName, favoritesFileName, keysFileName}
+
+// manifestEntry строка манифеста "имя;записей;sha256".
+type manifestEntry struct {
+	name    string
+	records int
+	sum     string
+}
+
+// dumpSet собирает файлы дампа в файлах <имя>.new каталога и ставит их
+// на место только после того, как все записаны и сброшены на диск.
+// manifest — имя файла манифеста, пустое означает manifestFileName.
+type dumpSet struct {
+	dir       string
+	manifest  string
+	pending   []pendingDump
+	committed bool
+}
+
+type pendingDump struct {
+	tmp   string
+	entry manifestEntry
+}
+
+// newDumpSet доводит до конца или отменяет прерванный commit прошлого
+// дампа (см. recoverDump) и возвращает пустой набор. files — имена или
+// шаблоны filepath.Match файлов, которые пишет набор.
+func newDumpSet(dir, manifest string, files []string) (*dumpSet, error) {
+	err := recoverDump(dir, manifest, files)
+	if err != nil {
+		return nil, err
+	}
+	return &dumpSet{dir: dir, manifest: manifest}, nil
+}
+
+// add пишет файл name в <name>.new, считая записи и контрольную сумму.
+func (d *dumpSet) add(name string, encode func(enc *DumpEncoder) error) error {
+	pending, err := writePending(d.dir, name, encode)
+	if pending.tmp != "" {
+		d.pending = append(d.pending, pending)
+	}
+	return err
+}
+
+// writePending пишет файл name в <name>.new каталога dir. Не трогает
+// dumpSet, поэтому файлы можно писать параллельно и добавить в pending потом.
+func writePending(dir, name string, encode func(enc *DumpEncoder) error) (pendingDump, error) {
+	tmp, err := os.OpenFile(filepath.Join(dir, name+pendingSuffix), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return pendingDump{}, err
+	}
+
+	sum := sha256.New()
+	enc := NewDumpEncoder(io.MultiWriter(tmp, sum))
+	err = encode(enc)
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	pending := pendingDump{
+		tmp:   tmp.Name(),
+		entry: manifestEntry{name: name, records: enc.records, sum: hex.EncodeToString(sum.Sum(nil))},
+	}
+	return pending, err
+}
+
+// commit ставит набор на место. Манифест пишется в <manifest>.new и
+// переименовывается в <manifest>.commit — это точка фиксации: после неё
+// сбой не теряет новый дамп, recoverDump при следующем Import или Export
+// доведёт переименования до конца. До неё сбой оставляет старый дамп, а
+// файлы .new recoverDump удалит.
+func (d *dumpSet) commit() error {
+	name := d.manifest
+	if name == "" {
+		name = manifestFileName
+	}
+	path := filepath.Join(d.dir, name)
+	manifest, err := os.OpenFile(path+pendingSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(manifest.Name())
+
+	entries := make([]manifestEntry, 0, len(d.pending))
+	for _, pending := range d.pending {
+		entries = append(entries, pending.entry)
+	}
+	err = encodeManifest(NewDumpEncoder(manifest), entries)
+	if err == nil {
+		err = manifest.Sync()
+	}
+	if cerr := manifest.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = syncDir(d.dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(manifest.Name(), path+commitSuffix)
+	if err != nil {
+		return err
+	}
+	d.committed = true
+	err = syncDir(d.dir)
+	if err != nil {
+		return err
+	}
+	return finishCommit(d.dir, name, entries)
+}
+
+// discard удаляет файлы .new, если commit не дошёл до точки фиксации.
+// После неё файлы нужны recoverDump.
+func (d *dumpSet) discard() {
+	if d.committed {
+		return
+	}
+	for _, pending := range d.pending {
+		_ = os.Remove(pending.tmp)
+	}
+}
+
+// finishCommit переименовывает файлы .new на место по записям манифеста
+// (файл без записей тоже: пустой файл заменяет записи старого дампа) и
+// последним ставит манифест из <manifest>.commit. Повторный вызов после
+// сбоя безопасен: отсутствующий .new уже переименован.
+func finishCommit(dir, manifest string, entries []manifestEntry) error {
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.name)
+		err := os.Rename(path+pendingSuffix, path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err := syncDir(dir)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, manifest)
+	err = os.Rename(path+commitSuffix, path)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// recoverDump доводит до конца или отменяет commit, прерванный сбоем.
+// Есть <manifest>.commit — commit прошёл точку фиксации и завершается
+// finishCommit. Нет — удаляются недописанные <manifest>.new и файлы .new
+// для files, а заодно временные *.tmp, которые оставляли прежние версии.
+// Отсутствующий каталог не ошибка.
+func recoverDump(dir, manifest string, files []string) error {
+	entries, err := readManifest(filepath.Join(dir, manifest+commitSuffix))
+	if err == nil {
+		return finishCommit(dir, manifest, entries)
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	names, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	patterns := []string{manifest + pendingSuffix, manifest + ".*.tmp"}
+	for _, file := range files {
+		patterns = append(patterns, file+pendingSuffix, file+".*.tmp")
+	}
+	for _, entry := range names {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, entry.Name()); !ok {
+				continue
+			}
+			err = os.Remove(filepath.Join(dir, entry.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// syncDir сбрасывает на диск записи каталога, чтобы переименования пережили сбой.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// encodeManifest записывает манифест с записями entries.
+func encodeManifest(enc *DumpEncoder, entries []manifestEntry) error {
+	err := enc.writeLine("manifest;" + strconv.Itoa(manifestVersion))
+	for _, entry := range entries {
+		if err != nil {
+			return err
+		}
+		err = enc.writeLine(escapeField(entry.name) + ";" + strconv.Itoa(entry.records) + ";" + entry.sum)
+	}
+	if err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// verifyManifest завершает прерванный Export (recoverDump) и сверяет файлы
+// дампа в dir с манифестом. Каталог без манифеста (дамп старого формата)
+// не проверяется.
+func verifyManifest(dir string) error {
+	err := recoverDump(dir, manifestFileName, exportFiles)
+	if err != nil {
+		return err
+	}
+	entries, err := readManifest(filepath.Join(dir, manifestFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return verifyEntries(entries, dirChecksum(dir))
+}
+
+// dirChecksum считает записи и контрольную сумму файлов каталога dir.
+func dirChecksum(dir string) func(name string) (int, string, error) {
+	return func(name string) (int, string, error) {
+		return checksumFile(filepath.Join(dir, name))
+	}
+}
+
+// verifyEntries сверяет файлы с записями манифеста. checksum возвращает
+// число записей и SHA-256 файла или ошибку os.IsNotExist для отсутствующего.
+func verifyEntries(entries []manifestEntry, checksum func(name string) (int, string, error)) error {
+	for _, entry := range entries {
+		records, sum, err := checksum(entry.name)
+		if os.IsNotExist(err) && entry.records == 0 {
+			continue
+		}
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s is missing", ErrManifestMismatch, entry.name)
+		}
+		if err != nil {
+			return err
+		}
+		if records != entry.records {
+			return fmt.Errorf("%w: %s has %d records, want %d", ErrManifestMismatch, entry.name, records, entry.records)
+		}
+		if sum != entry.sum {
+			return fmt.Errorf("%w: %s checksum %s, want %s", ErrManifestMismatch, entry.name, sum, entry.sum)
+		}
+	}
+	return nil
+}
+
+func readManifest(path string) ([]manifestEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseManifest(file, filepath.Base(path))
+}
+
+// parseManifest разбирает манифест name из r.
+func parseManifest(r io.Reader, name string) ([]manifestEntry, error) {
+	dec := NewDumpDecoder(r)
+	header, err := dec.readLine()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: %s is empty", ErrManifestMismatch, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header != "manifest;"+strconv.Itoa(manifestVersion) {
+		return nil, fmt.Errorf("%w: %s: %q", ErrUnsupportedVersion, name, header)
+	}
+
+	entries := []manifestEntry{}
+	for {
+		line, err := dec.readLine()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fields := splitFields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%w: %s line %d: want 3 fields, got %d", ErrManifestMismatch, name, dec.Line(), len(fields))
+		}
+		records, err := strconv.Atoi(fields[1])
+		if err != nil || records < 0 || filepath.Base(fields[0]) != fields[0] {
+			return nil, fmt.Errorf("%w: %s line %d: %q", ErrManifestMismatch, name, dec.Line(), line)
+		}
+		entries = append(entries, manifestEntry{name: fields[0], records: records, sum: fields[2]})
+	}
+}
+
+// checksumFile считает строки (записи) и SHA-256 файла, не читая его в память целиком.
+func checksumFile(path string) (int, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	counter := newLineCounter()
+	_, err = io.Copy(counter, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return counter.lines, counter.sum(), nil
+}
+
+// lineCounter считает строки и SHA-256 записанного.
+type lineCounter struct {
+	hash  hash.Hash
+	lines int
+}
+
+func newLineCounter() *lineCounter {
+	return &lineCounter{hash: sha256.New()}
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			c.lines++
+		}
+	}
+	return c.hash.Write(p)
+}
+
+func (c *lineCounter) sum() string {
+	return hex.EncodeToString(c.hash.Sum(nil))
+}
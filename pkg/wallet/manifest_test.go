@@ -0,0 +1,225 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestService_Export_manifest(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	_, _ = s.Pay(from.ID, 100, "food")
+	dir := filepath.Join(t.TempDir(), "nested", "dump")
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readManifest(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, entry := range entries {
+		got[entry.name] = entry.records
+	}
+	want := map[string]int{accountsFileName: 2, paymentsFileName: 1, favoritesFileName: 0, keysFileName: 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("manifest records = %v, want %v", got, want)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(names) != len(exportFiles)+1 {
+		t.Errorf("Export() left %v, want the dump files and the manifest", names)
+	}
+	for _, name := range names {
+		base := filepath.Base(name)
+		if _, ok := want[base]; !ok && base != manifestFileName {
+			t.Errorf("Export() left %s in the dump directory", base)
+		}
+	}
+	if err := (&Service{}).Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+	}
+}
+
+func TestService_Export_removesStaleFiles(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 100, "food")
+	_, _ = s.FavoritePayment(payment.ID, "lunch")
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// избранного больше нет, старый файл не должен вернуть его при импорте
+	empty := &Service{}
+	_, _ = empty.RegisterAccount("+992900000001")
+	if err := empty.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, favoritesFileName)); err != nil || info.Size() != 0 {
+		t.Errorf("Export(): %s = %v, %v, want an empty file", favoritesFileName, info, err)
+	}
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if favorites, _ := imported.storage().Favorites().All(); len(favorites) != 0 {
+		t.Errorf("Import(): stale favorites %v came back", favorites)
+	}
+}
+
+func TestService_Import_manifestMismatch(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	_, _ = s.Pay(from.ID, 100, "food")
+
+	tests := map[string]func(dir string) error{
+		"changed": func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, accountsFileName), []byte("1;+992900000001;999999\n2;+992900000002;0\n"), 0666)
+		},
+		"truncated": func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, paymentsFileName), nil, 0666)
+		},
+		"missing": func(dir string) error {
+			return os.Remove(filepath.Join(dir, accountsFileName))
+		},
+	}
+	for name, corrupt := range tests {
+		dir := t.TempDir()
+		if err := s.Export(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := corrupt(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		imported := &Service{}
+		if err := imported.Import(dir); !errors.Is(err, ErrManifestMismatch) {
+			t.Errorf("%s: Import() must return ErrManifestMismatch, returned = %v", name, err)
+		}
+		if _, err := imported.ImportStrict(dir, ImportOptions{}); !errors.Is(err, ErrManifestMismatch) {
+			t.Errorf("%s: ImportStrict() must return ErrManifestMismatch, returned = %v", name, err)
+		}
+		if accounts, _ := imported.storage().Accounts().All(); len(accounts) != 0 {
+			t.Errorf("%s: Import() loaded %v accounts from a mismatched dump", name, len(accounts))
+		}
+	}
+}
+
+func TestService_Export_mkdirError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Service{}).Export(filepath.Join(file, "dump")); err == nil {
+		t.Errorf("Export(): must fail when the directory cannot be created")
+	}
+}
+
+// interruptedExport оставляет в dir дамп old и файлы commit дампа new,
+// прерванного сбоем: commitPoint — манифест успел стать <manifest>.commit,
+// renamed — сколько файлов уже переименовано на место.
+func interruptedExport(t *testing.T, dir string, commitPoint bool, renamed int) {
+	t.Helper()
+
+	next := t.TempDir()
+	s, from, _ := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 100, "food")
+	_, _ = s.FavoritePayment(payment.ID, "lunch")
+	if err := s.Export(next); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestSuffix := pendingSuffix
+	if commitPoint {
+		manifestSuffix = commitSuffix
+	}
+	moves := map[string]string{manifestFileName: manifestFileName + manifestSuffix}
+	for i, name := range []string{accountsFileName, paymentsFileName, favoritesFileName} {
+		moves[name] = name + pendingSuffix
+		if i < renamed {
+			moves[name] = name
+		}
+	}
+	for from, to := range moves {
+		data, err := os.ReadFile(filepath.Join(next, from))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, to), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestService_Import_interruptedExport(t *testing.T) {
+	old := &Service{}
+	_, _ = old.RegisterAccount("+992900000009")
+
+	tests := []struct {
+		name        string
+		commitPoint bool
+		renamed     int
+		accounts    int
+		favorites   int
+	}{
+		{"before commit point", false, 0, 1, 0},
+		{"after commit point", true, 0, 2, 1},
+		{"after partial rename", true, 2, 2, 1},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		if err := old.Export(dir); err != nil {
+			t.Fatal(err)
+		}
+		interruptedExport(t, dir, test.commitPoint, test.renamed)
+
+		s := &Service{}
+		if err := s.Import(dir); err != nil {
+			t.Fatalf("%s: Import() error = %v", test.name, err)
+		}
+		accounts, _ := s.storage().Accounts().All()
+		favorites, _ := s.storage().Favorites().All()
+		if len(accounts) != test.accounts || len(favorites) != test.favorites {
+			t.Errorf("%s: imported %d accounts, %d favorites, want %d, %d", test.name, len(accounts), len(favorites), test.accounts, test.favorites)
+		}
+
+		names, _ := filepath.Glob(filepath.Join(dir, "*"))
+		for _, name := range names {
+			if ext := filepath.Ext(name); ext != ".dump" {
+				t.Errorf("%s: Import() left %s in the dump directory", test.name, filepath.Base(name))
+			}
+		}
+	}
+}
+
+func TestService_Export_afterInterruptedExport(t *testing.T) {
+	dir := t.TempDir()
+	interruptedExport(t, dir, false, 0)
+	if err := os.WriteFile(filepath.Join(dir, accountsFileName+".123.tmp"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Service{}
+	_, _ = s.RegisterAccount("+992900000009")
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	want := []string{accountsFileName, favoritesFileName, keysFileName, manifestFileName, paymentsFileName}
+	got := []string{}
+	for _, name := range names {
+		got = append(got, filepath.Base(name))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Export() left %v, want %v", got, want)
+	}
+	// файлы без записей остаются пустыми, а не пропадают
+	for _, name := range []string{paymentsFileName, favoritesFileName, keysFileName} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || info.Size() != 0 {
+			t.Errorf("Export(): %s = %v, %v, want an empty file", name, info, err)
+		}
+	}
+}
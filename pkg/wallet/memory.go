@@ -0,0 +1,417 @@
+package wallet
+
+import (
+	"sync"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// memoryRepository хранит всё в памяти процесса, это хранилище по умолчанию.
+// Слайсы хранят записи в порядке добавления (он нужен для Export), а поиск
+// идёт по индексам в map.
+type memoryRepository struct {
+	accounts  *memoryAccounts
+	payments  *memoryPayments
+	favorites *memoryFavorites
+	ledger    *memoryLedger
+	keys      *memoryKeys
+}
+
+// NewMemoryRepository создаёт пустое хранилище в памяти.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		accounts: &memoryAccounts{
+			byID:    make(map[int64]*types.Account),
+			byPhone: make(map[types.Phone]*types.Account),
+		},
+		payments: &memoryPayments{
+			byID:      make(map[string]*types.Payment),
+			byAccount: make(map[int64][]*types.Payment),
+			history:   make(map[string][]types.PaymentStatusChange),
+		},
+		favorites: &memoryFavorites{
+			byID: make(map[string]*types.Favorite),
+		},
+		ledger: &memoryLedger{
+			byID:      make(map[string]bool),
+			byAccount: make(map[types.LedgerAccount][]*types.LedgerEntry),
+		},
+		keys: &memoryKeys{
+			byKey: make(map[string]*types.IdempotencyRecord),
+		},
+	}
+}
+
+func (r *memoryRepository) Accounts() AccountRepository {
+	return r.accounts
+}
+
+func (r *memoryRepository) Payments() PaymentRepository {
+	return r.payments
+}
+
+func (r *memoryRepository) Favorites() FavoriteRepository {
+	return r.favorites
+}
+
+func (r *memoryRepository) Ledger() LedgerRepository {
+	return r.ledger
+}
+
+func (r *memoryRepository) Keys() IdempotencyRepository {
+	return r.keys
+}
+
+type memoryAccounts struct {
+	mu      sync.RWMutex
+	items   []*types.Account
+	byID    map[int64]*types.Account
+	byPhone map[types.Phone]*types.Account
+}
+
+func (r *memoryAccounts) Save(account *types.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.byID[account.ID]
+	if !ok {
+		stored = &types.Account{}
+		r.items = append(r.items, stored)
+		r.byID[account.ID] = stored
+	} else if r.byPhone[stored.Phone] == stored {
+		delete(r.byPhone, stored.Phone)
+	}
+	*stored = *account
+	r.byPhone[stored.Phone] = stored
+	return nil
+}
+
+func (r *memoryAccounts) ByID(accountID int64) (*types.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	account, ok := r.byID[accountID]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	result := *account
+	return &result, nil
+}
+
+func (r *memoryAccounts) ByPhone(phone types.Phone) (*types.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	account, ok := r.byPhone[phone]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	result := *account
+	return &result, nil
+}
+
+func (r *memoryAccounts) All() ([]*types.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accounts := make([]*types.Account, 0, len(r.items))
+	for _, account := range r.items {
+		result := *account
+		accounts = append(accounts, &result)
+	}
+	return accounts, nil
+}
+
+type memoryPayments struct {
+	mu        sync.RWMutex
+	items     []*types.Payment
+	byID      map[string]*types.Payment
+	byAccount map[int64][]*types.Payment
+	history   map[string][]types.PaymentStatusChange
+}
+
+func (r *memoryPayments) Save(payment *types.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.byID[payment.ID]
+	if !ok {
+		stored = &types.Payment{}
+		*stored = *payment
+		r.items = append(r.items, stored)
+		r.byID[payment.ID] = stored
+		r.byAccount[payment.AccountID] = append(r.byAccount[payment.AccountID], stored)
+		return nil
+	}
+
+	oldAccountID := stored.AccountID
+	*stored = *payment
+	if oldAccountID != payment.AccountID {
+		r.reindex(oldAccountID)
+		r.reindex(payment.AccountID)
+	}
+	return nil
+}
+
+// reindex пересобирает индекс счёта с сохранением порядка добавления, вызывать под mu.Lock.
+func (r *memoryPayments) reindex(accountID int64) {
+	payments := make([]*types.Payment, 0, len(r.byAccount[accountID]))
+	for _, payment := range r.items {
+		if payment.AccountID == accountID {
+			payments = append(payments, payment)
+		}
+	}
+	r.byAccount[accountID] = payments
+}
+
+func (r *memoryPayments) ByID(paymentID string) (*types.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	payment, ok := r.byID[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	result := *payment
+	return &result, nil
+}
+
+func (r *memoryPayments) ByAccount(accountID int64) ([]*types.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return copyPayments(r.byAccount[accountID]), nil
+}
+
+func (r *memoryPayments) All() ([]*types.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return copyPayments(r.items), nil
+}
+
+func (r *memoryPayments) AddStatusChange(change *types.PaymentStatusChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.history[change.PaymentID] = append(r.history[change.PaymentID], *change)
+	return nil
+}
+
+func (r *memoryPayments) StatusHistory(paymentID string) ([]types.PaymentStatusChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]types.PaymentStatusChange{}, r.history[paymentID]...), nil
+}
+
+// hasStatusChange сообщает, есть ли уже в истории платежа такой переход.
+// Переходы статусов не повторяются (см. checkTransition), поэтому пара
+// From, To определяет запись истории.
+func (r *memoryPayments) hasStatusChange(change *types.PaymentStatusChange) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, stored := range r.history[change.PaymentID] {
+		if stored.From == change.From && stored.To == change.To {
+			return true
+		}
+	}
+	return false
+}
+
+// allStatusChanges возвращает историю всех платежей в порядке добавления платежей.
+func (r *memoryPayments) allStatusChanges() []types.PaymentStatusChange {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	changes := []types.PaymentStatusChange{}
+	seen := make(map[string]bool, len(r.history))
+	for _, payment := range r.items {
+		seen[payment.ID] = true
+		changes = append(changes, r.history[payment.ID]...)
+	}
+	// история может прийти раньше самого платежа (например, при чтении снимка)
+	for paymentID, history := range r.history {
+		if !seen[paymentID] {
+			changes = append(changes, history...)
+		}
+	}
+	return changes
+}
+
+func copyPayments(items []*types.Payment) []*types.Payment {
+	payments := make([]*types.Payment, 0, len(items))
+	for _, payment := range items {
+		result := *payment
+		payments = append(payments, &result)
+	}
+	return payments
+}
+
+type memoryFavorites struct {
+	mu    sync.RWMutex
+	items []*types.Favorite
+	byID  map[string]*types.Favorite
+}
+
+func (r *memoryFavorites) Save(favorite *types.Favorite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.byID[favorite.ID]
+	if !ok {
+		stored = &types.Favorite{}
+		r.items = append(r.items, stored)
+		r.byID[favorite.ID] = stored
+	}
+	*stored = *favorite
+	return nil
+}
+
+func (r *memoryFavorites) ByID(favoriteID string) (*types.Favorite, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	favorite, ok := r.byID[favoriteID]
+	if !ok {
+		return nil, ErrFavoriteNotFound
+	}
+	result := *favorite
+	return &result, nil
+}
+
+func (r *memoryFavorites) All() ([]*types.Favorite, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	favorites := make([]*types.Favorite, 0, len(r.items))
+	for _, favorite := range r.items {
+		result := *favorite
+		favorites = append(favorites, &result)
+	}
+	return favorites, nil
+}
+
+type memoryLedger struct {
+	mu        sync.RWMutex
+	items     []*types.LedgerEntry
+	byID      map[string]bool
+	byAccount map[types.LedgerAccount][]*types.LedgerEntry
+}
+
+func (r *memoryLedger) Append(entry *types.LedgerEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := copyEntry(entry)
+	r.items = append(r.items, stored)
+	r.byID[stored.ID] = true
+	seen := make(map[types.LedgerAccount]bool, len(stored.Postings))
+	for _, posting := range stored.Postings {
+		if seen[posting.Account] {
+			continue
+		}
+		seen[posting.Account] = true
+		r.byAccount[posting.Account] = append(r.byAccount[posting.Account], stored)
+	}
+	return nil
+}
+
+// has сообщает, есть ли уже проводка с таким ID.
+func (r *memoryLedger) has(entryID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.byID[entryID]
+}
+
+func (r *memoryLedger) ByAccount(account types.LedgerAccount) ([]*types.LedgerEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return copyEntries(r.byAccount[account]), nil
+}
+
+func (r *memoryLedger) All() ([]*types.LedgerEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return copyEntries(r.items), nil
+}
+
+func copyEntry(entry *types.LedgerEntry) *types.LedgerEntry {
+	result := *entry
+	result.Postings = append([]types.Posting(nil), entry.Postings...)
+	return &result
+}
+
+func copyEntries(items []*types.LedgerEntry) []*types.LedgerEntry {
+	entries := make([]*types.LedgerEntry, 0, len(items))
+	for _, entry := range items {
+		entries = append(entries, copyEntry(entry))
+	}
+	return entries
+}
+
+type memoryKeys struct {
+	mu    sync.RWMutex
+	items []*types.IdempotencyRecord
+	byKey map[string]*types.IdempotencyRecord
+}
+
+func (r *memoryKeys) Save(record *types.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *record
+	if existing, ok := r.byKey[record.Key]; ok {
+		*existing = stored
+		return nil
+	}
+	r.items = append(r.items, &stored)
+	r.byKey[stored.Key] = &stored
+	return nil
+}
+
+func (r *memoryKeys) ByKey(key string) (*types.IdempotencyRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.byKey[key]
+	if !ok {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+	result := *record
+	return &result, nil
+}
+
+func (r *memoryKeys) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.byKey[key]
+	if !ok {
+		return nil
+	}
+	delete(r.byKey, key)
+	for i, item := range r.items {
+		if item == record {
+			r.items = append(r.items[:i], r.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *memoryKeys) All() ([]*types.IdempotencyRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := make([]*types.IdempotencyRecord, 0, len(r.items))
+	for _, record := range r.items {
+		result := *record
+		records = append(records, &result)
+	}
+	return records, nil
+}
@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func TestMemoryRepository_Accounts_savesCopies(t *testing.T) {
+	repo := NewMemoryRepository()
+	account := &types.Account{ID: 1, Phone: "+992900000001", Balance: 100}
+	if err := repo.Accounts().Save(account); err != nil {
+		t.Fatal(err)
+	}
+
+	// изменения снаружи не должны попадать в хранилище без Save
+	account.Balance = 0
+	got, err := repo.Accounts().ByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Balance != 100 {
+		t.Errorf("ByID(): balance = %v, want 100", got.Balance)
+	}
+	got.Balance = 0
+	again, _ := repo.Accounts().ByID(1)
+	if again.Balance != 100 {
+		t.Errorf("ByID(): returned value shares memory with repository")
+	}
+}
+
+func TestMemoryRepository_Accounts_phoneIndex(t *testing.T) {
+	repo := NewMemoryRepository()
+	_ = repo.Accounts().Save(&types.Account{ID: 1, Phone: "+992900000001"})
+	_ = repo.Accounts().Save(&types.Account{ID: 1, Phone: "+992900000002"})
+
+	if _, err := repo.Accounts().ByPhone("+992900000001"); err != ErrAccountNotFound {
+		t.Errorf("ByPhone(): must return ErrAccountNotFound for old phone, returned = %v", err)
+	}
+	got, err := repo.Accounts().ByPhone("+992900000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 1 {
+		t.Errorf("ByPhone(): got account %v, want 1", got.ID)
+	}
+
+	all, _ := repo.Accounts().All()
+	if len(all) != 1 {
+		t.Errorf("All(): got %v accounts, want 1", len(all))
+	}
+}
+
+func TestMemoryRepository_Payments_byAccount(t *testing.T) {
+	repo := NewMemoryRepository()
+	payments := repo.Payments()
+	_ = payments.Save(&types.Payment{ID: "a", AccountID: 1, Amount: 1})
+	_ = payments.Save(&types.Payment{ID: "b", AccountID: 2, Amount: 2})
+	_ = payments.Save(&types.Payment{ID: "c", AccountID: 1, Amount: 3})
+
+	// перенос платежа на другой счёт сохраняет порядок добавления
+	_ = payments.Save(&types.Payment{ID: "a", AccountID: 2, Amount: 1})
+
+	first, _ := payments.ByAccount(1)
+	second, _ := payments.ByAccount(2)
+	if len(first) != 1 || first[0].ID != "c" {
+		t.Errorf("ByAccount(1): got %v", first)
+	}
+	if len(second) != 2 || second[0].ID != "a" || second[1].ID != "b" {
+		t.Errorf("ByAccount(2): got %v", second)
+	}
+
+	if _, err := payments.ByID("x"); err != ErrPaymentNotFound {
+		t.Errorf("ByID(): must return ErrPaymentNotFound, returned = %v", err)
+	}
+}
+
+func TestMemoryRepository_Favorites(t *testing.T) {
+	repo := NewMemoryRepository()
+	favorite := &types.Favorite{ID: "a", AccountID: 1, Name: "mobile", Amount: 10, Category: "phone"}
+	_ = repo.Favorites().Save(favorite)
+
+	got, err := repo.Favorites().ByID("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, favorite) {
+		t.Errorf("ByID(): got %v, want %v", got, favorite)
+	}
+	if _, err := repo.Favorites().ByID("b"); err != ErrFavoriteNotFound {
+		t.Errorf("ByID(): must return ErrFavoriteNotFound, returned = %v", err)
+	}
+}
+
+func TestNewService_continuesAccountIDs(t *testing.T) {
+	repo := NewMemoryRepository()
+	_ = repo.Accounts().Save(&types.Account{ID: 5, Phone: "+992900000005", Balance: 50})
+
+	s, err := NewService(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := s.RegisterAccount("+992900000006")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ID != 6 {
+		t.Errorf("RegisterAccount(): got ID %v, want 6", account.ID)
+	}
+	if _, err := s.RegisterAccount("+992900000005"); err != ErrPhoneRegistered {
+		t.Errorf("RegisterAccount(): must return ErrPhoneRegistered, returned = %v", err)
+	}
+
+	if _, err := s.Pay(5, 20, "auto"); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := repo.Accounts().ByID(5)
+	if stored.Balance != 30 {
+		t.Errorf("Pay(): balance in repository = %v, want 30", stored.Balance)
+	}
+}
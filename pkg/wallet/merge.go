@@ -0,0 +1,60 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrImportConflict возвращается при MergeFailOnConflict, если запись
+// дампа отличается от уже сохранённой записи с тем же ID.
+var ErrImportConflict = errors.New("import conflict")
+
+// MergePolicy решает, что делать с записью дампа, если запись с тем же ID
+// уже есть и отличается от неё. Новые и совпадающие записи сохраняются
+// при любой политике.
+type MergePolicy int
+
+const (
+	// MergeOverwrite заменяет сохранённую запись записью дампа (как Import).
+	MergeOverwrite MergePolicy = iota
+	// MergeKeepExisting оставляет сохранённую запись.
+	MergeKeepExisting
+	// MergeFailOnConflict считает каждое расхождение ошибкой ErrImportConflict.
+	MergeFailOnConflict
+	// MergeNewestWins оставляет запись, изменённую позже. При равном или
+	// неизвестном времени остаётся сохранённая запись.
+	MergeNewestWins
+)
+
+func (p MergePolicy) String() string {
+	switch p {
+	case MergeOverwrite:
+		return "overwrite"
+	case MergeKeepExisting:
+		return "keep-existing"
+	case MergeFailOnConflict:
+		return "fail-on-conflict"
+	case MergeNewestWins:
+		return "newest-wins"
+	}
+	return fmt.Sprintf("MergePolicy(%d)", int(p))
+}
+
+// resolve решает, сохранять ли запись дампа поверх сохранённой. При
+// MergeFailOnConflict конфликт записывается в ошибки и возвращается false.
+func (c *importCheck) resolve(file string, line int, what string, equal bool, importedAt, storedAt time.Time) bool {
+	if equal {
+		return true
+	}
+	switch c.policy {
+	case MergeKeepExisting:
+		return false
+	case MergeFailOnConflict:
+		c.add(file, line, fmt.Errorf("%w: %s differs from the stored one", ErrImportConflict, what))
+		return false
+	case MergeNewestWins:
+		return importedAt.After(storedAt)
+	}
+	return true
+}
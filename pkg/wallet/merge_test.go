@@ -0,0 +1,209 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func newMergeService(t *testing.T) *Service {
+	t.Helper()
+
+	s := &Service{}
+	dir := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000001;100\n",
+		paymentsFileName: "p1;1;10;auto;Ok\n",
+	})
+	if _, err := s.ImportStrict(dir, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestService_ImportStrict_mergePolicies(t *testing.T) {
+	dir := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000001;500\n2;+992900000002;0\n",
+		paymentsFileName: "p1;1;10;food;Ok\np2;2;5;auto;Ok\n",
+	})
+
+	tests := []struct {
+		policy   MergePolicy
+		balance  types.Money
+		category types.PaymentCategory
+		accounts ImportCounts
+		payments ImportCounts
+	}{
+		{MergeOverwrite, 500, "food", ImportCounts{Created: 1, Updated: 1}, ImportCounts{Created: 1, Updated: 1}},
+		{MergeKeepExisting, 100, "auto", ImportCounts{Created: 1, Skipped: 1}, ImportCounts{Created: 1, Skipped: 1}},
+		// в дампе нет времени изменения, поэтому остаются сохранённые записи
+		{MergeNewestWins, 100, "auto", ImportCounts{Created: 1, Skipped: 1}, ImportCounts{Created: 1, Skipped: 1}},
+	}
+	for _, tt := range tests {
+		s := newMergeService(t)
+		report, err := s.ImportStrict(dir, ImportOptions{Merge: tt.policy})
+		if err != nil {
+			t.Errorf("%v: ImportStrict(): error = %v", tt.policy, err)
+			continue
+		}
+		if report.Accounts != tt.accounts || report.Payments != tt.payments {
+			t.Errorf("%v: ImportStrict() = %+v, want accounts %+v, payments %+v", tt.policy, report, tt.accounts, tt.payments)
+		}
+		assertBalance(t, s, 1, tt.balance)
+		assertBalance(t, s, 2, 0)
+		if payment, _ := s.FindPaymentByID("p1"); payment == nil || payment.Category != tt.category {
+			t.Errorf("%v: payment p1 = %v, want category %s", tt.policy, payment, tt.category)
+		}
+		if discrepancies, _ := s.VerifyLedger(); len(discrepancies) != 0 {
+			t.Errorf("%v: VerifyLedger(): got discrepancies %v", tt.policy, discrepancies)
+		}
+	}
+}
+
+func TestService_ImportStrict_failOnConflict(t *testing.T) {
+	s := newMergeService(t)
+	dir := writeDumpFiles(t, map[string]string{
+		// совпадающий счёт конфликтом не считается
+		accountsFileName: "1;+992900000001;100\n2;+992900000002;0\n",
+		paymentsFileName: "p1;1;10;food;Ok\n",
+	})
+
+	_, err := s.ImportStrict(dir, ImportOptions{Merge: MergeFailOnConflict})
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || !errors.Is(err, ErrImportConflict) || len(importErr.Errors) != 1 {
+		t.Fatalf("ImportStrict(): must return one ErrImportConflict, returned = %v", err)
+	}
+	if lineErr := importErr.Errors[0]; lineErr.File != paymentsFileName || lineErr.Line != 1 {
+		t.Errorf("ImportStrict(): conflict at %s:%d, want %s:1", lineErr.File, lineErr.Line, paymentsFileName)
+	}
+	if _, err := s.FindAccountByID(2); err == nil {
+		t.Errorf("ImportStrict(): saved account 2 despite a conflict")
+	}
+}
+
+func TestService_ImportStrict_keepExistingPhone(t *testing.T) {
+	s := newMergeService(t)
+	// счёт 1 пропускается, поэтому его старый телефон по-прежнему занят
+	dir := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000009;100\n2;+992900000001;0\n",
+	})
+	if _, err := s.ImportStrict(dir, ImportOptions{Merge: MergeKeepExisting}); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("ImportStrict(): must reject a phone kept by account 1, returned = %v", err)
+	}
+}
+
+func TestService_Import_nextAccountID(t *testing.T) {
+	dir := writeDumpFiles(t, map[string]string{
+		accountsFileName: "5;+992900000005;0\n3;+992900000003;0\n",
+	})
+
+	s := &Service{}
+	for i := 0; i < 7; i++ {
+		_, _ = s.RegisterAccount(types.Phone("+99291000000" + string(rune('0'+i))))
+	}
+	if err := s.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	// импорт только переписал счета 3 и 5
+	if account, _ := s.RegisterAccount("+992920000000"); account == nil || account.ID != 8 {
+		t.Errorf("RegisterAccount(): %v after Import, want id 8", account)
+	}
+
+	empty := &Service{}
+	if err := empty.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if account, _ := empty.RegisterAccount("+992920000000"); account == nil || account.ID != 6 {
+		t.Errorf("RegisterAccount(): %v after Import, want id 6", account)
+	}
+}
+
+func TestService_Import_phoneTaken(t *testing.T) {
+	s := &Service{}
+	_, _ = s.RegisterAccount("+992900000005")
+	dir := writeDumpFiles(t, map[string]string{
+		accountsFileName: "5;+992900000005;0\n",
+	})
+	if err := s.Import(dir); !errors.Is(err, ErrPhoneRegistered) {
+		t.Errorf("Import(): must return ErrPhoneRegistered, returned = %v", err)
+	}
+}
+
+func TestService_Import_phoneConflictChangesNothing(t *testing.T) {
+	s := &Service{}
+	_, _ = s.RegisterAccount("+992900000001")
+	_, _ = s.RegisterAccount("+992900000002")
+	_, _ = s.RegisterAccount("+992900000003")
+
+	// конфликт в последней строке: первые счета не должны попасть в сервис
+	dir := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000001;100\n5;+992900000005;50\n6;+992900000003;0\n",
+	})
+	if err := s.Import(dir); !errors.Is(err, ErrPhoneRegistered) {
+		t.Fatalf("Import(): must return ErrPhoneRegistered, returned = %v", err)
+	}
+	accounts, _ := s.storage().Accounts().All()
+	if len(accounts) != 3 || accounts[0].Balance != 0 {
+		t.Errorf("Import(): changed accounts %v despite the conflict", accounts)
+	}
+	if entries, _ := s.storage().Ledger().All(); len(entries) != 0 {
+		t.Errorf("Import(): posted %d ledger entries despite the conflict", len(entries))
+	}
+
+	// обмен телефонами конфликтом не считается
+	dir = writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000002;0\n2;+992900000001;0\n",
+	})
+	if err := s.Import(dir); err != nil {
+		t.Fatalf("Import(): error = %v", err)
+	}
+	if account, _ := s.storage().Accounts().ByPhone("+992900000001"); account == nil || account.ID != 2 {
+		t.Errorf("ByPhone() = %v after swapping phones, want account 2", account)
+	}
+}
+
+func TestService_ImportStrict_newestWins(t *testing.T) {
+	s := &Service{}
+	older := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000001;100;TJS;1000;1000\n",
+	})
+	newer := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000001;500;TJS;1000;2000\n",
+	})
+	stale := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000001;300;TJS;1000;1500\n",
+	})
+
+	for _, dir := range []string{older, newer, stale} {
+		if _, err := s.ImportStrict(dir, ImportOptions{Merge: MergeNewestWins}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertBalance(t, s, 1, 500)
+	if account, _ := s.FindAccountByID(1); account.UpdatedAt.UnixNano() != 2000 {
+		t.Errorf("ImportStrict(): updated at %v, want the newer record", account.UpdatedAt)
+	}
+}
+
+func TestService_Import_partialDumpChangesNothing(t *testing.T) {
+	s := &Service{}
+	account, _ := s.RegisterAccount("+992900000001")
+	_ = s.Deposit(account.ID, 100)
+
+	// ошибка в платежах после счетов: счета тоже не должны измениться
+	dir := writeDumpFiles(t, map[string]string{
+		accountsFileName: "1;+992900000001;500\n2;+992900000002;0\n",
+		paymentsFileName: "p1;1;10;auto;OK\np2;1;not-a-number;auto;OK\n",
+	})
+	if err := s.Import(dir); !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("Import(): must return ErrInvalidRecord, returned = %v", err)
+	}
+	accounts, _ := s.storage().Accounts().All()
+	payments, _ := s.storage().Payments().All()
+	if len(accounts) != 1 || accounts[0].Balance != 100 || len(payments) != 0 {
+		t.Errorf("Import(): state changed to %v, %v despite the error", accounts, payments)
+	}
+	if discrepancies, err := s.VerifyLedger(); err != nil || len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger() = %v, %v after a failed Import", discrepancies, err)
+	}
+}
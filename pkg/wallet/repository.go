@@ -0,0 +1,82 @@
+package wallet
+
+import "github.com/FrankS17/wallet/pkg/types"
+
+// Repository объединяет хранилища, с которыми работает Service.
+// Все реализации должны быть безопасны для одновременного использования.
+type Repository interface {
+	Accounts() AccountRepository
+	Payments() PaymentRepository
+	Favorites() FavoriteRepository
+	Ledger() LedgerRepository
+	Keys() IdempotencyRepository
+}
+
+// AccountRepository хранит счета.
+// Методы принимают и возвращают копии: изменения возвращённого значения
+// не попадают в хранилище, пока его не передадут в Save.
+type AccountRepository interface {
+	// Save добавляет новый счёт или обновляет счёт с тем же ID.
+	// Уникальность телефона проверяет Service, а не хранилище.
+	Save(account *types.Account) error
+	// ByID возвращает ErrAccountNotFound, если счёта нет.
+	ByID(accountID int64) (*types.Account, error)
+	// ByPhone возвращает ErrAccountNotFound, если счёта нет.
+	ByPhone(phone types.Phone) (*types.Account, error)
+	// All возвращает счета в порядке добавления.
+	All() ([]*types.Account, error)
+}
+
+// PaymentRepository хранит платежи.
+type PaymentRepository interface {
+	// Save добавляет новый платёж или обновляет платёж с тем же ID.
+	Save(payment *types.Payment) error
+	// ByID возвращает ErrPaymentNotFound, если платежа нет.
+	ByID(paymentID string) (*types.Payment, error)
+	// ByAccount возвращает платежи счёта в порядке добавления.
+	ByAccount(accountID int64) ([]*types.Payment, error)
+	// All возвращает платежи в порядке добавления.
+	All() ([]*types.Payment, error)
+	// AddStatusChange дописывает запись в историю статусов платежа.
+	AddStatusChange(change *types.PaymentStatusChange) error
+	// StatusHistory возвращает историю статусов платежа в порядке изменений.
+	StatusHistory(paymentID string) ([]types.PaymentStatusChange, error)
+}
+
+// FavoriteRepository хранит избранные платежи.
+type FavoriteRepository interface {
+	// Save добавляет новое избранное или обновляет избранное с тем же ID.
+	Save(favorite *types.Favorite) error
+	// ByID возвращает ErrFavoriteNotFound, если избранного нет.
+	ByID(favoriteID string) (*types.Favorite, error)
+	// All возвращает избранное в порядке добавления.
+	All() ([]*types.Favorite, error)
+}
+
+// LedgerRepository хранит проводки. Проводки только добавляются и никогда не меняются.
+type LedgerRepository interface {
+	Append(entry *types.LedgerEntry) error
+	// ByAccount возвращает проводки, затрагивающие счёт, в порядке добавления.
+	ByAccount(account types.LedgerAccount) ([]*types.LedgerEntry, error)
+	// All возвращает проводки в порядке добавления.
+	All() ([]*types.LedgerEntry, error)
+}
+
+// IdempotencyRepository хранит результаты операций с ключами идемпотентности.
+type IdempotencyRepository interface {
+	// Save добавляет запись или заменяет запись с тем же ключом.
+	Save(record *types.IdempotencyRecord) error
+	// ByKey возвращает ErrIdempotencyKeyNotFound, если записи нет.
+	ByKey(key string) (*types.IdempotencyRecord, error)
+	// Delete удаляет запись, отсутствие записи ошибкой не считается.
+	Delete(key string) error
+	// All возвращает записи в порядке добавления.
+	All() ([]*types.IdempotencyRecord, error)
+}
+
+// batcher реализуют хранилища, которые умеют записать несколько изменений
+// как одно (см. FileRepository). Пока выполняется fn, в пакет попадают
+// записи всех горутин.
+type batcher interface {
+	batch(fn func() error) error
+}
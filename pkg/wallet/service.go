@@ -2,6 +2,7 @@ package wallet
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -9,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/FrankS17/wallet/pkg/types"
 	"github.com/google/uuid"
@@ -27,11 +30,51 @@ func (e *errorString) Error() string {
 	return e.s
 }
 
+// Service безопасен для одновременного использования из нескольких горутин.
+//
+// Операции над отдельными счетами держат mu на чтение и блокируют только свой
+// счёт, поэтому операции над разными счетами не ждут друг друга. Регистрация,
+// импорт и экспорт берут mu на запись и видят согласованное состояние.
+//
+// Данные хранятся в Repository, по умолчанию в памяти (см. NewService).
+// Каждое движение денег записывается проводкой в книгу (см. ledger.go),
+// а Account.Balance только кэширует баланс, посчитанный по проводкам.
+// Об изменениях сервис сообщает подписчикам событиями (см. Subscribe).
 type Service struct {
+	mu            sync.RWMutex
 	nextAccountID int64
-	accounts      []*types.Account
-	payments 	  []*types.Payment
-	favorites	  []*types.Favorite
+
+	locksMu sync.Mutex
+	locks   map[int64]*sync.Mutex // блокировки счетов, защищают Balance
+
+	keysMu   sync.Mutex
+	keyLocks map[string]*keyLock // блокировки ключей идемпотентности
+	keyTTL   time.Duration
+
+	rates RateProvider // курсы для пересчёта валют, защищены mu
+	clock atomic.Value // Clock, см. SetClock
+
+	once    sync.Once
+	repo    Repository
+	changes *changeLog // номера изменений для ExportSince
+	events  eventBus   // подписчики на события, см. events.go
+}
+
+// NewService создаёт сервис поверх заданного хранилища.
+// Следующий ID счёта продолжает максимальный ID, уже лежащий в хранилище.
+func NewService(repo Repository) (*Service, error) {
+	accounts, err := repo.Accounts().All()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Service{repo: repo}
+	for _, account := range accounts {
+		if account.ID > s.nextAccountID {
+			s.nextAccountID = account.ID
+		}
+	}
+	return s, nil
 }
 
 var ErrPhoneRegistered = errors.New("phone already registered")
@@ -42,20 +85,46 @@ var ErrPaymentNotFound = errors.New("payment not found")
 var ErrFavoriteNotFound = errors.New("favorite not found")
 
 
+// RegisterAccount регистрирует счёт в DefaultCurrency.
 func (s *Service) RegisterAccount(phone types.Phone) (*types.Account, error){
-	for _, account := range s.accounts {
-	if account.Phone == phone {
+	return s.registerAccount(phone, DefaultCurrency)
+}
+
+func (s *Service) registerAccount(phone types.Phone, currency types.Currency) (*types.Account, error) {
+	accounts := s.storage().Accounts()
+
+	defer s.flushEvents()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := accounts.ByPhone(phone)
+	if err == nil {
 		return nil, ErrPhoneRegistered
 	}
-}
+	if err != ErrAccountNotFound {
+		return nil, err
+	}
+
 	s.nextAccountID++
+	now := s.now()
 	account := &types.Account{
 		ID: 		s.nextAccountID,
 		Phone:		phone,
 		Balance: 	0,
+		Currency:	currency,
+		CreatedAt:	now,
+		UpdatedAt:	now,
+	}
+	err = accounts.Save(account)
+	if err != nil {
+		s.nextAccountID--
+		return nil, err
 	}
-	s.accounts = append(s.accounts,account)
 
+	s.events.record(AccountRegistered{
+		EventHeader: EventHeader{AccountID: account.ID, At: now},
+		Account:     *account,
+	})
 	return account, nil
 }
 
@@ -65,93 +134,164 @@ func (s *Service) Deposit(accountID int64, amount types.Money) error {
 		return ErrAmountMustBePositive
 	}
 
-	var account *types.Account
-	for _, acc := range s.accounts {
-		if acc.ID == accountID {
-			account = acc
-			break
-		}
+	defer s.flushEvents()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, unlock, err := s.lockAccount(accountID)
+	if err != nil {
+		return err
 	}
-	
-	if account == nil {
-		return ErrAccountNotFound
+	defer unlock()
+
+	// зачисление средств не платеж, но проводка по нему есть
+	err = s.atomically(func() error {
+		return s.post(types.EntryKindDeposit, "",
+			types.Posting{Account: ledgerDeposits, Amount: -amount},
+			types.Posting{Account: walletLedgerAccount(accountID), Amount: amount},
+		)
+	})
+	if err != nil {
+		return err
 	}
-	
-	// зачисление средств пока не рассматриваем как платеж
-	account.Balance += amount
+
+	// post уже проверил, что сумма не переполняет баланс
+	balance, _ := account.Balance.Add(amount)
+	s.events.record(Deposited{
+		EventHeader: EventHeader{AccountID: accountID, At: s.now()},
+		Amount:      amount,
+		Currency:    currencyOf(account.Currency),
+		Balance:     balance,
+	})
 	return nil
 }
 
 
+// FindAccountByID возвращает копию счёта, поэтому её можно читать без блокировок.
 func (s *Service) FindAccountByID(accountID int64) (*types.Account,error) {
-	
-	for _, account := range s.accounts {
-		if account.ID == accountID {
-			return account, nil
-		}
-	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return nil, ErrAccountNotFound
+	return s.storage().Accounts().ByID(accountID)
 }
 
 
 func (s *Service) Pay(accountID int64, amount types.Money, category types.PaymentCategory)(*types.Payment, error) {
+	return s.pay(accountID, amount, category, "")
+}
+
+// pay создаёт платёж, repeatOf — ID повторяемого платежа или "".
+func (s *Service) pay(accountID int64, amount types.Money, category types.PaymentCategory, repeatOf string) (*types.Payment, error) {
 	if amount <= 0 {
 		return nil, ErrAmountMustBePositive
 	}
 
-	var account *types.Account
-	for _, acc := range s.accounts {
-		account = acc
-		break
-	}
-	if account == nil {
-		return nil, ErrAccountNotFound
+	defer s.flushEvents()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// проверка баланса и списание должны быть одной операцией
+	account, unlock, err := s.lockAccount(accountID)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
+
 	if account.Balance < amount {
 		return nil, ErrNotEnoughBalance
 	}
 
-	account.Balance -= amount
 	paymentID := uuid.New().String()
+	now := s.now()
 	payment := &types.Payment{
 		ID: paymentID,
 		AccountID: accountID,
 		Amount: amount,
 		Category: category,
 		Status: types.PaymentStatusInProgress,
+		Currency: currencyOf(account.Currency),
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
-	s.payments = append(s.payments, payment)
+
+	err = s.atomically(func() error {
+		err := s.storage().Payments().Save(payment)
+		if err != nil {
+			return err
+		}
+		err = s.recordCreated(payment)
+		if err != nil {
+			return err
+		}
+		return s.post(types.EntryKindPayment, paymentID,
+			types.Posting{Account: walletLedgerAccount(accountID), Amount: -amount},
+			types.Posting{Account: categoryLedgerAccount(category), Amount: amount},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordPaymentCreated(payment, repeatOf)
 	return payment, nil
 }
 
 
+// FindPaymentByID возвращает копию платежа.
 func (s *Service) FindPaymentByID(paymentID string) (*types.Payment, error) {
-	
-	for _, payment := range s.payments {
-		if payment.ID == paymentID {
-			return payment, nil
-		}
-	}
-	return nil, ErrPaymentNotFound
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.storage().Payments().ByID(paymentID)
 }
 
 
+// Reject отменяет платёж и возвращает деньги: неподтверждённый платёж
+// становится FAIL, подтверждённый REFUNDED. Повторная отмена возвращает
+// StatusTransitionError и денег не зачисляет.
 func (s *Service) Reject(paymentID string) error {
-	
-	payment, err := s.FindPaymentByID(paymentID)
+	payments := s.storage().Payments()
+
+	defer s.flushEvents()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payment, err := payments.ByID(paymentID)
 	if err != nil {
 		return ErrPaymentNotFound
 	}
-	
-	account, err := s.FindAccountByID(payment.AccountID)
+	if payment.CounterpartID != "" {
+		return s.rejectTransfer(payment)
+	}
+
+	_, unlock, err := s.lockAccount(payment.AccountID)
 	if err != nil {
 		return ErrAccountNotFound
 	}
+	defer unlock()
 
-	payment.Status = types.PaymentStatusFail
-	account.Balance += payment.Amount
+	// статус платежа меняется только под блокировкой его счёта, перечитываем
+	payment, err = payments.ByID(paymentID)
+	if err != nil {
+		return err
+	}
 
+	from := payment.Status
+	err = s.atomically(func() error {
+		err := s.changeStatus(payment, rejectedStatus(payment.Status))
+		if err != nil {
+			return err
+		}
+		return s.post(types.EntryKindRefund, paymentID,
+			types.Posting{Account: categoryLedgerAccount(payment.Category), Amount: -payment.Amount},
+			types.Posting{Account: walletLedgerAccount(payment.AccountID), Amount: payment.Amount},
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.recordPaymentRejected(payment, from)
 	return nil
 }
 
@@ -187,8 +327,11 @@ func (s *Service) Repeat(paymentID string) (*types.Payment, error) {
 	if err != nil {
 		return nil, err
 	}
+	if payment.CounterpartID != "" {
+		return s.repeatTransfer(payment)
+	}
 
-	return s.Pay(payment.AccountID, payment.Amount, payment.Category)
+	return s.pay(payment.AccountID, payment.Amount, payment.Category, payment.ID)
 }
 
 
@@ -199,27 +342,43 @@ func (s *Service) FavoritePayment(paymentID, name string) (*types.Favorite, erro
 		return nil, ErrPaymentNotFound
 	}
 
+	now := s.now()
 	favoritePayment := &types.Favorite{
 		ID: uuid.New().String(),
 		AccountID: payment.AccountID,
 		Name: name,
 		Amount: payment.Amount,
 		Category: payment.Category,
+		Currency: payment.Currency,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	defer s.flushEvents()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err = s.atomically(func() error {
+		return s.storage().Favorites().Save(favoritePayment)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	s.favorites = append(s.favorites, favoritePayment)	
+	s.events.record(FavoriteCreated{
+		EventHeader: EventHeader{AccountID: favoritePayment.AccountID, At: now},
+		Favorite:    *favoritePayment,
+	})
 	return favoritePayment, nil
 }
 
 
+// FindFavoriteByID возвращает копию избранного платежа.
 func (s *Service) FindFavoriteByID(favoriteID string) (*types.Favorite, error) {
-	
-	for _, favorite := range s.favorites {
-		if favorite.ID == favoriteID {
-			return favorite, nil
-		}
-	}
-	return nil, ErrFavoriteNotFound
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.storage().Favorites().ByID(favoriteID)
 }
 
 
@@ -253,7 +412,7 @@ func (s *Service) PayFromFavorite(favoriteID string) (*types.Payment, error) {
 		return nil, err
 	}
 
-	payment, err := s.Pay(favorite.AccountID, favorite.Amount, favorite.Category)
+	payment, err := s.PayInCurrency(favorite.AccountID, favorite.Amount, favorite.Currency, favorite.Category)
 	if err != nil {
 		return nil, err
 	}
@@ -274,10 +433,16 @@ func (s *Service) ExportToFile(path string) error {
 		}
 	}()
 
+	accounts, _, _, err := s.snapshot()
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
 	data := make([]byte,0)
 	lastString := ""
-	for _, account := range s.accounts {
-		text := []byte(strconv.FormatInt(account.ID,10) + ";" + string(account.Phone) + ";" + strconv.FormatInt(int64(account.Balance),10) + "|")
+	for _, account := range accounts {
+		text := []byte(formatAccount(account) + "|")
 		data = append(data,text...)
 		}
 	str := string(data)
@@ -334,14 +499,28 @@ func (s *Service) ImportFromFile(path string) error {
 		id, _ := strconv.ParseInt(strAcc[0], 10, 64)
 		phone := types.Phone(strAcc[1])
 		balance, _ := strconv.ParseInt(strAcc[2], 10, 64)
+		currency := DefaultCurrency
+		if len(strAcc) > 3 {
+			currency = types.Currency(strAcc[3])
+		}
 
 		account := types.Account{
-			ID:      id,
-			Phone:   phone,
-			Balance: types.Money(balance),
+			ID:       id,
+			Phone:    phone,
+			Balance:  types.Money(balance),
+			Currency: currency,
+		}
+		s.mu.Lock()
+		err = s.storage().Accounts().Save(&account)
+		if err == nil {
+			err = s.postOpeningBalances([]*types.Account{&account})
 		}
-		 s.accounts = append(s.accounts, &account)	
-		 log.Print(account)	
+		s.mu.Unlock()
+		if err != nil {
+			log.Print(err)
+			return err
+		}
+		log.Print(account)
 	}
 	return nil
 }
@@ -644,239 +823,366 @@ return nil
 } */
 
 
-//Export записывает счета, платежи, избранное в файл дампа.
+//Export записывает счета, платежи, избранное и действующие ключи идемпотентности в файлы дампа.
+// Все четыре файла пишутся всегда, файл без записей остаётся пустым.
+// Записи идут прямо из хранилища под lockForExport: денежные операции ждут
+// конца выгрузки, чтение сервиса — нет.
+// Файлы сначала пишутся во временные и сбрасываются на диск, затем
+// переименовываются на место, последним записывается манифест с числом
+// записей и контрольными суммами, который проверяет Import.
 func (s *Service) Export(dir string) error {
 
-	path, _ := filepath.Abs(dir)
-	os.MkdirAll(dir, 0666)
-
-	//export accounts
-	if s.accounts != nil && len(s.accounts) > 0 {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
 
-		data := make([]byte, 0)
-		for _, account := range s.accounts {
-			text := []byte(
-				strconv.FormatInt(int64(account.ID), 10) + ";" +
-					string(account.Phone) + ";" +
-					strconv.FormatInt(int64(account.Balance), 10) + "\n")
+	unlock, err := s.lockForExport()
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	defer unlock()
 
-			data = append(data, text...)
-		}
+	set, err := newDumpSet(dir, manifestFileName, exportFiles)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	defer set.discard()
 
-		err := os.WriteFile(path+"/accounts.dump", data, 0666)
+	for _, file := range s.dumpFiles() {
+		err = set.add(file.name, file.encode)
 		if err != nil {
 			log.Print(err)
 			return err
 		}
 	}
 
-	//export payments
-	if s.payments != nil && len(s.payments) > 0 {
-
-		data := make([]byte, 0)
-		for _, payment := range s.payments {
-			text := []byte(
-				string(payment.ID) + ";" +
-					strconv.FormatInt(int64(payment.AccountID), 10) + ";" +
-					strconv.FormatInt(int64(payment.Amount), 10) + ";" +
-					string(payment.Category) + ";" +
-					string(payment.Status) + "\n")
-
-			data = append(data, text...)
-		}
-
-		err := os.WriteFile(path+"/payments.dump", data, 0666)
-		if err != nil {
-			log.Print(err)
-			return err
-		}
+	err = set.commit()
+	if err != nil {
+		log.Print(err)
+		return err
 	}
+	return nil
+}
 
-	//export favorites
-	if s.favorites != nil && len(s.favorites) > 0 {
+// dumpFile файл дампа и запись его содержимого.
+type dumpFile struct {
+	name   string
+	encode func(enc *DumpEncoder) error
+}
 
-		data := make([]byte, 0)
-		for _, favorite := range s.favorites {
-			text := []byte(
-				string(favorite.ID) + ";" +
-					strconv.FormatInt(int64(favorite.AccountID), 10) + ";" +
-					string(favorite.Name) + ";" +
-					strconv.FormatInt(int64(favorite.Amount), 10) + ";" +
-					string(favorite.Category) + "\n")
+// dumpFiles возвращает файлы Export и ExportArchive в порядке exportFiles:
+// счета, платежи, избранное и действующие ключи идемпотентности. encode
+// читает записи прямо из хранилища, поэтому вызывать его можно только под
+// lockForExport. Избранное и ключи меняются и без блокировок счетов, так что
+// повторный вызов может записать другое: каждый файл кодируется один раз.
+func (s *Service) dumpFiles() []dumpFile {
+	repo := s.storage()
+	now := s.now()
+
+	return []dumpFile{
+		{accountsFileName, func(enc *DumpEncoder) error {
+			accounts, err := repo.Accounts().All()
+			if err != nil {
+				return err
+			}
+			for _, account := range accounts {
+				err = enc.EncodeAccount(*account)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{paymentsFileName, func(enc *DumpEncoder) error {
+			payments, err := repo.Payments().All()
+			if err != nil {
+				return err
+			}
+			for _, payment := range payments {
+				err = enc.EncodePayment(*payment)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{favoritesFileName, func(enc *DumpEncoder) error {
+			favorites, err := repo.Favorites().All()
+			if err != nil {
+				return err
+			}
+			for _, favorite := range favorites {
+				err = enc.EncodeFavorite(*favorite)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{keysFileName, func(enc *DumpEncoder) error {
+			records, err := repo.Keys().All()
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				// истёкшие ключи не переносим
+				if !record.ExpiresAt.After(now) {
+					continue
+				}
+				err = enc.encodeIdempotencyRecord(*record)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	}
+}
 
-			data = append(data, text...)
-		}
+// lockForExport берёт mu на чтение и блокировки всех счетов. Деньги и
+// платежи меняются только под блокировками своих счетов, а регистрация и
+// импорт — под mu на запись, поэтому выгрузка видит согласованное
+// состояние, а чтение сервиса не останавливается. Избранное и ключи,
+// добавленные во время выгрузки, ссылаются только на уже выгруженные платежи.
+func (s *Service) lockForExport() (func(), error) {
+	repo := s.storage()
 
-		err := os.WriteFile(path+"/favorites.dump", data, 0666)
-		if err != nil {
-			log.Print(err)
-			return err
-		}
+	s.mu.RLock()
+	accounts, err := repo.Accounts().All()
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
 	}
-
-	return nil
+	ids := make([]int64, 0, len(accounts))
+	for _, account := range accounts {
+		ids = append(ids, account.ID)
+	}
+	unlock, err := s.lockAccounts(ids...)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
+	}
+	return func() {
+		unlock()
+		s.mu.RUnlock()
+	}, nil
 }
 
 // Import импортировать (читает) из файла дампа в учетные записи, платежи и избранное.
+// Файлы читаются потоково, по одной записи, в промежуточное хранилище;
+// отсутствующий файл пропускается. Сервис меняется только после того, как
+// прочитаны все файлы, одним пакетом (см. atomically), поэтому ошибка
+// посреди файла ничего не записывает.
+// Если в каталоге есть манифест Export, файлы сначала сверяются с ним.
+// Записи с теми же ID заменяются (см. ImportStrict с ImportOptions.Merge).
 func (s *Service) Import(dir string) error {
 
-	var path string
-	if filepath.IsAbs(path) {
-		// path, _ = filepath.Abs(dir)
-		path = filepath.Dir(dir)
-	} else {
-		path = dir
+	err := verifyManifest(dir)
+	if err != nil {
+		return err
 	}
 
-	// import accounts
-	accFile, err1 := os.ReadFile(path + "/accounts.dump")
-	if err1 == nil {
+	repo := s.storage()
 
-		accData := string(accFile)
-		accData = strings.TrimSpace(accData)
+	// импорт меняет всё состояние сразу, поэтому останавливаем все операции
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		accSlice := strings.Split(accData, "\n")
-		log.Print("accounts : ", accSlice)
+	// телефон остаётся уникальным, как в RegisterAccount; проверяем до
+	// первой записи, чтобы конфликт не оставил импорт наполовину
+	err = checkImportPhones(repo, dir)
+	if err != nil {
+		return err
+	}
 
-		for _, accOperation := range accSlice {
+	staging := NewMemoryRepository()
 
-			if len(accOperation) == 0 {
-				break
+	// import accounts
+	err = decodeDumpFile(filepath.Join(dir, accountsFileName), func(dec *DumpDecoder) error {
+		for {
+			account, err := dec.DecodeAccount()
+			if err == io.EOF {
+				return nil
 			}
-			accStr := strings.Split(accOperation, ";")
-			log.Println("accStr:", accStr)
-
-			id, _ := strconv.ParseInt(accStr[0], 10, 64)
-			phone := types.Phone(accStr[1])
-			balance, _ := strconv.ParseInt(accStr[2], 10, 64)
-
-			accFind, _ := s.FindAccountByID(id)
-			if accFind != nil {
-				accFind.Phone = phone
-				accFind.Balance = types.Money(balance)
-			} else {
-				s.nextAccountID++
-				account := &types.Account{
-					ID:      id,
-					Phone:   phone,
-					Balance: types.Money(balance),
-				}
-				s.accounts = append(s.accounts, account)
-				log.Print(account)
+			if err != nil {
+				return err
+			}
+			err = staging.Accounts().Save(&account)
+			if err != nil {
+				return err
 			}
 		}
-	} else {
-		log.Print(err1)
+	})
+	if os.IsNotExist(err) {
+		log.Print(err)
+	} else if err != nil {
+		return err
 	}
 
 	//import payments
-	payFile, err2 := os.ReadFile(path + "/payments.dump")
-	if err2 == nil {
-
-		payData := string(payFile)
-		payData = strings.TrimSpace(payData)
-
-		paySlice := strings.Split(payData, "\n")
-		log.Print("paySlice : ", paySlice)
+	err = decodeDumpFile(filepath.Join(dir, paymentsFileName), func(dec *DumpDecoder) error {
+		for {
+			payment, err := dec.DecodePayment()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = staging.Payments().Save(&payment)
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if os.IsNotExist(err) {
+		log.Print(err)
+	} else if err != nil {
+		return err
+	}
 
-		for _, payOperation := range paySlice {
+	// import favorites
+	err = decodeDumpFile(filepath.Join(dir, favoritesFileName), func(dec *DumpDecoder) error {
+		for {
+			favorite, err := dec.DecodeFavorite()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = staging.Favorites().Save(&favorite)
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if os.IsNotExist(err) {
+		log.Print(err)
+	} else if err != nil {
+		return err
+	}
 
-			if len(payOperation) == 0 {
-				break
+	// import idempotency keys, в старых дампах файла нет
+	now := s.now()
+	err = decodeDumpFile(filepath.Join(dir, keysFileName), func(dec *DumpDecoder) error {
+		for {
+			record, err := dec.decodeIdempotencyRecord()
+			if err == io.EOF {
+				return nil
 			}
-			payStr := strings.Split(payOperation, ";")
-			log.Println("payStr:", payStr)
-
-			id := payStr[0]
-			accountID, _ := strconv.ParseInt(payStr[1], 10, 64)
-			amount, _ := strconv.ParseInt(payStr[2], 10, 64)
-			category := types.PaymentCategory(payStr[3])
-			status := types.PaymentStatus(payStr[4])
-
-			payAcc, _ := s.FindPaymentByID(id)
-			if payAcc != nil {
-				payAcc.AccountID = accountID
-				payAcc.Amount = types.Money(amount)
-				payAcc.Category = category
-				payAcc.Status = status
-			} else {
-				payment := &types.Payment{
-					ID:        id,
-					AccountID: accountID,
-					Amount:    types.Money(amount),
-					Category:  category,
-					Status:    status,
-				}
-				s.payments = append(s.payments, payment)
-				log.Print(payment)
+			if err != nil {
+				return err
+			}
+			if !record.ExpiresAt.After(now) {
+				continue
+			}
+			err = staging.Keys().Save(&record)
+			if err != nil {
+				return err
 			}
 		}
-	} else {
-		log.Print(err2)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
 
-	// import favorites
-	favFile, err3 := os.ReadFile(path + "/favorites.dump")
-	if err3 == nil {
+	return s.atomically(func() error {
+		return s.applyImport(staging)
+	})
+}
 
-		favData := string(favFile)
-		favData = strings.TrimSpace(favData)
+// applyImport переносит прочитанный Import дамп из staging в хранилище
+// сервиса. Вызывать под mu.Lock.
+func (s *Service) applyImport(staging Repository) error {
+	repo := s.storage()
 
-		favSlice := strings.Split(favData, "\n")
-		log.Print("favSlice : ", favSlice)
+	accounts, err := staging.Accounts().All()
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		err = repo.Accounts().Save(account)
+		if err != nil {
+			return err
+		}
+		// следующий RegisterAccount выдаст max(ID)+1
+		if account.ID > s.nextAccountID {
+			s.nextAccountID = account.ID
+		}
+	}
+	if len(accounts) > 0 {
+		// балансы из дампа не имеют истории, поэтому записываем их проводками opening
+		accounts, err = repo.Accounts().All()
+		if err != nil {
+			return err
+		}
+		err = s.postOpeningBalances(accounts)
+		if err != nil {
+			return err
+		}
+	}
 
-		for _, favOperation := range favSlice {
+	payments, err := staging.Payments().All()
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		err = repo.Payments().Save(payment)
+		if err != nil {
+			return err
+		}
+	}
 
-			if len(favOperation) == 0 {
-				break
-			}
-			favStr := strings.Split(favOperation, ";")
-			log.Println("favStr:", favStr)
-
-			id := favStr[0]
-			accountID, _ := strconv.ParseInt(favStr[1], 10, 64)
-			name := favStr[2]
-			amount, _ := strconv.ParseInt(favStr[3], 10, 64)
-			category := types.PaymentCategory(favStr[4])
-			favAcc, _ := s.FindFavoriteByID(id)
-
-			if favAcc != nil {
-				favAcc.AccountID = accountID
-				favAcc.Name = name
-				favAcc.Amount = types.Money(amount)
-				favAcc.Category = category
-			} else {
-				favorite := &types.Favorite{
-					ID:        id,
-					AccountID: accountID,
-					Name:      name,
-					Amount:    types.Money(amount),
-					Category:  category,
-				}
-				s.favorites = append(s.favorites, favorite)
-				log.Print(favorite)
-			}
+	favorites, err := staging.Favorites().All()
+	if err != nil {
+		return err
+	}
+	for _, favorite := range favorites {
+		err = repo.Favorites().Save(favorite)
+		if err != nil {
+			return err
 		}
-	} else {
-		log.Println(err3)
 	}
 
+	records, err := staging.Keys().All()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		err = repo.Keys().Save(record)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 
-
+// ExportAccountHistory возвращает копии платежей счёта вместе со временем
+// их создания и последнего изменения (CreatedAt, UpdatedAt).
 func (s *Service) ExportAccountHistory(accountID int64) ([]types.Payment,error) {
-	_, err := s.FindAccountByID(accountID)
+	repo := s.storage()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, err := repo.Accounts().ByID(accountID)
 	if err != nil {
 		return nil, ErrAccountNotFound
 	}
 
-	paym := []types.Payment{}
-	for _, payments := range s.payments {
-		if payments.AccountID == accountID {
-			paym =append(paym,*payments)
-		}
+	history, err := repo.Payments().ByAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	paym := make([]types.Payment, 0, len(history))
+	for _, payments := range history {
+		paym =append(paym,*payments)
 	}
 
 	if len(paym) <= 0 || paym == nil {
@@ -884,66 +1190,133 @@ func (s *Service) ExportAccountHistory(accountID int64) ([]types.Payment,error)
 	}
 	return paym,nil
 }
+// checkImportPhones проверяет, что после Import из dir у каждого телефона
+// останется один счёт: счета дампа заменяют счета с теми же ID, остальные
+// счета хранилища сохраняют свои телефоны. Смотрит на итог, а не на порядок
+// строк, поэтому счета дампа могут обменяться телефонами.
+func checkImportPhones(repo Repository, dir string) error {
+	type imported struct {
+		phone types.Phone
+		line  int
+	}
+	path := filepath.Join(dir, accountsFileName)
+	accounts := make(map[int64]imported)
+	order := []int64{}
+	err := decodeDumpFile(path, func(dec *DumpDecoder) error {
+		for {
+			account, err := dec.DecodeAccount()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if _, ok := accounts[account.ID]; !ok {
+				order = append(order, account.ID)
+			}
+			accounts[account.ID] = imported{account.Phone, dec.Line()}
+		}
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-func (s *Service) HistoryToFiles(payments []types.Payment, dir string, records int) error {
+	phones := make(map[types.Phone]int64)
+	for _, id := range order {
+		account := accounts[id]
+		if other, ok := phones[account.phone]; ok {
+			return fmt.Errorf("%s: line %d: %w: %s belongs to account %d", path, account.line, ErrPhoneRegistered, account.phone, other)
+		}
+		phones[account.phone] = id
 
-	_, cerr := os.Stat(dir)
-	if os.IsNotExist(cerr) {
-		cerr = os.Mkdir(dir, 0777)
+		owner, err := repo.Accounts().ByPhone(account.phone)
+		if err != nil {
+			continue
+		}
+		if _, replaced := accounts[owner.ID]; owner.ID != id && !replaced {
+			return fmt.Errorf("%s: line %d: %w: %s belongs to account %d", path, account.line, ErrPhoneRegistered, account.phone, owner.ID)
+		}
 	}
-	if cerr != nil {
-		return cerr
+	return nil
+}
+
+// HistoryToFiles записывает платежи в dir: в payments.dump, если их не больше
+// records, иначе по records штук в payments1.dump, payments2.dump и т.д.
+// (это HistoryToShards с ротацией только по числу записей).
+// records <= 0 означает «без ограничения».
+// Оба вида пишутся через манифест payments.manifest и заменяют файлы
+// другого вида от прошлых запусков, поэтому HistoryFromShards читает
+// именно последнюю историю. Пустая история ничего не пишет.
+func (s *Service) HistoryToFiles(payments []types.Payment, dir string, records int) error {
+
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		log.Print(err)
+		return err
 	}
 
 	if len(payments) == 0 || payments == nil {
 		return nil
 	}
 
-	data := make([]byte, 0)
-
-	if len(payments) > 0 && len(payments) <= records {
-		for _, payment := range payments {
-			text := []byte(
-				string(payment.ID) + ";" +
-					strconv.FormatInt(int64(payment.AccountID), 10) + ";" +
-					strconv.FormatInt(int64(payment.Amount), 10) + ";" +
-					string(payment.Category) + ";" +
-					string(payment.Status) + "\n")
-
-			data = append(data, text...)
-		}
-
-		path := dir + "/payments.dump"
-		err := os.WriteFile(path, data, 0777)
+	if records <= 0 || len(payments) <= records {
+		err = historyToFile(payments, dir)
 		if err != nil {
 			log.Print(err)
 			return err
 		}
-	} else {
-		for i, payment := range payments {
-
-			text := []byte(
-				string(payment.ID) + ";" +
-					strconv.FormatInt(int64(payment.AccountID), 10) + ";" +
-					strconv.FormatInt(int64(payment.Amount), 10) + ";" +
-					string(payment.Category) + ";" +
-					string(payment.Status) + "\n")
+		return nil
+	}
 
-			data = append(data, text...)
+	err = s.HistoryToShards(payments, dir, ShardOptions{Records: records})
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	// манифест уже без payments.dump, сбой здесь оставит только лишний файл
+	err = os.Remove(filepath.Join(dir, paymentsFileName))
+	if err != nil && !os.IsNotExist(err) {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
 
-			if (i+1)%records == 0 || i == len(payments)-1 {
+// historyToFile записывает платежи одним файлом payments.dump под манифестом
+// шардов и удаляет шарды прошлых запусков.
+func historyToFile(payments []types.Payment, dir string) error {
+	// payments.dump бывает и в дампе Export: сначала доводим его commit,
+	// чтобы не удалить чужой payments.dump.new
+	err := recoverDump(dir, manifestFileName, exportFiles)
+	if err != nil {
+		return err
+	}
+	set, err := newDumpSet(dir, shardsManifestFileName, append([]string{paymentsFileName}, shardFiles...))
+	if err != nil {
+		return err
+	}
+	defer set.discard()
 
-				path := dir + "/payments" + strconv.Itoa((i/records)+1) + ".dump"
-				err := os.WriteFile(path, data, 0777)
-				if err != nil {
-					log.Print(err)
-					return err
-				}
-				data = nil
+	err = set.add(paymentsFileName, func(enc *DumpEncoder) error {
+		for _, payment := range payments {
+			err := enc.EncodePayment(payment)
+			if err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	return nil
+	err = set.commit()
+	if err != nil {
+		return err
+	}
+	return removeStaleShards(dir, 0)
 }
 
 func (s *Service) Regular() int64 {
@@ -999,10 +1372,12 @@ func (s *Service) SumPayments(goroutines int) types.Money {
 	  	mu := sync.Mutex{}
 		sum := types.Money(0)
 
+		all := s.paymentsSnapshot()
+
 		if goroutines < 1 {
 			goroutines = 1
 			amount := types.Money(0)
-			for _, payment := range s.payments {
+			for _, payment := range all {
 				amount += payment.Amount
 			}
 			sum = amount
@@ -1011,7 +1386,7 @@ func (s *Service) SumPayments(goroutines int) types.Money {
 				go func(wg *sync.WaitGroup) {
 					defer wg.Done()
 					amount := types.Money(0)
-					for _, payment := range s.payments {
+					for _, payment := range all {
 						amount += payment.Amount
 					}
 					mu.Lock()
@@ -1068,17 +1443,18 @@ func (s *Service) FilterPayments(accountID int64, goroutines int) ([]types.Payme
 
 	mu := sync.Mutex{}
 	paymentFilter := []types.Payment{}
+	all := s.paymentsSnapshot()
 	
-	if len(s.payments) <= 0 {
+	if len(all) <= 0 {
 		return nil, ErrAccountNotFound
 	} 
 
 	if goroutines < 1 {
 		goroutines = 1
 		paymentF := []types.Payment{}
-		for _, payment := range s.payments {
+		for _, payment := range all {
 			if payment.AccountID == accountID {
-				paymentF = append(paymentF,*payment)
+				paymentF = append(paymentF,payment)
 			} else {return nil, ErrAccountNotFound}
 		}
 		paymentFilter = paymentF
@@ -1088,9 +1464,9 @@ func (s *Service) FilterPayments(accountID int64, goroutines int) ([]types.Payme
 			go func(wg *sync.WaitGroup) {
 				defer wg.Done()
 				paymentF := []types.Payment{}
-				for _, payment := range s.payments {
+				for _, payment := range all {
 					if payment.AccountID == accountID {
-						paymentF = append(paymentF, *payment)
+						paymentF = append(paymentF, payment)
 					} 
 				}
 				mu.Lock()
@@ -1112,7 +1488,8 @@ func (s *Service) FilterPaymentsByFn(filter func(payment types.Payment) bool, go
 		goroutines = 1
 	}
 
-	num := len(s.payments)/goroutines + 1
+	all := s.paymentsSnapshot()
+	num := len(all)/goroutines + 1
 
 	wg := sync.WaitGroup{}
 	mu := sync.Mutex{}
@@ -1130,11 +1507,11 @@ func (s *Service) FilterPaymentsByFn(filter func(payment types.Payment) bool, go
 			highIndex := (val * num) + num
 
 			for j := lowIndex; j < highIndex; j++ {
-				if j > len(s.payments)-1 {
+				if j > len(all)-1 {
 					break
 				}
-				if filter(*s.payments[j]) {
-					partOfPayment = append(partOfPayment, *s.payments[j])
+				if filter(all[j]) {
+					partOfPayment = append(partOfPayment, all[j])
 				}
 			}
 			mu.Lock()
@@ -1151,7 +1528,7 @@ func (s *Service) SumPaymentsWithProgress() <- chan types.Progress {
 	size := 100_000
 
 	data := []types.Money{0}
-	for _, payment := range s.payments {
+	for _, payment := range s.paymentsSnapshot() {
 		data = append(data, payment.Amount)
 	}
 
@@ -1210,3 +1587,127 @@ func Merge(channels []<-chan types.Progress) <-chan types.Progress {
 	}()
 	return merged
 }
+
+
+
+// storage возвращает хранилище, у нулевого Service это память.
+func (s *Service) storage() Repository {
+	s.once.Do(func() {
+		if s.repo == nil {
+			s.repo = NewMemoryRepository()
+		}
+		s.changes = &changeLog{last: make(map[changeKey]uint64)}
+
+		// все Save проходят через журнал изменений, см. ExportSince
+		tracked, err := trackChanges(s.repo)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		s.repo = tracked
+		s.changes = tracked.changes
+	})
+	return s.repo
+}
+
+// atomically выполняет fn как одно изменение хранилища: если хранилище
+// умеет пакеты (batcher), все записи fn переживут сбой вместе или не
+// переживут совсем. Вызывать под mu.RLock, без пакета хранилище меняют
+// только под mu.Lock.
+func (s *Service) atomically(fn func() error) error {
+	if b, ok := s.storage().(batcher); ok {
+		return b.batch(fn)
+	}
+	return fn()
+}
+
+// accountLock возвращает блокировку счёта, создавая её при первом обращении.
+func (s *Service) accountLock(accountID int64) *sync.Mutex {
+	s.locksMu.Lock()
+	defer s.locksMu.Unlock()
+
+	if s.locks == nil {
+		s.locks = make(map[int64]*sync.Mutex)
+	}
+	mu, ok := s.locks[accountID]
+	if !ok {
+		mu = &sync.Mutex{}
+		s.locks[accountID] = mu
+	}
+	return mu
+}
+
+// lockAccount блокирует счёт и возвращает его актуальную копию, вызывать под mu.RLock.
+func (s *Service) lockAccount(accountID int64) (*types.Account, func(), error) {
+	accounts := s.storage().Accounts()
+
+	// не заводим блокировки для несуществующих счетов
+	_, err := accounts.ByID(accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mu := s.accountLock(accountID)
+	mu.Lock()
+	account, err := accounts.ByID(accountID)
+	if err != nil {
+		mu.Unlock()
+		return nil, nil, err
+	}
+	return account, mu.Unlock, nil
+}
+
+// snapshot возвращает согласованные копии всех данных сервиса.
+// Запись в mu останавливает все денежные операции на время копирования.
+func (s *Service) snapshot() ([]types.Account, []types.Payment, []types.Favorite, error) {
+	repo := s.storage()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storedAccounts, err := repo.Accounts().All()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	storedPayments, err := repo.Payments().All()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	storedFavorites, err := repo.Favorites().All()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	accounts := make([]types.Account, 0, len(storedAccounts))
+	for _, account := range storedAccounts {
+		accounts = append(accounts, *account)
+	}
+	payments := make([]types.Payment, 0, len(storedPayments))
+	for _, payment := range storedPayments {
+		payments = append(payments, *payment)
+	}
+	favorites := make([]types.Favorite, 0, len(storedFavorites))
+	for _, favorite := range storedFavorites {
+		favorites = append(favorites, *favorite)
+	}
+	return accounts, payments, favorites, nil
+}
+
+// paymentsSnapshot возвращает копию всех платежей для Filter* и Sum*.
+func (s *Service) paymentsSnapshot() []types.Payment {
+	repo := s.storage()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := repo.Payments().All()
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+	payments := make([]types.Payment, 0, len(stored))
+	for _, payment := range stored {
+		payments = append(payments, *payment)
+	}
+	return payments
+}
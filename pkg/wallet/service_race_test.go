@@ -0,0 +1,288 @@
+package wallet
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// Эти тесты имеют смысл прежде всего под go test -race.
+
+const (
+	stressAccounts   = 8
+	stressGoroutines = 8
+	stressOperations = 50
+)
+
+func registerStressAccounts(t *testing.T, s *Service, balance types.Money) []int64 {
+	t.Helper()
+
+	ids := make([]int64, stressAccounts)
+	for i := range ids {
+		account, err := s.RegisterAccount(types.Phone("+99290000" + strconv.Itoa(1000+i)))
+		if err != nil {
+			t.Fatalf("RegisterAccount(): error = %v", err)
+		}
+		if err := s.Deposit(account.ID, balance); err != nil {
+			t.Fatalf("Deposit(): error = %v", err)
+		}
+		ids[i] = account.ID
+	}
+	return ids
+}
+
+func TestService_RegisterAccount_concurrentSamePhone(t *testing.T) {
+	s := &Service{}
+
+	var registered int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.RegisterAccount("+992900000001")
+			if err == nil {
+				atomic.AddInt32(&registered, 1)
+				return
+			}
+			if err != ErrPhoneRegistered {
+				t.Errorf("RegisterAccount(): must return ErrPhoneRegistered, returned = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if registered != 1 {
+		t.Errorf("RegisterAccount(): phone registered %v times, want 1", registered)
+	}
+}
+
+func TestService_Pay_concurrentOverdraft(t *testing.T) {
+	s := &Service{}
+	account, _ := s.RegisterAccount("+992900000001")
+	_ = s.Deposit(account.ID, 1_000)
+
+	var paid int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Pay(account.ID, 100, "auto")
+			if err == nil {
+				atomic.AddInt32(&paid, 1)
+				return
+			}
+			if err != ErrNotEnoughBalance {
+				t.Errorf("Pay(): must return ErrNotEnoughBalance, returned = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if paid != 10 {
+		t.Errorf("Pay(): %v payments passed, want 10", paid)
+	}
+	got, _ := s.FindAccountByID(account.ID)
+	if got.Balance != 0 {
+		t.Errorf("Pay(): balance = %v, want 0", got.Balance)
+	}
+}
+
+func TestService_concurrentMoneyMovement(t *testing.T) {
+	s := &Service{}
+	const initial = types.Money(1_000_000)
+	ids := registerStressAccounts(t, s, initial)
+
+	// каждая горутина пополняет, платит и отменяет каждый второй свой платёж
+	wg := sync.WaitGroup{}
+	for _, id := range ids {
+		for g := 0; g < stressGoroutines; g++ {
+			wg.Add(1)
+			go func(accountID int64) {
+				defer wg.Done()
+				for i := 0; i < stressOperations; i++ {
+					if err := s.Deposit(accountID, 10); err != nil {
+						t.Errorf("Deposit(): error = %v", err)
+						return
+					}
+					payment, err := s.Pay(accountID, 20, "auto")
+					if err != nil {
+						t.Errorf("Pay(): error = %v", err)
+						return
+					}
+					if i%2 == 0 {
+						if err := s.Reject(payment.ID); err != nil {
+							t.Errorf("Reject(): error = %v", err)
+							return
+						}
+					}
+				}
+			}(id)
+		}
+	}
+	wg.Wait()
+
+	// пополнения +10, платежи -20, отменённые платежи возвращают 20
+	perGoroutine := types.Money(stressOperations*10 - stressOperations*20 + stressOperations/2*20)
+	want := initial + perGoroutine*stressGoroutines
+	for _, id := range ids {
+		account, err := s.FindAccountByID(id)
+		if err != nil {
+			t.Fatalf("FindAccountByID(): error = %v", err)
+		}
+		if account.Balance != want {
+			t.Errorf("account %v: balance = %v, want %v", id, account.Balance, want)
+		}
+	}
+
+	payments, err := s.FilterPaymentsByFn(func(payment types.Payment) bool { return true }, 4)
+	if err != nil {
+		t.Fatalf("FilterPaymentsByFn(): error = %v", err)
+	}
+	if len(payments) != stressAccounts*stressGoroutines*stressOperations {
+		t.Errorf("FilterPaymentsByFn(): got %v payments, want %v", len(payments), stressAccounts*stressGoroutines*stressOperations)
+	}
+}
+
+func TestService_concurrentReadersAndWriters(t *testing.T) {
+	s := &Service{}
+	ids := registerStressAccounts(t, s, 1_000_000)
+	dir := t.TempDir()
+
+	done := make(chan struct{})
+	readers := sync.WaitGroup{}
+
+	// читатели работают, пока писатели не закончат
+	read := func(fn func()) {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					fn()
+				}
+			}
+		}()
+	}
+	read(func() { _, _ = s.FindAccountByID(ids[0]) })
+	read(func() { _, _ = s.ExportAccountHistory(ids[1]) })
+	read(func() { _, _ = s.FilterPayments(ids[2], 2) })
+	read(func() {
+		_, _ = s.FilterPaymentsByFn(func(payment types.Payment) bool { return payment.Amount > 0 }, 3)
+	})
+	read(func() { _ = s.SumPayments(2) })
+	read(func() {
+		for range s.SumPaymentsWithProgress() {
+		}
+	})
+	read(func() {
+		if err := s.Export(dir); err != nil {
+			t.Errorf("Export(): error = %v", err)
+		}
+	})
+	read(func() {
+		if err := s.ExportToFile(dir + "/accounts.txt"); err != nil {
+			t.Errorf("ExportToFile(): error = %v", err)
+		}
+	})
+
+	writers := sync.WaitGroup{}
+	for _, id := range ids {
+		writers.Add(1)
+		go func(accountID int64) {
+			defer writers.Done()
+			for i := 0; i < stressOperations; i++ {
+				payment, err := s.Pay(accountID, 10, "auto")
+				if err != nil {
+					t.Errorf("Pay(): error = %v", err)
+					return
+				}
+				if _, err := s.Repeat(payment.ID); err != nil {
+					t.Errorf("Repeat(): error = %v", err)
+					return
+				}
+				favorite, err := s.FavoritePayment(payment.ID, "favorite")
+				if err != nil {
+					t.Errorf("FavoritePayment(): error = %v", err)
+					return
+				}
+				if _, err := s.FindFavoriteByID(favorite.ID); err != nil {
+					t.Errorf("FindFavoriteByID(): error = %v", err)
+					return
+				}
+				if _, err := s.PayFromFavorite(favorite.ID); err != nil {
+					t.Errorf("PayFromFavorite(): error = %v", err)
+					return
+				}
+				if err := s.Reject(payment.ID); err != nil {
+					t.Errorf("Reject(): error = %v", err)
+					return
+				}
+			}
+		}(id)
+	}
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		for i := 0; i < stressOperations; i++ {
+			if _, err := s.RegisterAccount(types.Phone("+99291000" + strconv.Itoa(1000+i))); err != nil {
+				t.Errorf("RegisterAccount(): error = %v", err)
+				return
+			}
+		}
+	}()
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	// Pay и Repeat и PayFromFavorite списывают по 10, Reject возвращает 10
+	want := types.Money(1_000_000 - stressOperations*20)
+	for _, id := range ids {
+		account, _ := s.FindAccountByID(id)
+		if account.Balance != want {
+			t.Errorf("account %v: balance = %v, want %v", id, account.Balance, want)
+		}
+	}
+}
+
+func TestService_Import_concurrent(t *testing.T) {
+	source := &Service{}
+	registerStressAccounts(t, source, 1_000)
+	dir := t.TempDir()
+	if err := source.Export(dir); err != nil {
+		t.Fatalf("Export(): error = %v", err)
+	}
+
+	s := &Service{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := s.Import(dir); err != nil {
+				t.Errorf("Import(): error = %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if account, err := s.FindAccountByID(1); err == nil {
+				_, _ = s.Pay(account.ID, 1, "auto")
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := int64(1); i <= stressAccounts; i++ {
+		if _, err := s.FindAccountByID(i); err != nil {
+			t.Errorf("FindAccountByID(%v): error = %v", i, err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -741,7 +742,7 @@ func TestService_Export(t *testing.T) {
 		return
 	}
 
-	err = s.Export("data")
+	err = s.Export(t.TempDir())
 	if err != nil {
 		t.Error(err)
 		return
@@ -877,6 +878,7 @@ func Transactions(s *testService) {
 	s.Pay(3, 25, "phone")
 }
 func TestService_HistoryToFiles_success(t *testing.T) {
+	dir := t.TempDir()
 	s := newTestService()
 	Transactions(s)
 
@@ -884,20 +886,80 @@ func TestService_HistoryToFiles_success(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	err = s.HistoryToFiles(payments, "data", 3)
+	err = s.HistoryToFiles(payments, dir, 3)
 	if err != nil {
 		t.Error(err)
 	}
+	got, err := s.HistoryFromShards(dir)
+	if err != nil || !reflect.DeepEqual(got, payments) {
+		t.Errorf("HistoryFromShards() = %v, %v, want %v", got, err, payments)
+	}
+
+	// все платежи помещаются в один файл
+	dir = t.TempDir()
+	err = s.HistoryToFiles(payments, dir, 12)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = os.Stat(filepath.Join(dir, paymentsFileName))
+	if err != nil {
+		t.Errorf("HistoryToFiles(): %d payments must fit in %s, error = %v", len(payments), paymentsFileName, err)
+	}
+}
+func TestService_HistoryToFiles_replacesLayout(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestService()
+	Transactions(s)
+	payments, _ := s.ExportAccountHistory(1)
+
+	// шарды, потом один файл: старые шарды не должны вернуться
+	if err := s.HistoryToFiles(payments, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.HistoryToFiles(payments[:1], dir, 12); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.HistoryFromShards(dir)
+	if err != nil || !reflect.DeepEqual(got, payments[:1]) {
+		t.Errorf("HistoryFromShards() after a single file = %v, %v, want %v", got, err, payments[:1])
+	}
+	if shards, _ := filepath.Glob(filepath.Join(dir, "payments[0-9]*.dump")); len(shards) != 0 {
+		t.Errorf("HistoryToFiles(): stale shards %v left", shards)
+	}
+
+	// один файл, потом шарды: старый payments.dump не должен остаться
+	if err := s.HistoryToFiles(payments, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.HistoryFromShards(dir)
+	if err != nil || !reflect.DeepEqual(got, payments) {
+		t.Errorf("HistoryFromShards() after shards = %v, %v, want %v", got, err, payments)
+	}
+	if _, err := os.Stat(filepath.Join(dir, paymentsFileName)); !os.IsNotExist(err) {
+		t.Errorf("HistoryToFiles(): stale %s left, error = %v", paymentsFileName, err)
+	}
 }
 func TestService_HistoryToFiles_notSuccess(t *testing.T) {
+	dir := t.TempDir()
 	s := newTestService()
 	Transactions(s)
 
+	payments, _ := s.ExportAccountHistory(1)
+	err := s.HistoryToFiles(payments, dir, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// пустая история ничего не пишет и не удаляет
 	payment := []types.Payment{}
-	err := s.HistoryToFiles(payment, "data", 12)
+	err = s.HistoryToFiles(payment, dir, 12)
 	if err != nil {
 		t.Error(err)
 	}
+	got, err := s.HistoryFromShards(dir)
+	if err != nil || len(got) != len(payments) {
+		t.Errorf("HistoryFromShards() = %v, %v, want %v", got, err, payments)
+	}
 }
 
 func BenchmarkRegular(b *testing.B) {
@@ -1011,6 +1073,125 @@ func BenchmarkFilterPayments(b *testing.B) {
 }
 
 
+// benchmarkService создаёт сервис со счетами, платежами и избранным для бенчмарков поиска.
+func benchmarkService(b *testing.B, accounts, paymentsPerAccount int) (*testService, []*types.Payment, []*types.Favorite) {
+	b.Helper()
+	s := newTestService()
+	payments := make([]*types.Payment, 0, accounts*paymentsPerAccount)
+	favorites := make([]*types.Favorite, 0, accounts)
+	for i := 0; i < accounts; i++ {
+		account, err := s.RegisterAccount(types.Phone(fmt.Sprintf("+992%09d", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := s.Deposit(account.ID, types.Money(paymentsPerAccount)); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < paymentsPerAccount; j++ {
+			payment, err := s.Pay(account.ID, 1, "auto")
+			if err != nil {
+				b.Fatal(err)
+			}
+			payments = append(payments, payment)
+		}
+		favorite, err := s.FavoritePayment(payments[len(payments)-1].ID, "favorite")
+		if err != nil {
+			b.Fatal(err)
+		}
+		favorites = append(favorites, favorite)
+	}
+	return s, payments, favorites
+}
+
+func BenchmarkFindAccountByID(b *testing.B) {
+	s, _, _ := benchmarkService(b, 10_000, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.FindAccountByID(int64(i%10_000) + 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindPaymentByID(b *testing.B) {
+	s, payments, _ := benchmarkService(b, 1_000, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.FindPaymentByID(payments[i%len(payments)].ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindFavoriteByID(b *testing.B) {
+	s, _, favorites := benchmarkService(b, 10_000, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.FindFavoriteByID(favorites[i%len(favorites)].ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRegisterAccount(b *testing.B) {
+	s := newTestService()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.RegisterAccount(types.Phone(fmt.Sprintf("+992%09d", i))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExportAccountHistory(b *testing.B) {
+	s, _, _ := benchmarkService(b, 1_000, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		payments, err := s.ExportAccountHistory(int64(i%1_000) + 1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(payments) != 100 {
+			b.Fatalf("invalid result, got %v, want %v", len(payments), 100)
+		}
+	}
+}
+
+
+func TestService_Import_updatesIndexes(t *testing.T) {
+	source := newTestService()
+	Transactions(source)
+	dir := t.TempDir()
+	if err := source.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// в сервисе уже есть счёт 1 с другим телефоном, импорт его перезапишет
+	s := newTestService()
+	if _, err := s.RegisterAccount("9999"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RegisterAccount("9999"); err != nil {
+		t.Errorf("RegisterAccount(): old phone must be free after Import, error = %v", err)
+	}
+	if _, err := s.RegisterAccount("1111"); err != ErrPhoneRegistered {
+		t.Errorf("RegisterAccount(): must return ErrPhoneRegistered, returned = %v", err)
+	}
+
+	want, _ := source.ExportAccountHistory(1)
+	got, err := s.ExportAccountHistory(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("ExportAccountHistory(): wrong payments after Import,\n got = %v,\n want = %v", got, want)
+	}
+}
+
+
 
 func TestService_FilterPaymentsByFn(t *testing.T) {
 	s := newTestService()
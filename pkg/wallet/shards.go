@@ -0,0 +1,246 @@
+package wallet
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// shardsManifestFileName манифест шардов истории платежей, формат как у
+// manifestFileName. Имя своё, чтобы шарды и Export могли жить в одном каталоге.
+const shardsManifestFileName = "payments.manifest"
+
+// ShardOptions задаёт ротацию шардов HistoryToShards. Шард закрывается,
+// когда в нём Records записей или следующая запись превысит Bytes байт;
+// нулевые значения означают «без ограничения». В шард всегда попадает
+// хотя бы одна запись, даже если она длиннее Bytes.
+type ShardOptions struct {
+	Records int
+	Bytes   int64
+	// Workers — сколько шардов пишется и читается одновременно, по
+	// умолчанию runtime.GOMAXPROCS(0).
+	Workers int
+}
+
+// shardName возвращает имя n-го шарда (с 1): payments1.dump, payments2.dump и т.д.
+func shardName(n int) string {
+	return "payments" + strconv.Itoa(n) + ".dump"
+}
+
+// shardFiles шаблон имён шардов для recoverDump.
+var shardFiles = []string{"payments[0-9]*.dump"}
+
+// shardNumber разбирает имя шарда, ok == false для остальных файлов.
+func shardNumber(name string) (int, bool) {
+	if !strings.HasPrefix(name, "payments") || !strings.HasSuffix(name, ".dump") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "payments"), ".dump"))
+	if err != nil || n <= 0 || shardName(n) != name {
+		return 0, false
+	}
+	return n, true
+}
+
+// splitShards делит платежи на шарды по правилам opts и возвращает
+// границы: шард i — payments[bounds[i]:bounds[i+1]].
+func splitShards(payments []types.Payment, opts ShardOptions) []int {
+	bounds := []int{0}
+	records, size := 0, int64(0)
+	for i, payment := range payments {
+		// длина строки дампа с переводом строки
+		length := int64(len(formatPayment(payment))) + 1
+		full := opts.Records > 0 && records >= opts.Records
+		large := opts.Bytes > 0 && records > 0 && size+length > opts.Bytes
+		if full || large {
+			bounds = append(bounds, i)
+			records, size = 0, 0
+		}
+		records++
+		size += length
+	}
+	if len(payments) > 0 {
+		bounds = append(bounds, len(payments))
+	}
+	return bounds
+}
+
+// HistoryToShards записывает платежи в dir шардами payments1.dump,
+// payments2.dump и т.д. Шарды пишутся параллельно во временные файлы и
+// ставятся на место вместе с манифестом payments.manifest, как в Export;
+// шарды прошлых запусков с большими номерами удаляются. Без платежей
+// писать нечего, и шарды прошлых запусков остаются как есть.
+func (s *Service) HistoryToShards(payments []types.Payment, dir string, opts ShardOptions) error {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+	if len(payments) == 0 {
+		return nil
+	}
+
+	bounds := splitShards(payments, opts)
+	shards := len(bounds) - 1
+
+	set, err := newDumpSet(dir, shardsManifestFileName, shardFiles)
+	if err != nil {
+		return err
+	}
+	set.pending = make([]pendingDump, shards)
+	defer set.discard()
+
+	errs := make([]error, shards)
+	forEachShard(shards, opts.Workers, func(i int) {
+		set.pending[i], errs[i] = writePending(dir, shardName(i+1), func(enc *DumpEncoder) error {
+			for _, payment := range payments[bounds[i]:bounds[i+1]] {
+				err := enc.EncodePayment(payment)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	err = set.commit()
+	if err != nil {
+		return err
+	}
+	return removeStaleShards(dir, shards)
+}
+
+// removeStaleShards удаляет шарды с номерами больше last. Манифест уже
+// записан без них, поэтому сбой здесь оставляет только лишние файлы.
+func removeStaleShards(dir string, last int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		n, ok := shardNumber(entry.Name())
+		if !ok || n <= last {
+			continue
+		}
+		err = os.Remove(filepath.Join(dir, entry.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistoryFromShards читает шарды HistoryToShards из dir и собирает платежи
+// в исходном порядке. Шарды сверяются с манифестом (ErrManifestMismatch при
+// расхождении); без манифеста читаются payments1.dump, payments2.dump и т.д.
+// до первого отсутствующего, как их писал прежний HistoryToFiles.
+func (s *Service) HistoryFromShards(dir string) ([]types.Payment, error) {
+	names, err := shardNames(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([][]types.Payment, len(names))
+	errs := make([]error, len(names))
+	forEachShard(len(names), 0, func(i int) {
+		errs[i] = decodeDumpFile(filepath.Join(dir, names[i]), func(dec *DumpDecoder) error {
+			for {
+				payment, err := dec.DecodePayment()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				parts[i] = append(parts[i], payment)
+			}
+		})
+	})
+
+	payments := []types.Payment{}
+	for i, part := range parts {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		payments = append(payments, part...)
+	}
+	return payments, nil
+}
+
+// shardNames возвращает имена шардов dir по порядку.
+func shardNames(dir string) ([]string, error) {
+	err := recoverDump(dir, shardsManifestFileName, shardFiles)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readManifest(filepath.Join(dir, shardsManifestFileName))
+	if err == nil {
+		err = verifyEntries(entries, dirChecksum(dir))
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, entry := range entries {
+			if entry.records > 0 {
+				names = append(names, entry.name)
+			}
+		}
+		return names, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, err = os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for n := 1; ; n++ {
+		_, err := os.Stat(filepath.Join(dir, shardName(n)))
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, shardName(n))
+	}
+}
+
+// forEachShard вызывает fn(0..count-1) не более чем в workers горутинах.
+func forEachShard(count, workers int, fn func(i int)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > count {
+		workers = count
+	}
+
+	next := make(chan int)
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
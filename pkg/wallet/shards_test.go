@@ -0,0 +1,141 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func shardPayments(count int) []types.Payment {
+	payments := []types.Payment{}
+	for i := 0; i < count; i++ {
+		payments = append(payments, types.Payment{
+			ID:        "p" + strconv.Itoa(i),
+			AccountID: 1,
+			Amount:    types.Money(i + 1),
+			Category:  "auto",
+			Status:    types.PaymentStatusOk,
+			Currency:  DefaultCurrency,
+		})
+	}
+	return payments
+}
+
+func dumpFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSplitShards(t *testing.T) {
+	payments := shardPayments(5)
+	// строка "p0;1;1;auto;OK" с переводом строки — 15 байт
+	tests := []struct {
+		opts ShardOptions
+		want []int
+	}{
+		{ShardOptions{}, []int{0, 5}},
+		{ShardOptions{Records: 2}, []int{0, 2, 4, 5}},
+		{ShardOptions{Bytes: 45}, []int{0, 3, 5}},
+		{ShardOptions{Records: 2, Bytes: 15}, []int{0, 1, 2, 3, 4, 5}},
+		// запись длиннее Bytes всё равно попадает в шард
+		{ShardOptions{Bytes: 1}, []int{0, 1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		if got := splitShards(payments, tt.opts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitShards(%+v) = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+	if got := splitShards(nil, ShardOptions{Records: 2}); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("splitShards(nil) = %v, want [0]", got)
+	}
+}
+
+func TestService_HistoryToShards_roundTrip(t *testing.T) {
+	s := &Service{}
+	dir := t.TempDir()
+	payments := shardPayments(10)
+
+	if err := s.HistoryToShards(payments, dir, ShardOptions{Records: 3, Workers: 2}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{shardsManifestFileName, "payments1.dump", "payments2.dump", "payments3.dump", "payments4.dump"}
+	if got := dumpFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("HistoryToShards(): files %v, want %v", got, want)
+	}
+	got, err := s.HistoryFromShards(dir)
+	if err != nil || !reflect.DeepEqual(got, payments) {
+		t.Errorf("HistoryFromShards() = %v, %v, want %v", got, err, payments)
+	}
+
+	// меньше шардов: старые payments3.dump и payments4.dump удаляются
+	if err := s.HistoryToShards(payments[:4], dir, ShardOptions{Records: 2}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{shardsManifestFileName, "payments1.dump", "payments2.dump"}
+	if got := dumpFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("HistoryToShards(): files %v, want %v", got, want)
+	}
+	got, err = s.HistoryFromShards(dir)
+	if err != nil || !reflect.DeepEqual(got, payments[:4]) {
+		t.Errorf("HistoryFromShards() = %v, %v, want %v", got, err, payments[:4])
+	}
+
+	// без платежей писать нечего, шарды остаются
+	if err := s.HistoryToShards(nil, dir, ShardOptions{Records: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := dumpFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("HistoryToShards(nil): files %v, want %v", got, want)
+	}
+	if got, err := s.HistoryFromShards(dir); err != nil || !reflect.DeepEqual(got, payments[:4]) {
+		t.Errorf("HistoryFromShards() = %v, %v, want %v", got, err, payments[:4])
+	}
+}
+
+func TestService_HistoryFromShards_mismatch(t *testing.T) {
+	s := &Service{}
+	dir := t.TempDir()
+	if err := s.HistoryToShards(shardPayments(4), dir, ShardOptions{Records: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "payments2.dump"), []byte("p9;1;1;auto;OK\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HistoryFromShards(dir); !errors.Is(err, ErrManifestMismatch) {
+		t.Errorf("HistoryFromShards(): must return ErrManifestMismatch, returned = %v", err)
+	}
+}
+
+func TestService_HistoryFromShards_legacy(t *testing.T) {
+	dir := writeDumpFiles(t, map[string]string{
+		"payments1.dump": "p1;1;10;auto;OK\n",
+		"payments2.dump": "p2;1;20;food;OK\n",
+		// без payments3.dump четвёртый шард не читается
+		"payments4.dump": "p4;1;40;food;OK\n",
+	})
+
+	s := &Service{}
+	got, err := s.HistoryFromShards(dir)
+	if err != nil || len(got) != 2 || got[0].ID != "p1" || got[1].ID != "p2" {
+		t.Errorf("HistoryFromShards() = %v, %v, want p1 and p2", got, err)
+	}
+	if _, err := s.HistoryFromShards(filepath.Join(dir, "none")); !os.IsNotExist(err) {
+		t.Errorf("HistoryFromShards(): must fail for a missing directory, returned = %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package wallet
+
+import (
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// Stats сводка по состоянию сервиса. Суммы разложены по валютам, потому
+// что складывать сомони с долларами бессмысленно.
+type Stats struct {
+	Accounts  int
+	Payments  int
+	Favorites int
+	// Balances сумма балансов счетов по валютам.
+	Balances map[types.Currency]types.Money
+	// PaymentsByStatus число платежей в каждом статусе.
+	PaymentsByStatus map[types.PaymentStatus]int
+	// Paid сумма платежей в статусах INPROGRESS и Ok по валютам.
+	Paid map[types.Currency]types.Money
+}
+
+// Stats считает сводку по всем счетам, платежам и избранному.
+func (s *Service) Stats() (Stats, error) {
+	accounts, payments, favorites, err := s.snapshot()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{
+		Accounts:         len(accounts),
+		Payments:         len(payments),
+		Favorites:        len(favorites),
+		Balances:         map[types.Currency]types.Money{},
+		PaymentsByStatus: map[types.PaymentStatus]int{},
+		Paid:             map[types.Currency]types.Money{},
+	}
+	for _, account := range accounts {
+		currency := currencyOf(account.Currency)
+		stats.Balances[currency], err = stats.Balances[currency].Add(account.Balance)
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+	for _, payment := range payments {
+		stats.PaymentsByStatus[payment.Status]++
+		if payment.Status != types.PaymentStatusInProgress && payment.Status != types.PaymentStatusOk {
+			continue
+		}
+		currency := currencyOf(payment.Currency)
+		stats.Paid[currency], err = stats.Paid[currency].Add(payment.Amount)
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+	return stats, nil
+}
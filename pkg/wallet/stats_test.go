@@ -0,0 +1,49 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func TestService_Stats(t *testing.T) {
+	s := &Service{}
+	account, _ := s.RegisterAccount("+992900000001")
+	_ = s.Deposit(account.ID, 1000)
+	usd, _ := s.RegisterAccountWithCurrency("+992900000002", types.CurrencyUSD)
+	_ = s.Deposit(usd.ID, 500)
+
+	payment, _ := s.Pay(account.ID, 100, "auto")
+	_, _ = s.Pay(account.ID, 200, "food")
+	_ = s.Reject(payment.ID)
+	_, _ = s.Pay(usd.ID, 50, "auto")
+	_, _ = s.FavoritePayment(payment.ID, "car")
+
+	got, err := s.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{
+		Accounts:  2,
+		Payments:  3,
+		Favorites: 1,
+		Balances:  map[types.Currency]types.Money{DefaultCurrency: 800, types.CurrencyUSD: 450},
+		PaymentsByStatus: map[types.PaymentStatus]int{
+			types.PaymentStatusInProgress: 2,
+			types.PaymentStatusFail:       1,
+		},
+		Paid: map[types.Currency]types.Money{DefaultCurrency: 200, types.CurrencyUSD: 50},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestService_Stats_empty(t *testing.T) {
+	s := &Service{}
+	got, err := s.Stats()
+	if err != nil || got.Accounts != 0 || got.Payments != 0 || len(got.Balances) != 0 {
+		t.Errorf("Stats() = %+v, %v, want empty", got, err)
+	}
+}
@@ -0,0 +1,157 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// ErrInvalidStatusTransition возвращается (внутри StatusTransitionError),
+// если платёж нельзя перевести из текущего статуса в запрошенный.
+var ErrInvalidStatusTransition = errors.New("invalid payment status transition")
+
+// StatusTransitionError уточняет, какой переход статуса был запрещён.
+// errors.Is(err, ErrInvalidStatusTransition) для него истинно.
+type StatusTransitionError struct {
+	PaymentID string
+	From      types.PaymentStatus
+	To        types.PaymentStatus
+}
+
+func (e *StatusTransitionError) Error() string {
+	return fmt.Sprintf("payment %s: %s -> %s: %v", e.PaymentID, e.From, e.To, ErrInvalidStatusTransition)
+}
+
+func (e *StatusTransitionError) Unwrap() error {
+	return ErrInvalidStatusTransition
+}
+
+// paymentTransitions разрешённые переходы статусов платежа:
+//
+//	INPROGRESS -> Ok        Confirm
+//	INPROGRESS -> FAIL      Reject до подтверждения
+//	Ok         -> REFUNDED  Reject после подтверждения
+var paymentTransitions = map[types.PaymentStatus][]types.PaymentStatus{
+	types.PaymentStatusInProgress: {types.PaymentStatusOk, types.PaymentStatusFail},
+	types.PaymentStatusOk:         {types.PaymentStatusRefunded},
+}
+
+func checkTransition(payment *types.Payment, to types.PaymentStatus) error {
+	for _, allowed := range paymentTransitions[payment.Status] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return &StatusTransitionError{PaymentID: payment.ID, From: payment.Status, To: to}
+}
+
+// rejectedStatus возвращает статус, в который Reject переводит платёж.
+func rejectedStatus(from types.PaymentStatus) types.PaymentStatus {
+	if from == types.PaymentStatusOk {
+		return types.PaymentStatusRefunded
+	}
+	return types.PaymentStatusFail
+}
+
+// recordCreated открывает историю статусов нового платежа.
+func (s *Service) recordCreated(payment *types.Payment) error {
+	return s.storage().Payments().AddStatusChange(&types.PaymentStatusChange{
+		PaymentID: payment.ID,
+		To:        payment.Status,
+		At:        s.now(),
+	})
+}
+
+// changeStatus проверяет переход, сохраняет платёж и дописывает историю.
+// Вызывать под блокировкой счёта платежа.
+func (s *Service) changeStatus(payment *types.Payment, to types.PaymentStatus) error {
+	err := checkTransition(payment, to)
+	if err != nil {
+		return err
+	}
+
+	from := payment.Status
+	now := s.now()
+	payment.Status = to
+	payment.UpdatedAt = now
+	err = s.storage().Payments().Save(payment)
+	if err != nil {
+		return err
+	}
+	return s.storage().Payments().AddStatusChange(&types.PaymentStatusChange{
+		PaymentID: payment.ID,
+		From:      from,
+		To:        to,
+		At:        now,
+	})
+}
+
+// Confirm подтверждает платёж (INPROGRESS -> Ok). Перевод подтверждается
+// сразу с обеих сторон.
+func (s *Service) Confirm(paymentID string) error {
+	payments := s.storage().Payments()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payment, err := payments.ByID(paymentID)
+	if err != nil {
+		return ErrPaymentNotFound
+	}
+
+	ids := []string{payment.ID}
+	accountIDs := []int64{payment.AccountID}
+	if payment.CounterpartID != "" {
+		counterpart, err := payments.ByID(payment.CounterpartID)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, counterpart.ID)
+		accountIDs = append(accountIDs, counterpart.AccountID)
+	}
+
+	unlock, err := s.lockAccounts(accountIDs...)
+	if err != nil {
+		return ErrAccountNotFound
+	}
+	defer unlock()
+
+	// статусы меняются только под блокировками счетов, перечитываем
+	// и проверяем все переходы до того, как менять хоть один
+	confirmed := make([]*types.Payment, 0, len(ids))
+	for _, id := range ids {
+		payment, err := payments.ByID(id)
+		if err != nil {
+			return err
+		}
+		err = checkTransition(payment, types.PaymentStatusOk)
+		if err != nil {
+			return err
+		}
+		confirmed = append(confirmed, payment)
+	}
+	return s.atomically(func() error {
+		for _, payment := range confirmed {
+			err := s.changeStatus(payment, types.PaymentStatusOk)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PaymentStatusHistory возвращает историю статусов платежа с отметками времени.
+func (s *Service) PaymentStatusHistory(paymentID string) ([]types.PaymentStatusChange, error) {
+	payments := s.storage().Payments()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, err := payments.ByID(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	return payments.StatusHistory(paymentID)
+}
@@ -0,0 +1,169 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func statusesOf(history []types.PaymentStatusChange) []types.PaymentStatus {
+	statuses := make([]types.PaymentStatus, 0, len(history))
+	for _, change := range history {
+		statuses = append(statuses, change.To)
+	}
+	return statuses
+}
+
+func TestService_Confirm_success(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 300, "auto")
+
+	if err := s.Confirm(payment.ID); err != nil {
+		t.Fatalf("Confirm(): error = %v", err)
+	}
+	got, _ := s.FindPaymentByID(payment.ID)
+	if got.Status != types.PaymentStatusOk {
+		t.Errorf("Confirm(): status = %v, want %v", got.Status, types.PaymentStatusOk)
+	}
+
+	err := s.Confirm(payment.ID)
+	if !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Confirm(): must return ErrInvalidStatusTransition, returned = %v", err)
+	}
+	if err := s.Confirm("unknown"); err != ErrPaymentNotFound {
+		t.Errorf("Confirm(): must return ErrPaymentNotFound, returned = %v", err)
+	}
+}
+
+func TestService_Confirm_transfer(t *testing.T) {
+	s, from, to := newTransferService(t)
+	out, _ := s.Transfer(from.ID, to.Phone, 300)
+
+	if err := s.Confirm(out.CounterpartID); err != nil {
+		t.Fatalf("Confirm(): error = %v", err)
+	}
+	for _, paymentID := range []string{out.ID, out.CounterpartID} {
+		payment, _ := s.FindPaymentByID(paymentID)
+		if payment.Status != types.PaymentStatusOk {
+			t.Errorf("Confirm(): payment %v status = %v", paymentID, payment.Status)
+		}
+	}
+
+	if err := s.Reject(out.ID); err != nil {
+		t.Fatalf("Reject(): error = %v", err)
+	}
+	for _, paymentID := range []string{out.ID, out.CounterpartID} {
+		payment, _ := s.FindPaymentByID(paymentID)
+		if payment.Status != types.PaymentStatusRefunded {
+			t.Errorf("Reject(): payment %v status = %v", paymentID, payment.Status)
+		}
+	}
+	assertBalance(t, s, from.ID, 1_000)
+	assertBalance(t, s, to.ID, 0)
+}
+
+func TestService_Reject_afterConfirmRefunds(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 300, "auto")
+	_ = s.Confirm(payment.ID)
+
+	if err := s.Reject(payment.ID); err != nil {
+		t.Fatalf("Reject(): error = %v", err)
+	}
+	got, _ := s.FindPaymentByID(payment.ID)
+	if got.Status != types.PaymentStatusRefunded {
+		t.Errorf("Reject(): status = %v, want %v", got.Status, types.PaymentStatusRefunded)
+	}
+	assertBalance(t, s, from.ID, 1_000)
+
+	if err := s.Confirm(payment.ID); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Confirm(): must return ErrInvalidStatusTransition, returned = %v", err)
+	}
+}
+
+func TestService_Reject_twice(t *testing.T) {
+	s, from, to := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 300, "auto")
+	out, _ := s.Transfer(from.ID, to.Phone, 200)
+
+	for _, paymentID := range []string{payment.ID, out.ID} {
+		if err := s.Reject(paymentID); err != nil {
+			t.Fatalf("Reject(): error = %v", err)
+		}
+		err := s.Reject(paymentID)
+		var transition *StatusTransitionError
+		if !errors.As(err, &transition) {
+			t.Fatalf("Reject(): must return StatusTransitionError, returned = %v", err)
+		}
+		if transition.From != types.PaymentStatusFail || transition.To != types.PaymentStatusFail {
+			t.Errorf("Reject(): wrong transition %v -> %v", transition.From, transition.To)
+		}
+	}
+	// деньги вернулись ровно один раз
+	assertBalance(t, s, from.ID, 1_000)
+	assertBalance(t, s, to.ID, 0)
+	discrepancies, _ := s.VerifyLedger()
+	if len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v", discrepancies)
+	}
+}
+
+func TestService_PaymentStatusHistory(t *testing.T) {
+	s, from, _ := newTransferService(t)
+	payment, _ := s.Pay(from.ID, 300, "auto")
+	_ = s.Confirm(payment.ID)
+	_ = s.Reject(payment.ID)
+
+	history, err := s.PaymentStatusHistory(payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.PaymentStatus{
+		types.PaymentStatusInProgress,
+		types.PaymentStatusOk,
+		types.PaymentStatusRefunded,
+	}
+	if !reflect.DeepEqual(statusesOf(history), want) {
+		t.Errorf("PaymentStatusHistory(): got %v, want %v", statusesOf(history), want)
+	}
+	for i, change := range history {
+		if change.PaymentID != payment.ID || change.At.IsZero() {
+			t.Errorf("PaymentStatusHistory(): wrong change %v", change)
+		}
+		if i > 0 && (change.From != history[i-1].To || change.At.Before(history[i-1].At)) {
+			t.Errorf("PaymentStatusHistory(): change %v does not follow %v", change, history[i-1])
+		}
+	}
+
+	if _, err := s.PaymentStatusHistory("unknown"); err != ErrPaymentNotFound {
+		t.Errorf("PaymentStatusHistory(): must return ErrPaymentNotFound, returned = %v", err)
+	}
+}
+
+func TestFileRepository_statusHistorySurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 3)
+	account, _ := s.RegisterAccount("+992900000001")
+	_ = s.Deposit(account.ID, 1_000)
+	payment, _ := s.Pay(account.ID, 300, "auto")
+	_ = s.Confirm(payment.ID)
+	_ = s.Reject(payment.ID)
+	want, _ := s.PaymentStatusHistory(payment.ID)
+	_ = repo.Close()
+
+	restored, repo := openFileService(t, dir, 3)
+	defer repo.Close()
+
+	got, err := restored.PaymentStatusHistory(payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PaymentStatusHistory(): got %v, want %v", got, want)
+	}
+	if err := restored.Reject(payment.ID); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Reject(): must return ErrInvalidStatusTransition after restart, returned = %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package wallet
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/FrankS17/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+// ErrSameAccount возвращается при попытке перевести деньги самому себе.
+var ErrSameAccount = errors.New("transfer to the same account")
+
+// Transfer переводит amount со счёта fromAccountID на счёт с телефоном toPhone.
+// У каждой стороны появляется свой платёж (transfer-out и transfer-in), платежи
+// ссылаются друг на друга через CounterpartID. Возвращает платёж отправителя.
+// Перевод на счёт в другой валюте возвращает ErrCurrencyMismatch, для него
+// есть TransferConverted.
+func (s *Service) Transfer(fromAccountID int64, toPhone types.Phone, amount types.Money) (*types.Payment, error) {
+	return s.transfer(fromAccountID, toPhone, amount, false, "")
+}
+
+// transfer переводит деньги, repeatOf — ID платежа повторяемого перевода или "".
+func (s *Service) transfer(fromAccountID int64, toPhone types.Phone, amount types.Money, convert bool, repeatOf string) (*types.Payment, error) {
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	repo := s.storage()
+
+	defer s.flushEvents()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	to, err := repo.Accounts().ByPhone(toPhone)
+	if err != nil {
+		return nil, err
+	}
+	if to.ID == fromAccountID {
+		return nil, ErrSameAccount
+	}
+
+	unlock, err := s.lockAccounts(fromAccountID, to.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	from, err := repo.Accounts().ByID(fromAccountID)
+	if err != nil {
+		return nil, err
+	}
+	if from.Balance < amount {
+		return nil, ErrNotEnoughBalance
+	}
+
+	received := amount
+	if currencyOf(from.Currency) != currencyOf(to.Currency) {
+		if !convert {
+			return nil, ErrCurrencyMismatch
+		}
+		received, err = s.convert(amount, currencyOf(from.Currency), currencyOf(to.Currency), RoundDown)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := s.now()
+	out := &types.Payment{
+		ID:        uuid.New().String(),
+		AccountID: from.ID,
+		Amount:    amount,
+		Category:  types.PaymentCategoryTransferOut,
+		Status:    types.PaymentStatusInProgress,
+		Currency:  currencyOf(from.Currency),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	in := &types.Payment{
+		ID:        uuid.New().String(),
+		AccountID: to.ID,
+		Amount:    received,
+		Category:  types.PaymentCategoryTransferIn,
+		Status:    types.PaymentStatusInProgress,
+		Currency:  currencyOf(to.Currency),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	out.CounterpartID = in.ID
+	in.CounterpartID = out.ID
+
+	err = s.atomically(func() error {
+		err := repo.Payments().Save(out)
+		if err != nil {
+			return err
+		}
+		err = repo.Payments().Save(in)
+		if err != nil {
+			return err
+		}
+		err = s.recordCreated(out)
+		if err != nil {
+			return err
+		}
+		err = s.recordCreated(in)
+		if err != nil {
+			return err
+		}
+		return s.postMove(types.EntryKindTransfer, out.ID, out, in)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordPaymentCreated(out, repeatOf)
+	s.recordPaymentCreated(in, "")
+	return out, nil
+}
+
+// rejectTransfer отменяет перевод по платежу любой из сторон: деньги
+// возвращаются отправителю, оба платежа получают статус FAIL (или REFUNDED,
+// если перевод был подтверждён).
+// Если получатель уже потратил деньги, возвращает ErrNotEnoughBalance.
+// Вызывать под mu.RLock.
+func (s *Service) rejectTransfer(payment *types.Payment) error {
+	repo := s.storage()
+
+	counterpart, err := repo.Payments().ByID(payment.CounterpartID)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lockAccounts(payment.AccountID, counterpart.AccountID)
+	if err != nil {
+		return ErrAccountNotFound
+	}
+	defer unlock()
+
+	out, in := payment, counterpart
+	if payment.Category == types.PaymentCategoryTransferIn {
+		out, in = counterpart, payment
+	}
+
+	// статусы меняются только под блокировками счетов, перечитываем
+	out, err = repo.Payments().ByID(out.ID)
+	if err != nil {
+		return err
+	}
+	in, err = repo.Payments().ByID(in.ID)
+	if err != nil {
+		return err
+	}
+
+	err = checkTransition(out, rejectedStatus(out.Status))
+	if err != nil {
+		return err
+	}
+	err = checkTransition(in, rejectedStatus(in.Status))
+	if err != nil {
+		return err
+	}
+
+	recipient, err := repo.Accounts().ByID(in.AccountID)
+	if err != nil {
+		return ErrAccountNotFound
+	}
+	if recipient.Balance < in.Amount {
+		return ErrNotEnoughBalance
+	}
+
+	outFrom, inFrom := out.Status, in.Status
+	err = s.atomically(func() error {
+		err := s.changeStatus(out, rejectedStatus(out.Status))
+		if err != nil {
+			return err
+		}
+		err = s.changeStatus(in, rejectedStatus(in.Status))
+		if err != nil {
+			return err
+		}
+		return s.postMove(types.EntryKindRefund, out.ID, in, out)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.recordPaymentRejected(out, outFrom)
+	s.recordPaymentRejected(in, inFrom)
+	return nil
+}
+
+// repeatTransfer повторяет перевод от того же отправителя тому же получателю,
+// перевод между валютами пересчитывается по текущему курсу.
+func (s *Service) repeatTransfer(payment *types.Payment) (*types.Payment, error) {
+	counterpart, err := s.FindPaymentByID(payment.CounterpartID)
+	if err != nil {
+		return nil, err
+	}
+
+	out, in := payment, counterpart
+	if payment.Category == types.PaymentCategoryTransferIn {
+		out, in = counterpart, payment
+	}
+
+	recipient, err := s.FindAccountByID(in.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	converted := currencyOf(out.Currency) != currencyOf(in.Currency)
+	return s.transfer(out.AccountID, recipient.Phone, out.Amount, converted, out.ID)
+}
+
+// lockAccounts блокирует счета в порядке возрастания ID, чтобы встречные
+// переводы не заблокировали друг друга. Вызывать под mu.RLock.
+func (s *Service) lockAccounts(accountIDs ...int64) (func(), error) {
+	accounts := s.storage().Accounts()
+
+	ids := append([]int64(nil), accountIDs...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	locked := make([]func(), 0, len(ids))
+	unlock := func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i]()
+		}
+	}
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		_, err := accounts.ByID(id)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		mu := s.accountLock(id)
+		mu.Lock()
+		locked = append(locked, mu.Unlock)
+	}
+	return unlock, nil
+}
@@ -0,0 +1,193 @@
+package wallet
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+func newTransferService(t *testing.T) (*Service, *types.Account, *types.Account) {
+	t.Helper()
+
+	s := &Service{}
+	from, _ := s.RegisterAccount("+992900000001")
+	to, _ := s.RegisterAccount("+992900000002")
+	if err := s.Deposit(from.ID, 1_000); err != nil {
+		t.Fatal(err)
+	}
+	return s, from, to
+}
+
+func assertBalance(t *testing.T, s *Service, accountID int64, want types.Money) {
+	t.Helper()
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != want {
+		t.Errorf("account %v: balance = %v, want %v", accountID, account.Balance, want)
+	}
+}
+
+func TestService_Transfer_success(t *testing.T) {
+	s, from, to := newTransferService(t)
+
+	out, err := s.Transfer(from.ID, to.Phone, 300)
+	if err != nil {
+		t.Fatalf("Transfer(): error = %v", err)
+	}
+	assertBalance(t, s, from.ID, 700)
+	assertBalance(t, s, to.ID, 300)
+
+	if out.Category != types.PaymentCategoryTransferOut || out.AccountID != from.ID {
+		t.Errorf("Transfer(): wrong outgoing payment = %v", out)
+	}
+	in, err := s.FindPaymentByID(out.CounterpartID)
+	if err != nil {
+		t.Fatalf("Transfer(): incoming payment not found, error = %v", err)
+	}
+	if in.Category != types.PaymentCategoryTransferIn || in.AccountID != to.ID || in.CounterpartID != out.ID {
+		t.Errorf("Transfer(): wrong incoming payment = %v", in)
+	}
+
+	discrepancies, _ := s.VerifyLedger()
+	if len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v", discrepancies)
+	}
+}
+
+func TestService_Transfer_errors(t *testing.T) {
+	s, from, to := newTransferService(t)
+
+	if _, err := s.Transfer(from.ID, to.Phone, 5_000); err != ErrNotEnoughBalance {
+		t.Errorf("Transfer(): must return ErrNotEnoughBalance, returned = %v", err)
+	}
+	if _, err := s.Transfer(from.ID, "+992000000000", 100); err != ErrAccountNotFound {
+		t.Errorf("Transfer(): must return ErrAccountNotFound for unknown phone, returned = %v", err)
+	}
+	if _, err := s.Transfer(404, to.Phone, 100); err != ErrAccountNotFound {
+		t.Errorf("Transfer(): must return ErrAccountNotFound for unknown sender, returned = %v", err)
+	}
+	if _, err := s.Transfer(from.ID, from.Phone, 100); err != ErrSameAccount {
+		t.Errorf("Transfer(): must return ErrSameAccount, returned = %v", err)
+	}
+	if _, err := s.Transfer(from.ID, to.Phone, 0); err != ErrAmountMustBePositive {
+		t.Errorf("Transfer(): must return ErrAmountMustBePositive, returned = %v", err)
+	}
+	assertBalance(t, s, from.ID, 1_000)
+	assertBalance(t, s, to.ID, 0)
+}
+
+func TestService_Reject_transfer(t *testing.T) {
+	for _, side := range []string{"out", "in"} {
+		s, from, to := newTransferService(t)
+		out, _ := s.Transfer(from.ID, to.Phone, 300)
+
+		id := out.ID
+		if side == "in" {
+			id = out.CounterpartID
+		}
+		if err := s.Reject(id); err != nil {
+			t.Fatalf("Reject(%s): error = %v", side, err)
+		}
+		assertBalance(t, s, from.ID, 1_000)
+		assertBalance(t, s, to.ID, 0)
+
+		for _, paymentID := range []string{out.ID, out.CounterpartID} {
+			payment, _ := s.FindPaymentByID(paymentID)
+			if payment.Status != types.PaymentStatusFail {
+				t.Errorf("Reject(%s): payment %v status = %v", side, paymentID, payment.Status)
+			}
+		}
+	}
+}
+
+func TestService_Reject_transferAlreadySpent(t *testing.T) {
+	s, from, to := newTransferService(t)
+	out, _ := s.Transfer(from.ID, to.Phone, 300)
+	if _, err := s.Pay(to.ID, 200, "food"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reject(out.ID); err != ErrNotEnoughBalance {
+		t.Errorf("Reject(): must return ErrNotEnoughBalance, returned = %v", err)
+	}
+	assertBalance(t, s, from.ID, 700)
+	assertBalance(t, s, to.ID, 100)
+}
+
+func TestService_Repeat_transfer(t *testing.T) {
+	s, from, to := newTransferService(t)
+	out, _ := s.Transfer(from.ID, to.Phone, 300)
+
+	repeated, err := s.Repeat(out.CounterpartID)
+	if err != nil {
+		t.Fatalf("Repeat(): error = %v", err)
+	}
+	if repeated.Category != types.PaymentCategoryTransferOut || repeated.AccountID != from.ID {
+		t.Errorf("Repeat(): must repeat the transfer from the sender, got %v", repeated)
+	}
+	assertBalance(t, s, from.ID, 400)
+	assertBalance(t, s, to.ID, 600)
+}
+
+func TestService_Transfer_survivesExportImport(t *testing.T) {
+	s, from, to := newTransferService(t)
+	out, _ := s.Transfer(from.ID, to.Phone, 300)
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := imported.Reject(out.CounterpartID); err != nil {
+		t.Fatalf("Reject(): error = %v", err)
+	}
+	assertBalance(t, imported, from.ID, 1_000)
+	assertBalance(t, imported, to.ID, 0)
+}
+
+func TestService_Transfer_concurrentOpposite(t *testing.T) {
+	s := &Service{}
+	first, _ := s.RegisterAccount("+992900000001")
+	second, _ := s.RegisterAccount("+992900000002")
+	_ = s.Deposit(first.ID, 10_000)
+	_ = s.Deposit(second.ID, 10_000)
+
+	// встречные переводы не должны блокировать друг друга
+	wg := sync.WaitGroup{}
+	for i := 0; i < stressGoroutines; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < stressOperations; j++ {
+				if _, err := s.Transfer(first.ID, second.Phone, 1); err != nil {
+					t.Errorf("Transfer(): error = %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < stressOperations; j++ {
+				if _, err := s.Transfer(second.ID, first.Phone, 1); err != nil {
+					t.Errorf("Transfer(): error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assertBalance(t, s, first.ID, 10_000)
+	assertBalance(t, s, second.ID, 10_000)
+	discrepancies, _ := s.VerifyLedger()
+	if len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger(): got discrepancies %v", discrepancies)
+	}
+}
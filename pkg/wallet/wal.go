@@ -0,0 +1,656 @@
+package wallet
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// ErrWALCorrupted возвращается, если повреждена запись журнала, за которой
+// есть другие записи. Оборванная последняя запись ошибкой не считается.
+var ErrWALCorrupted = errors.New("write-ahead log corrupted")
+
+const walFileName = "wal.log"
+
+// Виды записей журнала.
+const (
+	walAccount  = "account"
+	walPayment  = "payment"
+	walFavorite = "favorite"
+	walEntry    = "entry"
+	walStatus   = "status"
+	walKey      = "key"
+	walUnkey    = "unkey" // удаление ключа, в записи только сам ключ
+	walBatch    = "batch" // записи одной операции сервиса, см. encodeBatch
+)
+
+// FileRepository хранит данные в памяти и дописывает каждое изменение в
+// журнал (write-ahead log) в каталоге. Время от времени журнал сжимается в
+// снимок из файлов accounts.dump, payments.dump и favorites.dump в формате Export
+// и файлов проводок ledger.dump, истории статусов statuses.dump и ключей
+// идемпотентности keys.dump.
+//
+// Строка журнала: "<crc32>;<вид>;<запись в формате дампа>\n". Все записи
+// одной операции сервиса (платёж, его статус, проводка и новый баланс)
+// пишутся одной строкой вида batch, поэтому после сбоя операция либо
+// восстанавливается целиком, либо не восстанавливается совсем.
+//
+// Журнал можно применять поверх снимка повторно: записи счетов, платежей,
+// избранного и ключей содержат полное состояние, а проводки и записи
+// истории статусов, которые уже есть в снимке, пропускаются.
+type FileRepository struct {
+	mu           sync.Mutex
+	dir          string
+	wal          *os.File
+	mem          *memoryRepository
+	records      int
+	compactEvery int
+
+	// batchMu держит пакет открытым, pending — записи открытого пакета
+	batchMu sync.Mutex
+	inBatch bool
+	pending []string
+	// broken ошибка записи в журнал: после неё в журнале может остаться
+	// оборванная запись, а память расходится с журналом, поэтому дальше
+	// хранилище ничего не пишет
+	broken error
+}
+
+// OpenFileRepository открывает (или создаёт) хранилище в каталоге dir и
+// восстанавливает состояние из снимка и журнала. После compactEvery записей
+// журнал сжимается в снимок, 0 отключает автоматическое сжатие.
+func OpenFileRepository(dir string, compactEvery int) (*FileRepository, error) {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &FileRepository{
+		dir:          dir,
+		mem:          NewMemoryRepository().(*memoryRepository),
+		compactEvery: compactEvery,
+	}
+
+	err = r.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	err = r.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	r.wal, err = os.OpenFile(filepath.Join(dir, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *FileRepository) Accounts() AccountRepository {
+	return fileAccounts{r}
+}
+
+func (r *FileRepository) Payments() PaymentRepository {
+	return filePayments{r}
+}
+
+func (r *FileRepository) Favorites() FavoriteRepository {
+	return fileFavorites{r}
+}
+
+func (r *FileRepository) Ledger() LedgerRepository {
+	return fileLedger{r}
+}
+
+func (r *FileRepository) Keys() IdempotencyRepository {
+	return fileKeys{r}
+}
+
+// Compact записывает снимок и очищает журнал. Открытый пакет дописывается
+// до снимка, чтобы в снимок не попала половина операции.
+func (r *FileRepository) Compact() error {
+	r.batchMu.Lock()
+	defer r.batchMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.compact()
+}
+
+// Close закрывает журнал. Снимок не пишется: журнал и так содержит все изменения.
+func (r *FileRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.wal.Close()
+}
+
+// write сначала записывает изменение в журнал и только потом применяет его
+// в памяти. В пакете изменение сразу применяется в памяти, а в журнал
+// попадает вместе со всем пакетом.
+func (r *FileRepository) write(kind string, payload string, apply func() error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.broken != nil {
+		return r.broken
+	}
+	if r.inBatch {
+		err := apply()
+		if err != nil {
+			return err
+		}
+		r.pending = append(r.pending, kind, payload)
+		return nil
+	}
+
+	err := r.append(kind, payload)
+	if err != nil {
+		return err
+	}
+	err = apply()
+	if err != nil {
+		return err
+	}
+	return r.maybeCompact()
+}
+
+// batch выполняет fn так, что все записи хранилища, сделанные за это время,
+// попадают в журнал одной записью. Записи уже применены в памяти, поэтому
+// пишутся и тогда, когда fn вернула ошибку: иначе журнал разошёлся бы с
+// памятью.
+//
+// Пока пакет открыт, в него попадают записи всех горутин, поэтому Service
+// открывает пакеты под mu.RLock, а пишет без пакета только под mu.Lock.
+func (r *FileRepository) batch(fn func() error) error {
+	r.batchMu.Lock()
+	defer r.batchMu.Unlock()
+
+	r.mu.Lock()
+	r.inBatch = true
+	r.mu.Unlock()
+
+	err := fn()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := r.pending
+	r.inBatch, r.pending = false, nil
+	if len(pending) == 0 || r.broken != nil {
+		return err
+	}
+	werr := r.append(walBatch, encodeBatch(pending))
+	if werr == nil {
+		werr = r.maybeCompact()
+	}
+	if werr != nil {
+		return werr
+	}
+	return err
+}
+
+// append дописывает запись в журнал, вызывать под mu.
+func (r *FileRepository) append(kind string, payload string) error {
+	_, err := r.wal.WriteString(encodeWALRecord(kind, payload))
+	if err == nil {
+		err = r.wal.Sync()
+	}
+	if err != nil {
+		r.broken = fmt.Errorf("write-ahead log: %w", err)
+		return r.broken
+	}
+	r.records++
+	return nil
+}
+
+// maybeCompact сжимает журнал, когда в нём набралось compactEvery записей.
+func (r *FileRepository) maybeCompact() error {
+	if r.compactEvery > 0 && r.records >= r.compactEvery {
+		return r.compact()
+	}
+	return nil
+}
+
+// encodeBatch склеивает пары вид, запись в одну запись журнала:
+// "<вид>;<длина записи>;<запись>" подряд. Длина нужна, потому что в
+// записях дампа есть ";".
+func encodeBatch(pending []string) string {
+	buf := strings.Builder{}
+	for i := 0; i+1 < len(pending); i += 2 {
+		buf.WriteString(pending[i])
+		buf.WriteByte(';')
+		buf.WriteString(strconv.Itoa(len(pending[i+1])))
+		buf.WriteByte(';')
+		buf.WriteString(pending[i+1])
+	}
+	return buf.String()
+}
+
+// decodeBatch разбирает запись encodeBatch обратно в пары вид, запись.
+func decodeBatch(payload string) ([]string, error) {
+	records := []string{}
+	for payload != "" {
+		parts := strings.SplitN(payload, ";", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%w: malformed batch", ErrWALCorrupted)
+		}
+		size, err := strconv.Atoi(parts[1])
+		if err != nil || size < 0 || size > len(parts[2]) {
+			return nil, fmt.Errorf("%w: malformed batch", ErrWALCorrupted)
+		}
+		records = append(records, parts[0], parts[2][:size])
+		payload = parts[2][size:]
+	}
+	return records, nil
+}
+
+func encodeWALRecord(kind string, payload string) string {
+	body := kind + ";" + payload
+	return fmt.Sprintf("%08x;%s\n", crc32.ChecksumIEEE([]byte(body)), body)
+}
+
+func decodeWALRecord(line string) (kind string, payload string, err error) {
+	parts := strings.SplitN(line, ";", 3)
+	if len(parts) != 3 {
+		return "", "", ErrWALCorrupted
+	}
+	body := parts[1] + ";" + parts[2]
+	if fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(body))) != parts[0] {
+		return "", "", ErrWALCorrupted
+	}
+	return parts[1], parts[2], nil
+}
+
+// apply применяет запись журнала или снимка к данным в памяти.
+func (r *FileRepository) apply(kind string, payload string) error {
+	switch kind {
+	case walAccount:
+		account, err := parseAccount(payload)
+		if err != nil {
+			return err
+		}
+		return r.mem.accounts.Save(&account)
+	case walPayment:
+		payment, err := parsePayment(payload)
+		if err != nil {
+			return err
+		}
+		return r.mem.payments.Save(&payment)
+	case walFavorite:
+		favorite, err := parseFavorite(payload)
+		if err != nil {
+			return err
+		}
+		return r.mem.favorites.Save(&favorite)
+	case walEntry:
+		entry, err := parseEntry(payload)
+		if err != nil {
+			return err
+		}
+		// сбой между записью снимка и очисткой журнала оставляет в журнале
+		// проводки, которые уже есть в ledger.dump
+		if r.mem.ledger.has(entry.ID) {
+			return nil
+		}
+		return r.mem.ledger.Append(&entry)
+	case walStatus:
+		change, err := parseStatusChange(payload)
+		if err != nil {
+			return err
+		}
+		// как и проводка, запись может уже быть в statuses.dump
+		if r.mem.payments.hasStatusChange(&change) {
+			return nil
+		}
+		return r.mem.payments.AddStatusChange(&change)
+	case walKey:
+		record, err := parseIdempotencyRecord(payload)
+		if err != nil {
+			return err
+		}
+		return r.mem.keys.Save(&record)
+	case walUnkey:
+		return r.mem.keys.Delete(unescapeField(payload))
+	case walBatch:
+		records, err := decodeBatch(payload)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(records); i += 2 {
+			if records[i] == walBatch {
+				return fmt.Errorf("%w: nested batch", ErrWALCorrupted)
+			}
+			err = r.apply(records[i], records[i+1])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unknown record kind %q", ErrWALCorrupted, kind)
+}
+
+func (r *FileRepository) loadSnapshot() error {
+	files := []struct {
+		name string
+		kind string
+	}{
+		{"accounts.dump", walAccount},
+		{"payments.dump", walPayment},
+		{"favorites.dump", walFavorite},
+		{"ledger.dump", walEntry},
+		{"statuses.dump", walStatus},
+		{"keys.dump", walKey},
+	}
+
+	for _, file := range files {
+		src, err := os.Open(filepath.Join(r.dir, file.name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		dec := NewDumpDecoder(src)
+		for {
+			var line string
+			line, err = dec.readLine()
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			if err != nil {
+				break
+			}
+			err = r.apply(file.kind, line)
+			if err != nil {
+				err = fmt.Errorf("line %d: %w", dec.Line(), err)
+				break
+			}
+		}
+		if cerr := src.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.name, err)
+		}
+	}
+	return nil
+}
+
+// replay применяет журнал поверх снимка. Оборванную последнюю запись
+// (сбой посреди записи) отрезает, повреждение в середине считает ошибкой.
+func (r *FileRepository) replay() error {
+	path := filepath.Join(r.dir, walFileName)
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	reader := bufio.NewReader(src)
+	good := int64(0)
+	torn := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// запись без перевода строки не была дописана до конца
+			torn = len(line) > 0
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		kind, payload, err := decodeWALRecord(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			if _, perr := reader.Peek(1); perr == io.EOF {
+				torn = true
+				break
+			}
+			return fmt.Errorf("%w: offset %d", ErrWALCorrupted, good)
+		}
+
+		err = r.apply(kind, payload)
+		if err != nil {
+			return fmt.Errorf("%w: offset %d: %v", ErrWALCorrupted, good, err)
+		}
+		good += int64(len(line))
+		r.records++
+	}
+
+	if torn {
+		return os.Truncate(path, good)
+	}
+	return nil
+}
+
+// compact записывает снимок и очищает журнал, вызывать под mu.
+// Журнал очищается только после того, как все файлы снимка на месте,
+// поэтому сбой посреди сжатия не теряет данных.
+func (r *FileRepository) compact() error {
+	accounts, _ := r.mem.accounts.All()
+	lines := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		lines = append(lines, formatAccount(*account))
+	}
+	err := writeFileAtomic(filepath.Join(r.dir, "accounts.dump"), lines)
+	if err != nil {
+		return err
+	}
+
+	payments, _ := r.mem.payments.All()
+	lines = make([]string, 0, len(payments))
+	for _, payment := range payments {
+		lines = append(lines, formatPayment(*payment))
+	}
+	err = writeFileAtomic(filepath.Join(r.dir, "payments.dump"), lines)
+	if err != nil {
+		return err
+	}
+
+	favorites, _ := r.mem.favorites.All()
+	lines = make([]string, 0, len(favorites))
+	for _, favorite := range favorites {
+		lines = append(lines, formatFavorite(*favorite))
+	}
+	err = writeFileAtomic(filepath.Join(r.dir, "favorites.dump"), lines)
+	if err != nil {
+		return err
+	}
+
+	entries, _ := r.mem.ledger.All()
+	lines = make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, formatEntry(*entry))
+	}
+	err = writeFileAtomic(filepath.Join(r.dir, "ledger.dump"), lines)
+	if err != nil {
+		return err
+	}
+
+	changes := r.mem.payments.allStatusChanges()
+	lines = make([]string, 0, len(changes))
+	for _, change := range changes {
+		lines = append(lines, formatStatusChange(change))
+	}
+	err = writeFileAtomic(filepath.Join(r.dir, "statuses.dump"), lines)
+	if err != nil {
+		return err
+	}
+
+	records, _ := r.mem.keys.All()
+	lines = make([]string, 0, len(records))
+	for _, record := range records {
+		lines = append(lines, formatIdempotencyRecord(*record))
+	}
+	err = writeFileAtomic(filepath.Join(r.dir, "keys.dump"), lines)
+	if err != nil {
+		return err
+	}
+
+	err = r.wal.Truncate(0)
+	if err != nil {
+		return err
+	}
+	r.records = 0
+	return r.wal.Sync()
+}
+
+// writeFileAtomic пишет строки во временный файл и переименовывает его в path.
+func writeFileAtomic(path string, lines []string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		_, err = writer.WriteString(line + "\n")
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type fileAccounts struct {
+	r *FileRepository
+}
+
+func (a fileAccounts) Save(account *types.Account) error {
+	return a.r.write(walAccount, formatAccount(*account), func() error {
+		return a.r.mem.accounts.Save(account)
+	})
+}
+
+func (a fileAccounts) ByID(accountID int64) (*types.Account, error) {
+	return a.r.mem.accounts.ByID(accountID)
+}
+
+func (a fileAccounts) ByPhone(phone types.Phone) (*types.Account, error) {
+	return a.r.mem.accounts.ByPhone(phone)
+}
+
+func (a fileAccounts) All() ([]*types.Account, error) {
+	return a.r.mem.accounts.All()
+}
+
+type filePayments struct {
+	r *FileRepository
+}
+
+func (p filePayments) Save(payment *types.Payment) error {
+	return p.r.write(walPayment, formatPayment(*payment), func() error {
+		return p.r.mem.payments.Save(payment)
+	})
+}
+
+func (p filePayments) ByID(paymentID string) (*types.Payment, error) {
+	return p.r.mem.payments.ByID(paymentID)
+}
+
+func (p filePayments) ByAccount(accountID int64) ([]*types.Payment, error) {
+	return p.r.mem.payments.ByAccount(accountID)
+}
+
+func (p filePayments) All() ([]*types.Payment, error) {
+	return p.r.mem.payments.All()
+}
+
+func (p filePayments) AddStatusChange(change *types.PaymentStatusChange) error {
+	return p.r.write(walStatus, formatStatusChange(*change), func() error {
+		return p.r.mem.payments.AddStatusChange(change)
+	})
+}
+
+func (p filePayments) StatusHistory(paymentID string) ([]types.PaymentStatusChange, error) {
+	return p.r.mem.payments.StatusHistory(paymentID)
+}
+
+type fileFavorites struct {
+	r *FileRepository
+}
+
+func (f fileFavorites) Save(favorite *types.Favorite) error {
+	return f.r.write(walFavorite, formatFavorite(*favorite), func() error {
+		return f.r.mem.favorites.Save(favorite)
+	})
+}
+
+func (f fileFavorites) ByID(favoriteID string) (*types.Favorite, error) {
+	return f.r.mem.favorites.ByID(favoriteID)
+}
+
+func (f fileFavorites) All() ([]*types.Favorite, error) {
+	return f.r.mem.favorites.All()
+}
+
+type fileLedger struct {
+	r *FileRepository
+}
+
+func (l fileLedger) Append(entry *types.LedgerEntry) error {
+	return l.r.write(walEntry, formatEntry(*entry), func() error {
+		return l.r.mem.ledger.Append(entry)
+	})
+}
+
+func (l fileLedger) ByAccount(account types.LedgerAccount) ([]*types.LedgerEntry, error) {
+	return l.r.mem.ledger.ByAccount(account)
+}
+
+func (l fileLedger) All() ([]*types.LedgerEntry, error) {
+	return l.r.mem.ledger.All()
+}
+
+type fileKeys struct {
+	r *FileRepository
+}
+
+func (k fileKeys) Save(record *types.IdempotencyRecord) error {
+	return k.r.write(walKey, formatIdempotencyRecord(*record), func() error {
+		return k.r.mem.keys.Save(record)
+	})
+}
+
+func (k fileKeys) ByKey(key string) (*types.IdempotencyRecord, error) {
+	return k.r.mem.keys.ByKey(key)
+}
+
+func (k fileKeys) Delete(key string) error {
+	return k.r.write(walUnkey, escapeField(key), func() error {
+		return k.r.mem.keys.Delete(key)
+	})
+}
+
+func (k fileKeys) All() ([]*types.IdempotencyRecord, error) {
+	return k.r.mem.keys.All()
+}
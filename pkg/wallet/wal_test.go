@@ -0,0 +1,354 @@
+package wallet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FrankS17/wallet/pkg/types"
+)
+
+// fillService выполняет все виды изменений: регистрацию, пополнение, платёж, отмену и избранное.
+func fillService(t *testing.T, s *Service) {
+	t.Helper()
+
+	first, err := s.RegisterAccount("+992900000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.RegisterAccount("+992900000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(first.ID, 1_000); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(second.ID, 500); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := s.Pay(first.ID, 300, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FavoritePayment(payment.ID, "car"); err != nil {
+		t.Fatal(err)
+	}
+	rejected, err := s.Pay(second.ID, 200, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reject(rejected.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openFileService(t *testing.T, dir string, compactEvery int) (*Service, *FileRepository) {
+	t.Helper()
+
+	repo, err := OpenFileRepository(dir, compactEvery)
+	if err != nil {
+		t.Fatalf("OpenFileRepository(): error = %v", err)
+	}
+	s, err := NewService(repo)
+	if err != nil {
+		t.Fatalf("NewService(): error = %v", err)
+	}
+	return s, repo
+}
+
+func assertSameState(t *testing.T, want, got *Service) {
+	t.Helper()
+
+	wantAccounts, wantPayments, wantFavorites, _ := want.snapshot()
+	gotAccounts, gotPayments, gotFavorites, err := got.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantAccounts, gotAccounts) {
+		t.Errorf("accounts differ,\n got = %v,\n want = %v", gotAccounts, wantAccounts)
+	}
+	if !reflect.DeepEqual(wantPayments, gotPayments) {
+		t.Errorf("payments differ,\n got = %v,\n want = %v", gotPayments, wantPayments)
+	}
+	if !reflect.DeepEqual(wantFavorites, gotFavorites) {
+		t.Errorf("favorites differ,\n got = %v,\n want = %v", gotFavorites, wantFavorites)
+	}
+}
+
+func TestFileRepository_replay(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 0)
+	fillService(t, s)
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, repo := openFileService(t, dir, 0)
+	defer repo.Close()
+	assertSameState(t, s, restored)
+
+	account, err := restored.RegisterAccount("+992900000003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ID != 3 {
+		t.Errorf("RegisterAccount(): got ID %v after replay, want 3", account.ID)
+	}
+}
+
+func TestFileRepository_compact(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 4)
+	fillService(t, s)
+	if err := repo.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Compact(): wal size = %v, want 0", info.Size())
+	}
+
+	// снимок читается обычным Import
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	assertSameState(t, s, imported)
+
+	restored, repo := openFileService(t, dir, 4)
+	defer repo.Close()
+	assertSameState(t, s, restored)
+}
+
+func TestFileRepository_tornFinalRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 0)
+	fillService(t, s)
+	_ = repo.Close()
+
+	path := filepath.Join(dir, walFileName)
+	before, _ := os.Stat(path)
+
+	tails := []string{
+		"1a2b", // оборвалась контрольная сумма
+		encodeWALRecord(walAccount, "1;+992;100")[:20], // оборвалась сама запись
+		"00000000;account;1;+992900000001;0\n",         // запись целиком, но сумма не сходится
+	}
+	for _, tail := range tails {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = file.WriteString(tail)
+		_ = file.Close()
+
+		restored, repo := openFileService(t, dir, 0)
+		assertSameState(t, s, restored)
+		_ = repo.Close()
+
+		after, _ := os.Stat(path)
+		if after.Size() != before.Size() {
+			t.Errorf("torn tail %q: wal size = %v, want %v", tail, after.Size(), before.Size())
+		}
+	}
+}
+
+func TestFileRepository_corruptedMiddle(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 0)
+	fillService(t, s)
+	_ = repo.Close()
+
+	path := filepath.Join(dir, walFileName)
+	data, _ := os.ReadFile(path)
+	data[3] ^= 0xff
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := OpenFileRepository(dir, 0)
+	if !errors.Is(err, ErrWALCorrupted) {
+		t.Errorf("OpenFileRepository(): must return ErrWALCorrupted, returned = %v", err)
+	}
+}
+
+func TestFileRepository_automaticCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 3)
+	defer repo.Close()
+	fillService(t, s)
+
+	data, err := os.ReadFile(filepath.Join(dir, "accounts.dump"))
+	if err != nil {
+		t.Fatalf("accounts.dump must be written by compaction, error = %v", err)
+	}
+	account, err := parseAccount(strings.SplitN(string(data), "\n", 2)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ID != 1 {
+		t.Errorf("accounts.dump: got %v", account)
+	}
+
+	restored, repo2 := openFileService(t, dir, 3)
+	defer repo2.Close()
+	assertSameState(t, s, restored)
+
+	got, _ := restored.FindAccountByID(2)
+	if got.Balance != types.Money(500) {
+		t.Errorf("balance = %v, want 500", got.Balance)
+	}
+}
+
+func TestFileRepository_operationIsOneRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 0)
+	fillService(t, s)
+	_ = repo.Close()
+
+	path := filepath.Join(dir, walFileName)
+	before, _ := os.ReadFile(path)
+
+	s, repo = openFileService(t, dir, 0)
+	if _, err := s.Pay(1, 100, "auto"); err != nil {
+		t.Fatal(err)
+	}
+	_ = repo.Close()
+
+	// платёж, его статус, проводка и баланс — одна запись журнала
+	after, _ := os.ReadFile(path)
+	tail := string(after[len(before):])
+	if strings.Count(tail, "\n") != 1 || !strings.Contains(tail, ";"+walBatch+";") {
+		t.Fatalf("Pay() wrote %q, want one batch record", tail)
+	}
+
+	// сбой посреди записи теряет операцию целиком
+	if err := os.WriteFile(path, after[:len(before)+len(tail)/2], 0666); err != nil {
+		t.Fatal(err)
+	}
+	restored, repo := openFileService(t, dir, 0)
+	defer repo.Close()
+	account, _ := restored.FindAccountByID(1)
+	if account.Balance != 700 {
+		t.Errorf("balance after torn Pay() = %v, want 700", account.Balance)
+	}
+	payments, _ := restored.Payments()
+	if len(payments) != 2 {
+		t.Errorf("payments after torn Pay() = %v, want 2", len(payments))
+	}
+	if discrepancies, err := restored.VerifyLedger(); err != nil || len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger() = %v, %v", discrepancies, err)
+	}
+}
+
+// assertOneBatch проверяет, что fn записала изменения сервиса из dir одной
+// записью журнала, то есть сбой не оставит их наполовину.
+func assertOneBatch(t *testing.T, dir string, op string, fn func(s *Service) error) {
+	t.Helper()
+
+	s, repo := openFileService(t, dir, 0)
+	defer repo.Close()
+	path := filepath.Join(dir, walFileName)
+	before, _ := os.ReadFile(path)
+	if err := fn(s); err != nil {
+		t.Fatalf("%s: error = %v", op, err)
+	}
+	after, _ := os.ReadFile(path)
+	tail := string(after[len(before):])
+	if strings.Count(tail, "\n") != 1 || !strings.Contains(tail, ";"+walBatch+";") {
+		t.Errorf("%s wrote %d journal records, want one batch", op, strings.Count(tail, "\n"))
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+	pending := []string{walPayment, "a;b;c", walEntry, "", walAccount, "1;+992;100"}
+	got, err := decodeBatch(encodeBatch(pending))
+	if err != nil || !reflect.DeepEqual(got, pending) {
+		t.Errorf("decodeBatch(encodeBatch()) = %q, %v", got, err)
+	}
+
+	for _, payload := range []string{"payment;5;abc", "payment;x;abc", "payment"} {
+		if _, err := decodeBatch(payload); !errors.Is(err, ErrWALCorrupted) {
+			t.Errorf("decodeBatch(%q): error = %v, want ErrWALCorrupted", payload, err)
+		}
+	}
+}
+
+func TestFileRepository_replayAfterCompactCrash(t *testing.T) {
+	dir := t.TempDir()
+	s, repo := openFileService(t, dir, 0)
+	fillService(t, s)
+
+	// сбой после записи снимка, но до очистки журнала
+	path := filepath.Join(dir, walFileName)
+	wal, _ := os.ReadFile(path)
+	if err := repo.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	_ = repo.Close()
+	if err := os.WriteFile(path, wal, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, repo := openFileService(t, dir, 0)
+	defer repo.Close()
+	assertSameState(t, s, restored)
+
+	want, _ := s.storage().Ledger().All()
+	got, _ := restored.storage().Ledger().All()
+	if len(got) != len(want) {
+		t.Errorf("ledger after replay: %d entries, want %d", len(got), len(want))
+	}
+	if discrepancies, err := restored.VerifyLedger(); err != nil || len(discrepancies) != 0 {
+		t.Errorf("VerifyLedger() = %v, %v", discrepancies, err)
+	}
+
+	payments, _ := s.Payments()
+	for _, payment := range payments {
+		want, _ := s.PaymentStatusHistory(payment.ID)
+		got, _ := restored.PaymentStatusHistory(payment.ID)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("status history of %s after replay = %v, want %v", payment.ID, got, want)
+		}
+	}
+}
+
+func TestFileRepository_replayKeyDelete(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := OpenFileRepository(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "a;b\nc\r"} {
+		err = repo.Keys().Save(&types.IdempotencyRecord{Key: key, Request: "deposit"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Keys().Delete("a;b\nc\r"); err != nil {
+		t.Fatal(err)
+	}
+	_ = repo.Close()
+
+	repo, err = OpenFileRepository(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenFileRepository() after delete: error = %v", err)
+	}
+	defer repo.Close()
+	if _, err := repo.Keys().ByKey("a;b\nc\r"); !errors.Is(err, ErrIdempotencyKeyNotFound) {
+		t.Errorf("deleted key after replay: error = %v, want %v", err, ErrIdempotencyKeyNotFound)
+	}
+	if _, err := repo.Keys().ByKey("a"); err != nil {
+		t.Errorf("kept key after replay: error = %v", err)
+	}
+}
@@ -0,0 +1,5 @@
+// Package walletpb содержит сообщения и gRPC-заглушки сервиса кошелька,
+// сгенерированные из wallet.proto.
+package walletpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative wallet.proto